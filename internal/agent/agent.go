@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"crypto/rsa"
+	"io"
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec // exposed on a separate port that should be unavailable
 	"net/url"
@@ -17,7 +18,11 @@ import (
 	gRPCClient "github.com/ivas1ly/uwu-metrics/internal/client/grpc"
 	HTTPClient "github.com/ivas1ly/uwu-metrics/internal/client/http"
 	"github.com/ivas1ly/uwu-metrics/internal/lib/logger"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/envelope"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/randkey"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/tlsconfig"
 	"github.com/ivas1ly/uwu-metrics/pkg/netutil"
 )
 
@@ -50,25 +55,68 @@ func Run(cfg Config) {
 		publicKey, err = rsakeys.PublicKey(cfg.PublicKeyPath)
 		if err != nil {
 			log.Warn("can't get public key from file", zap.Error(err))
+		} else {
+			// the key ID is sent with each payload, the server must have it in the active keys
+			log.Info("public key successfully loaded", zap.String("key ID", envelope.KeyID(publicKey)))
 		}
-		log.Info("public key successfully loaded")
+	}
+
+	scheme := "http"
+	var (
+		httpOpts []HTTPClient.Option
+		gRPCOpts []gRPCClient.Option
+	)
+	if cfg.TLSEnabled() {
+		tlsConfig, errTLS := tlsconfig.Client(cfg.TLSCAPath, cfg.TLSCertPath, cfg.TLSKeyPath)
+		if errTLS != nil {
+			log.Error("can't load TLS certificates, the agent isn't started", zap.Error(errTLS))
+			return
+		}
+		log.Info("TLS enabled", zap.Bool("client certificate", cfg.TLSCertPath != ""))
+
+		scheme = "https"
+		httpOpts = append(httpOpts, HTTPClient.WithTLSConfig(tlsConfig))
+		gRPCOpts = append(gRPCOpts, gRPCClient.WithTLSConfig(tlsConfig))
+	}
+
+	// the server keeps the cumulative totals of each instance separately, so the agents
+	// sharing an address don't reset the totals of each other
+	instanceID, err := randkey.RandKey()
+	if err != nil {
+		log.Error("can't generate agent instance ID, the agent isn't started", zap.Error(err))
+		return
+	}
+	log.Info("agent instance", zap.String("instance ID", instanceID))
+	httpOpts = append(httpOpts, HTTPClient.WithInstanceID(instanceID))
+	gRPCOpts = append(gRPCOpts, gRPCClient.WithInstanceID(instanceID))
+
+	if cfg.AgentID != "" && cfg.SignKeyPath != "" {
+		signKey, errSign := signkeys.PrivateKey(cfg.SignKeyPath)
+		if errSign != nil {
+			log.Error("can't load agent sign key, the agent isn't started", zap.Error(errSign))
+			return
+		}
+		log.Info("requests are signed by the agent", zap.String("agent ID", cfg.AgentID))
+
+		httpOpts = append(httpOpts, HTTPClient.WithSignKey(cfg.AgentID, signKey))
+		gRPCOpts = append(gRPCOpts, gRPCClient.WithSignKey(cfg.AgentID, signKey))
 	}
 
 	var client Client
 	if cfg.EndpointHost != "" {
 		httpEndpoint := url.URL{
-			Scheme: "http",
+			Scheme: scheme,
 			Host:   cfg.EndpointHost,
 			Path:   "/updates/",
 		}
 
 		client = HTTPClient.NewClient(ms, netutil.GetOutboundIP(), publicKey,
-			httpEndpoint.String(), []byte(cfg.HashKey), log.With(zap.String("client", "HTTP")))
+			httpEndpoint.String(), []byte(cfg.HashKey), log.With(zap.String("client", "HTTP")), httpOpts...)
 	}
 
 	if cfg.GRPCEndpointHost != "" {
-		client = gRPCClient.NewClient(ms, netutil.GetOutboundIP(),
-			cfg.GRPCEndpointHost, log.With(zap.String("client", "gRPC")))
+		client = gRPCClient.NewClient(ms, netutil.GetOutboundIP(), publicKey,
+			cfg.GRPCEndpointHost, []byte(cfg.HashKey), log.With(zap.String("client", "gRPC")), gRPCOpts...)
 	}
 
 	log.Info("agent started", zap.String("server endpoint", cfg.EndpointHost),
@@ -98,6 +146,12 @@ func Run(cfg Config) {
 	}
 	log.Info("metrics saved successfully")
 
+	if closer, ok := client.(io.Closer); ok {
+		if err = closer.Close(); err != nil {
+			log.Info("can't close client", zap.Error(err))
+		}
+	}
+
 	log.Info("shutdown successfully")
 }
 
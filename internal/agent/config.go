@@ -24,6 +24,11 @@ const (
 	examplePublicKeyPath    = "./cmd/agent/public_key.pem"
 	defaultFilePerm         = 0666
 	exampleConfigPathUsage  = "./config/agent.json"
+	exampleTLSCAPath        = "./certs/ca.pem"
+	exampleTLSCertPath      = "./certs/agent.pem"
+	exampleTLSKeyPath       = "./certs/agent-key.pem"
+	exampleAgentID          = "web-1"
+	exampleSignKeyPath      = "./certs/agent-sign-key.pem"
 )
 
 const (
@@ -34,6 +39,12 @@ const (
 	flagHashKey          = "k"
 	flagRateLimit        = "l"
 	flagPublicKey        = "crypto-key"
+	flagTLS              = "tls"
+	flagTLSCA            = "tls-ca"
+	flagTLSCert          = "tls-cert"
+	flagTLSKey           = "tls-key"
+	flagAgentID          = "agent-id"
+	flagSignKey          = "sign-key"
 )
 
 // Config structure contains the received information for running the application.
@@ -42,9 +53,21 @@ type Config struct {
 	GRPCEndpointHost string
 	HashKey          string
 	PublicKeyPath    string
+	TLSCAPath        string
+	TLSCertPath      string
+	TLSKeyPath       string
+	AgentID          string
+	SignKeyPath      string
 	PollInterval     time.Duration
 	ReportInterval   time.Duration
 	RateLimit        int
+	TLS              bool
+}
+
+// TLSEnabled reports whether the agent connects to the server over TLS,
+// it's enabled explicitly or by setting the CA or the client certificate.
+func (c Config) TLSEnabled() bool {
+	return c.TLS || c.TLSCAPath != "" || c.TLSCertPath != ""
 }
 
 // NewConfig creates a new configuration depending on the method.
@@ -59,6 +82,12 @@ func NewConfig() Config {
 		PollInterval:     defaultPollInterval,
 		ReportInterval:   defaultReportInterval,
 		RateLimit:        defaultRateLimit,
+		TLS:              false,
+		TLSCAPath:        "",
+		TLSCertPath:      "",
+		TLSKeyPath:       "",
+		AgentID:          "",
+		SignKeyPath:      "",
 	}
 
 	endpointHostUsage := fmt.Sprintf("HTTP server report endpoint, example: %q", defaultEndpointHost)
@@ -86,6 +115,29 @@ func NewConfig() Config {
 		examplePublicKeyPath)
 	publicKeyPath := flag.String(flagPublicKey, "", publicKeyPathUsage)
 
+	tlsUsage := "connect to the server over TLS, the server certificate is verified with the system roots " +
+		"if the CA isn't set"
+	useTLS := flag.Bool(flagTLS, false, tlsUsage)
+
+	tlsCAUsage := fmt.Sprintf("path to the file with the CA of the server certificate, enables TLS, "+
+		"example: %s", exampleTLSCAPath)
+	tlsCA := flag.String(flagTLSCA, "", tlsCAUsage)
+
+	tlsCertUsage := fmt.Sprintf("path to the file with the agent certificate for mutual TLS, enables TLS, "+
+		"the file is reloaded when it's modified, example: %s", exampleTLSCertPath)
+	tlsCert := flag.String(flagTLSCert, "", tlsCertUsage)
+
+	tlsKeyUsage := fmt.Sprintf("path to the file with the agent certificate private key, example: %s",
+		exampleTLSKeyPath)
+	tlsKey := flag.String(flagTLSKey, "", tlsKeyUsage)
+
+	agentIDUsage := fmt.Sprintf("ID of the agent in the agent keys file of the server, example: %q", exampleAgentID)
+	agentID := flag.String(flagAgentID, "", agentIDUsage)
+
+	signKeyUsage := fmt.Sprintf("path to the file with the Ed25519 private key of the agent, the requests "+
+		"are signed with it if the agent ID is set, example: %s", exampleSignKeyPath)
+	signKey := flag.String(flagSignKey, "", signKeyUsage)
+
 	var configPath string
 	configPathUsage := fmt.Sprintf(", example: %s", exampleConfigPathUsage)
 	flag.StringVar(&configPath, "config", "", configPathUsage)
@@ -131,6 +183,30 @@ func NewConfig() Config {
 		cfg.RateLimit = *rateLimit
 	}
 
+	if flags.IsFlagPassed(flagTLS) {
+		cfg.TLS = *useTLS
+	}
+
+	if flags.IsFlagPassed(flagTLSCA) {
+		cfg.TLSCAPath = *tlsCA
+	}
+
+	if flags.IsFlagPassed(flagTLSCert) {
+		cfg.TLSCertPath = *tlsCert
+	}
+
+	if flags.IsFlagPassed(flagTLSKey) {
+		cfg.TLSKeyPath = *tlsKey
+	}
+
+	if flags.IsFlagPassed(flagAgentID) {
+		cfg.AgentID = *agentID
+	}
+
+	if flags.IsFlagPassed(flagSignKey) {
+		cfg.SignKeyPath = *signKey
+	}
+
 	// check report interval value
 	if *reportInterval <= 0 {
 		cfg.ReportInterval = defaultReportInterval * time.Second
@@ -182,6 +258,33 @@ func NewConfig() Config {
 		cfg.PublicKeyPath = publicKey
 	}
 
+	if tlsEnv := os.Getenv("TLS"); tlsEnv != "" {
+		envValue, err := strconv.ParseBool(tlsEnv)
+		if err == nil {
+			cfg.TLS = envValue
+		}
+	}
+
+	if tlsCAEnv := os.Getenv("TLS_CA"); tlsCAEnv != "" {
+		cfg.TLSCAPath = tlsCAEnv
+	}
+
+	if tlsCertEnv := os.Getenv("TLS_CERT"); tlsCertEnv != "" {
+		cfg.TLSCertPath = tlsCertEnv
+	}
+
+	if tlsKeyEnv := os.Getenv("TLS_KEY"); tlsKeyEnv != "" {
+		cfg.TLSKeyPath = tlsKeyEnv
+	}
+
+	if agentIDEnv := os.Getenv("AGENT_ID"); agentIDEnv != "" {
+		cfg.AgentID = agentIDEnv
+	}
+
+	if signKeyEnv := os.Getenv("SIGN_KEY"); signKeyEnv != "" {
+		cfg.SignKeyPath = signKeyEnv
+	}
+
 	fmt.Printf("\nstart application with final config: %+v\n\n", cfg)
 
 	return cfg
@@ -194,7 +297,13 @@ type FileConfig struct {
 	PollInterval   string `json:"poll_interval"`
 	HashKey        string `json:"hash_key"`
 	CryptoKey      string `json:"crypto_key"`
+	TLSCA          string `json:"tls_ca"`
+	TLSCert        string `json:"tls_cert"`
+	TLSKey         string `json:"tls_key"`
+	AgentID        string `json:"agent_id"`
+	SignKey        string `json:"sign_key"`
 	RateLimit      int    `json:"rate_limit"`
+	TLS            bool   `json:"tls"`
 }
 
 func (c *Config) GetConfigFromFile(filePath string) error {
@@ -218,6 +327,12 @@ func (c *Config) GetConfigFromFile(filePath string) error {
 	c.HashKey = fileConfig.HashKey
 	c.PublicKeyPath = fileConfig.CryptoKey
 	c.RateLimit = fileConfig.RateLimit
+	c.TLS = fileConfig.TLS
+	c.TLSCAPath = fileConfig.TLSCA
+	c.TLSCertPath = fileConfig.TLSCert
+	c.TLSKeyPath = fileConfig.TLSKey
+	c.AgentID = fileConfig.AgentID
+	c.SignKeyPath = fileConfig.SignKey
 
 	pollIntervalDuration, err := time.ParseDuration(fileConfig.PollInterval)
 	if err != nil {
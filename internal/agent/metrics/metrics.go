@@ -21,6 +21,9 @@ const (
 	maxRandomValue = 100000
 )
 
+// CounterModeCumulative is sent with counters that hold the running total since the agent start.
+const CounterModeCumulative = "cumulative"
+
 // Metrics structure for storing the values of the collected metrics.
 type Metrics struct {
 	// Gauge
@@ -108,6 +111,7 @@ func (ms *Metrics) PrepareGaugeReport() map[string]float64 {
 }
 
 // PrepareCounterReport prepares the counter type metrics to be sent to the server.
+// The counters are never reset, so they must be sent in the CounterModeCumulative mode.
 func (ms *Metrics) PrepareCounterReport() map[string]int64 {
 	report := make(map[string]int64, 1)
 	report["PollCount"] = ms.PollCount
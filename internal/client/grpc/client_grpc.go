@@ -2,23 +2,47 @@ package grpc
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ivas1ly/uwu-metrics/internal/agent/metrics"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/envelope"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/randkey"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
 	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip" // Install the gzip compressor
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	defaultPayloadCap    = 40
 	defaultClientTimeout = 10 * time.Second
+	// maxStreamAttempts limits the attempts to send a report, the stream is reopened
+	// before each next attempt.
+	maxStreamAttempts = 3
+	reconnectBackoff  = 1 * time.Second
 )
 
+// errReportRejected means the server acknowledged the report with an error, the report isn't applied.
+var errReportRejected = errors.New("report rejected")
+
 // retryPolicy - client config https://github.com/grpc/grpc-go/tree/master/examples/features/retry
 //
 // Config - https://github.com/grpc/proposal/blob/master/A6-client-retries.md
@@ -39,35 +63,196 @@ var retryPolicy = `{
 
 type Client interface {
 	SendReport() error
+	Close() error
 }
 
 type gRPCClient struct {
-	Metrics  *metrics.Metrics
-	Logger   *zap.Logger
-	LocalIP  *net.IP
-	Endpoint string
+	Metrics      *metrics.Metrics
+	Logger       *zap.Logger
+	RSAPublicKey *rsa.PublicKey
+	LocalIP      *net.IP
+	TLSConfig    *tls.Config
+	conn         *grpc.ClientConn
+	stream       pb.MetricsService_StreamUpdatesClient
+	cancel       context.CancelFunc
+	Endpoint     string
+	InstanceID   string
+	AgentID      string
+	// streamSignature is the signature timestamp and nonce of the open stream.
+	streamSignature signature
+	HashKey         []byte
+	SignKey         ed25519.PrivateKey
+	mu              sync.Mutex
+	// unary is set if the server doesn't support StreamUpdates.
+	unary bool
+}
+
+// signature is the timestamp and the nonce of the signed call, the server rejects the call
+// with a stale timestamp or a used nonce.
+type signature struct {
+	timestamp string
+	nonce     string
 }
 
-func NewClient(metrics *metrics.Metrics, localIP *net.IP, endpoint string, logger *zap.Logger) Client {
-	return &gRPCClient{
-		Metrics:  metrics,
-		Logger:   logger,
-		LocalIP:  localIP,
-		Endpoint: endpoint,
+func newSignature() (signature, error) {
+	nonce, err := randkey.RandKey()
+	if err != nil {
+		return signature{}, err
+	}
+
+	return signature{timestamp: strconv.FormatInt(time.Now().Unix(), 10), nonce: nonce}, nil
+}
+
+// Option configures the gRPC client.
+type Option func(c *gRPCClient)
+
+// WithTLSConfig sets the TLS config of the connection to the server.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *gRPCClient) {
+		c.TLSConfig = tlsConfig
 	}
 }
 
+// WithInstanceID sets the ID of the agent instance, the server keeps the cumulative totals
+// of each instance separately.
+func WithInstanceID(instanceID string) Option {
+	return func(c *gRPCClient) {
+		c.InstanceID = instanceID
+	}
+}
+
+// WithSignKey sets the agent ID and the Ed25519 key the requests are signed with,
+// the server checks the signature with the public key of the agent.
+func WithSignKey(agentID string, key ed25519.PrivateKey) Option {
+	return func(c *gRPCClient) {
+		c.AgentID = agentID
+		c.SignKey = key
+	}
+}
+
+func NewClient(metrics *metrics.Metrics, localIP *net.IP, publicKey *rsa.PublicKey,
+	endpoint string, hashKey []byte, logger *zap.Logger, opts ...Option) Client {
+	c := &gRPCClient{
+		Metrics:      metrics,
+		Logger:       logger,
+		RSAPublicKey: publicKey,
+		LocalIP:      localIP,
+		Endpoint:     endpoint,
+		HashKey:      hashKey,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// SendReport sends the collected metrics over the long-lived StreamUpdates stream and waits
+// for the server to acknowledge them. The connection and the stream are opened on the first
+// report and reopened when they break, the report is resent with the same idempotency key,
+// so the server applies it only once. The reports to a server without StreamUpdates
+// are sent with the unary Updates calls.
 func (c *gRPCClient) SendReport() error {
-	conn, err := grpc.Dial(c.Endpoint,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultServiceConfig(retryPolicy),
-	)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		creds := insecure.NewCredentials()
+		if c.TLSConfig != nil {
+			creds = credentials.NewTLS(c.TLSConfig)
+		}
+
+		conn, err := grpc.Dial(c.Endpoint,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithDefaultServiceConfig(retryPolicy),
+		)
+		if err != nil {
+			c.Logger.Info("unable to connect to server", zap.Error(err))
+			return err
+		}
+		c.conn = conn
+	}
+
+	// the report can be resent, so the server applies it only once
+	idempotencyKey, err := randkey.RandKey()
 	if err != nil {
-		c.Logger.Info("unable to connect to server", zap.Error(err))
+		c.Logger.Info("can't generate idempotency key", zap.Error(err))
 		return err
 	}
-	defer conn.Close()
 
+	// the report is sealed for each stream or call, since the hash covers their signature
+	request := &pb.MetricsRequest{Metrics: c.payload(), IdempotencyKey: idempotencyKey}
+
+	if c.unary {
+		return c.sendUnary(request)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = c.sendStream(request)
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, errReportRejected) {
+			c.Logger.Info("report rejected", zap.Error(err))
+			return err
+		}
+
+		c.closeStream()
+
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			c.Logger.Info("server doesn't support streaming, send reports with unary calls")
+			c.unary = true
+			return c.sendUnary(request)
+		case codes.PermissionDenied, codes.Unauthenticated, codes.InvalidArgument:
+			// the server rejects the same report again
+			c.Logger.Info("report rejected", zap.Error(err))
+			return err
+		}
+
+		c.Logger.Info("can't send report over the stream",
+			zap.Int("attempt", attempt),
+			zap.String("code", status.Code(err).String()),
+			zap.Error(err),
+		)
+		if attempt == maxStreamAttempts {
+			return err
+		}
+
+		time.Sleep(time.Duration(attempt) * reconnectBackoff)
+	}
+}
+
+// Close closes the stream and the connection to the server.
+func (c *gRPCClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stream != nil {
+		// the server ends the stream after the sent reports are acknowledged
+		timer := time.AfterFunc(defaultClientTimeout, c.cancel)
+		if err := c.stream.CloseSend(); err == nil {
+			for err == nil {
+				_, err = c.stream.Recv()
+			}
+		}
+		timer.Stop()
+		c.closeStream()
+	}
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+func (c *gRPCClient) payload() []*pb.Metric {
 	payload := make([]*pb.Metric, 0, defaultPayloadCap)
 
 	for key, value := range c.Metrics.PrepareGaugeReport() {
@@ -90,20 +275,169 @@ func (c *gRPCClient) SendReport() error {
 			Mtype: metrics.CounterType,
 			Delta: val,
 			Value: 0,
+			Mode:  metrics.CounterModeCumulative,
 		}
 
 		payload = append(payload, mp)
 	}
 
-	client := pb.NewMetricsServiceClient(conn)
+	return payload
+}
+
+// seal signs the request of the method call with the hash key and the agent key and encrypts it
+// with the public key, if they're set. The hash and the signature are computed before the encryption,
+// so the server checks them after the decryption.
+func (c *gRPCClient) seal(request *pb.MetricsRequest, fullMethod string, sig signature) (*pb.MetricsRequest, error) {
+	if len(c.HashKey) > 0 {
+		sign, err := hash.CallHash(fullMethod, sig.timestamp, sig.nonce, request, c.HashKey)
+		if err != nil {
+			c.Logger.Info("can't get hash sign", zap.Error(err))
+			return nil, err
+		}
+		request.Hash = sign
+	}
+
+	if c.SignKey != nil {
+		body, err := hash.MessageBody(request)
+		if err != nil {
+			c.Logger.Info("can't marshal request", zap.Error(err))
+			return nil, err
+		}
+		request.Signature = signkeys.Sign(c.SignKey, http.MethodPost, fullMethod, sig.timestamp, sig.nonce, body)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultClientTimeout)
-	defer cancel()
+	if c.RSAPublicKey == nil {
+		return request, nil
+	}
 
-	_, err = client.Updates(ctx,
-		&pb.MetricsRequest{Metrics: payload},
+	buf, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		c.Logger.Info("can't marshal request", zap.Error(err))
+		return nil, err
+	}
+
+	encrypted, err := envelope.Seal(c.RSAPublicKey, buf)
+	if err != nil {
+		c.Logger.Info("can't encrypt request", zap.Error(err))
+		return nil, err
+	}
+
+	return &pb.MetricsRequest{Encrypted: encrypted}, nil
+}
+
+// sendStream sends the report over the stream and waits for the acknowledgement,
+// the stream is opened if there isn't one.
+func (c *gRPCClient) sendStream(request *pb.MetricsRequest) error {
+	if c.stream == nil {
+		if err := c.openStream(); err != nil {
+			return err
+		}
+	}
+
+	sealed, err := c.seal(request, pb.MetricsService_StreamUpdates_FullMethodName, c.streamSignature)
+	if err != nil {
+		return err
+	}
+
+	// the stream is canceled if the server doesn't acknowledge the report in time
+	timer := time.AfterFunc(defaultClientTimeout, c.cancel)
+	defer timer.Stop()
+
+	err = c.stream.Send(sealed)
+	if errors.Is(err, io.EOF) {
+		// the stream is closed by the server, Recv returns its status
+		_, err = c.stream.Recv()
+	}
+	if err != nil {
+		return err
+	}
+
+	ack, err := c.stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	if code := codes.Code(ack.Code); code != codes.OK {
+		return fmt.Errorf("%w: %w", errReportRejected, status.Error(code, ack.Message))
+	}
+
+	return nil
+}
+
+func (c *gRPCClient) openStream() error {
+	// the signature is set once for the stream, the server checks it with the first report
+	sig, err := newSignature()
+	if err != nil {
+		c.Logger.Info("can't generate signature nonce", zap.Error(err))
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(c.outgoingMetadata(context.Background(), sig))
+
+	// fails fast if the server is unavailable, the report is resent after a backoff
+	stream, err := pb.NewMetricsServiceClient(c.conn).StreamUpdates(ctx,
 		grpc.UseCompressor(gzip.Name),
+		grpc.WaitForReady(false),
 	)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	c.stream = stream
+	c.cancel = cancel
+	c.streamSignature = sig
+
+	return nil
+}
+
+// outgoingMetadata adds the agent address, the instance ID, the agent ID and the signature
+// to the request metadata.
+func (c *gRPCClient) outgoingMetadata(ctx context.Context, sig signature) context.Context {
+	if len(c.HashKey) > 0 || c.SignKey != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			"x-signature-timestamp", sig.timestamp,
+			"x-signature-nonce", sig.nonce,
+		)
+	}
+	if c.SignKey != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", c.AgentID)
+	}
+	if c.LocalIP != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", c.LocalIP.String())
+	}
+	if c.InstanceID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-instance", c.InstanceID)
+	}
+
+	return ctx
+}
+
+func (c *gRPCClient) closeStream() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.stream = nil
+	c.cancel = nil
+}
+
+func (c *gRPCClient) sendUnary(request *pb.MetricsRequest) error {
+	sig, err := newSignature()
+	if err != nil {
+		c.Logger.Info("can't generate signature nonce", zap.Error(err))
+		return err
+	}
+
+	sealed, err := c.seal(request, pb.MetricsService_Updates_FullMethodName, sig)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.outgoingMetadata(context.Background(), sig), defaultClientTimeout)
+	defer cancel()
+
+	_, err = pb.NewMetricsServiceClient(c.conn).Updates(ctx, sealed, grpc.UseCompressor(gzip.Name))
 	if err != nil {
 		c.Logger.Info("can't send gRPC message",
 			zap.String("code", status.Code(err).String()),
@@ -0,0 +1,252 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/ivas1ly/uwu-metrics/internal/agent/metrics"
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	handlers "github.com/ivas1ly/uwu-metrics/internal/server/handlers/grpc"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkhash"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checksign"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/rsadecrypt"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+)
+
+// unaryServer is a server without StreamUpdates.
+type unaryServer struct {
+	pb.UnimplementedMetricsServiceServer
+	handler *handlers.MetricsgRPCHandler
+}
+
+func (s *unaryServer) Updates(ctx context.Context, in *pb.MetricsRequest) (*emptypb.Empty, error) {
+	return s.handler.Updates(ctx, in)
+}
+
+// startServer serves the handler on the address and counts the opened streams.
+func startServer(t *testing.T, addr string, handler pb.MetricsServiceServer, streams *atomic.Int32,
+	opts ...grpc.ServerOption) (*grpc.Server, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	server := grpc.NewServer(append(opts, grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streams.Add(1)
+		return handler(srv, ss)
+	}))...)
+	pb.RegisterMetricsServiceServer(server, handler)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return server, listener.Addr().String()
+}
+
+func TestClientSendReport(t *testing.T) {
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+	handler := handlers.NewRoutes(metricsService, zap.NewNop())
+
+	pollCount := func(t *testing.T) int64 {
+		t.Helper()
+
+		delta, _, err := metricsService.GetMetric(entity.CounterType, "PollCount", nil)
+		require.NoError(t, err)
+		return *delta
+	}
+
+	t.Run("reports share the stream and it's reopened after reconnect", func(t *testing.T) {
+		var streams atomic.Int32
+		server, addr := startServer(t, "127.0.0.1:0", handler, &streams)
+
+		ms := &metrics.Metrics{}
+		client := NewClient(ms, nil, nil, addr, nil, zap.NewNop())
+		defer client.Close()
+
+		for i := 1; i <= 3; i++ {
+			ms.UpdateMetrics()
+			require.NoError(t, client.SendReport())
+			assert.Equal(t, int64(i), pollCount(t))
+		}
+		assert.Equal(t, int32(1), streams.Load())
+
+		server.Stop()
+		server, _ = startServer(t, addr, handler, &streams)
+		defer server.Stop()
+
+		ms.UpdateMetrics()
+		require.NoError(t, client.SendReport())
+		assert.Equal(t, int64(4), pollCount(t))
+		assert.Equal(t, int32(2), streams.Load())
+	})
+
+	t.Run("server without streaming", func(t *testing.T) {
+		var streams atomic.Int32
+		server, addr := startServer(t, "127.0.0.1:0", &unaryServer{handler: handler}, &streams)
+		defer server.Stop()
+
+		ms := &metrics.Metrics{}
+		ms.PollCount = 10
+		// x-real-ip isn't the source, the agent on the same host continues its running total
+		client := NewClient(ms, &net.IP{127, 0, 0, 2}, nil, addr, nil, zap.NewNop())
+		defer client.Close()
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, client.SendReport())
+		}
+		// the increment of the running total is added once
+		assert.Equal(t, int64(10), pollCount(t))
+		assert.Equal(t, int32(1), streams.Load())
+	})
+
+	t.Run("signed and encrypted reports from trusted subnet", func(t *testing.T) {
+		// the agents set x-real-ip, so the client address is taken from it
+		policy, err := checkip.ParsePolicy(string(checkip.ModeHeader), "127.0.0.0/8", "", "")
+		require.NoError(t, err)
+
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		keyPath := filepath.Join(t.TempDir(), "private_key.pem")
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+		require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+		keyring, err := rsakeys.NewKeyring(keyPath)
+		require.NoError(t, err)
+
+		signedService := service.NewMetricsService(memory.NewMemStorage())
+
+		var streams atomic.Int32
+		server, addr := startServer(t, "127.0.0.1:0", handlers.NewRoutes(signedService, zap.NewNop()), &streams,
+			grpc.ChainStreamInterceptor(
+				checkip.NewStreamInterceptor(zap.NewNop(), policy),
+				rsadecrypt.NewStreamInterceptor(zap.NewNop(), keyring),
+				checkhash.NewStreamInterceptor(zap.NewNop(), []byte("some key"), false, nonce.NewStorage(time.Minute)),
+			),
+		)
+		defer server.Stop()
+
+		ms := &metrics.Metrics{}
+		ms.UpdateMetrics()
+
+		localIP := net.IPv4(127, 0, 0, 1)
+
+		client := NewClient(ms, &localIP, &privateKey.PublicKey, addr, []byte("some key"), zap.NewNop())
+		defer client.Close()
+		require.NoError(t, client.SendReport())
+
+		wrongKey := NewClient(ms, &localIP, &privateKey.PublicKey, addr, []byte("wrong key"), zap.NewNop())
+		defer wrongKey.Close()
+		err = wrongKey.SendReport()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		unsigned := NewClient(ms, &localIP, &privateKey.PublicKey, addr, nil, zap.NewNop())
+		defer unsigned.Close()
+		err = unsigned.SendReport()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		untrusted := NewClient(ms, &net.IP{10, 0, 0, 1}, nil, addr, []byte("some key"), zap.NewNop())
+		defer untrusted.Close()
+		err = untrusted.SendReport()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		wrongPublicKey := NewClient(ms, &localIP, &otherKey.PublicKey, addr, []byte("some key"), zap.NewNop())
+		defer wrongPublicKey.Close()
+		err = wrongPublicKey.SendReport()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		// only the signed report from the trusted subnet is applied
+		delta, _, err := signedService.GetMetric(entity.CounterType, "PollCount", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), *delta)
+	})
+
+	t.Run("reports signed by the agent", func(t *testing.T) {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		registryPath := filepath.Join(t.TempDir(), "agents.json")
+		buf, err := json.Marshal(map[string][]agentkeys.Agent{"agents": {
+			{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(public)},
+		}})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(registryPath, buf, 0o600))
+
+		registry, err := agentkeys.NewRegistry(registryPath)
+		require.NoError(t, err)
+
+		signedService := service.NewMetricsService(memory.NewMemStorage())
+		nonces := nonce.NewStorage(time.Minute)
+
+		var streams atomic.Int32
+		server, addr := startServer(t, "127.0.0.1:0", handlers.NewRoutes(signedService, zap.NewNop()), &streams,
+			grpc.ChainStreamInterceptor(
+				checkhash.NewStreamInterceptor(zap.NewNop(), []byte("some key"), false, nonces),
+				checksign.NewStreamInterceptor(zap.NewNop(), registry, true, nonces),
+			),
+		)
+		defer server.Stop()
+
+		ms := &metrics.Metrics{}
+		ms.UpdateMetrics()
+
+		client := NewClient(ms, nil, nil, addr, []byte("some key"), zap.NewNop(), WithSignKey("web-1", private))
+		defer client.Close()
+		// each report of the stream is signed
+		require.NoError(t, client.SendReport())
+		ms.UpdateMetrics()
+		require.NoError(t, client.SendReport())
+
+		unsigned := NewClient(ms, nil, nil, addr, []byte("some key"), zap.NewNop())
+		defer unsigned.Close()
+		err = unsigned.SendReport()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		wrongKey := NewClient(ms, nil, nil, addr, []byte("some key"), zap.NewNop(), WithSignKey("web-1", otherKey))
+		defer wrongKey.Close()
+		err = wrongKey.SendReport()
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		delta, _, err := signedService.GetMetric(entity.CounterType, "PollCount", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *delta)
+	})
+
+	t.Run("metrics server is not working", func(t *testing.T) {
+		client := NewClient(&metrics.Metrics{}, nil, nil, "127.0.0.1:1", nil, zap.NewNop())
+		defer client.Close()
+
+		assert.Error(t, client.SendReport())
+	})
+}
@@ -4,17 +4,22 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/rand"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/json"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/ivas1ly/uwu-metrics/internal/agent/metrics"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/envelope"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/randkey"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
 )
 
 const (
@@ -36,13 +41,46 @@ type httpClient struct {
 	Logger       *zap.Logger
 	RSAPublicKey *rsa.PublicKey
 	LocalIP      *net.IP
+	HTTPClient   *http.Client
+	SignKey      ed25519.PrivateKey
 	URL          string
+	AgentID      string
+	InstanceID   string
 	HashKey      []byte
 }
 
+// Option configures the HTTP client.
+type Option func(c *httpClient)
+
+// WithTLSConfig sets the TLS config of the connections to the server, the URL must have the https scheme.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *httpClient) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.HTTPClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithSignKey sets the agent ID and the Ed25519 key the requests are signed with,
+// the server checks the signature with the public key of the agent.
+func WithSignKey(agentID string, key ed25519.PrivateKey) Option {
+	return func(c *httpClient) {
+		c.AgentID = agentID
+		c.SignKey = key
+	}
+}
+
+// WithInstanceID sets the ID of the agent instance, the server keeps the cumulative totals
+// of each instance separately.
+func WithInstanceID(instanceID string) Option {
+	return func(c *httpClient) {
+		c.InstanceID = instanceID
+	}
+}
+
 func NewClient(metrics *metrics.Metrics, localIP *net.IP, publicKey *rsa.PublicKey,
-	url string, hashKey []byte, logger *zap.Logger) Client {
-	return &httpClient{
+	url string, hashKey []byte, logger *zap.Logger, opts ...Option) Client {
+	c := &httpClient{
 		Metrics:      metrics,
 		Logger:       logger,
 		RSAPublicKey: publicKey,
@@ -50,6 +88,12 @@ func NewClient(metrics *metrics.Metrics, localIP *net.IP, publicKey *rsa.PublicK
 		URL:          url,
 		HashKey:      hashKey,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 // MetricsPayload structure to convert metrics into JSON format for sending to the server.
@@ -58,11 +102,13 @@ type MetricsPayload struct {
 	Value *float64 `json:"value,omitempty"`
 	ID    string   `json:"id"`
 	MType string   `json:"type"`
+	Mode  string   `json:"mode,omitempty"`
 }
 
 // SendReport prepares and sends metrics to the server.
 // If the metrics cannot be sent, it will retry to send the metrics
 // to the server several more times (3 times in total).
+// All attempts have the same idempotency key, so the server applies the report only once.
 func (c *httpClient) SendReport() error {
 	payload := make([]MetricsPayload, 0, defaultPayloadCap)
 
@@ -86,6 +132,7 @@ func (c *httpClient) SendReport() error {
 			MType: metrics.CounterType,
 			Delta: &val,
 			Value: nil,
+			Mode:  metrics.CounterModeCumulative,
 		}
 
 		payload = append(payload, mp)
@@ -97,8 +144,14 @@ func (c *httpClient) SendReport() error {
 		return err
 	}
 
+	idempotencyKey, err := randkey.RandKey()
+	if err != nil {
+		c.Logger.Info("can't generate idempotency key", zap.Error(err))
+		return err
+	}
+
 	for _, interval := range retryIntervals {
-		err = c.sendRequest(http.MethodPost, body)
+		err = c.sendRequest(http.MethodPost, body, idempotencyKey)
 		if err != nil {
 			c.Logger.Info("can't send request, trying again", zap.Error(err),
 				zap.Duration("with interval", interval))
@@ -115,26 +168,50 @@ func (c *httpClient) SendReport() error {
 	return nil
 }
 
-// sendRequest wrapper method for net/http client.
-func (c *httpClient) sendRequest(method string, body []byte) error {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultClientTimeout)
-	defer cancel()
+// signRequest sets the HashSHA256 header with the hash of the request and the body and
+// the X-Agent-Signature header with the agent signature of them, if the keys are set. The hash
+// and the signature cover the timestamp and the nonce headers, so the server rejects the replays
+// of the request.
+func (c *httpClient) signRequest(req *http.Request, body []byte) {
+	nonce, err := randkey.RandKey()
+	if err != nil {
+		c.Logger.Info("can't generate nonce, skip signature headers", zap.Error(err))
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 
-	var sign string
-	var err error
-	if len(c.HashKey) > 0 {
-		c.Logger.Info("hash key found, set the header with a body hash")
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature-Nonce", nonce)
 
-		if sign, err = hash.Hash(body, c.HashKey); err == nil {
-			c.Logger.Info("hash", zap.String("val", sign))
+	if len(c.HashKey) > 0 {
+		sign, errHash := hash.RequestHash(req.Method, req.URL.RequestURI(), timestamp, nonce, body, c.HashKey)
+		if errHash != nil {
+			c.Logger.Info("can't set hash header, skip header", zap.Error(errHash))
 		} else {
-			c.Logger.Info("can't set hash header, skip header")
+			c.Logger.Info("hash", zap.String("val", sign))
+			req.Header.Set("HashSHA256", sign)
 		}
 	}
 
+	if c.SignKey != nil {
+		req.Header.Set("X-Agent-ID", c.AgentID)
+		req.Header.Set("X-Agent-Signature",
+			signkeys.Sign(c.SignKey, req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+	}
+}
+
+// sendRequest wrapper method for net/http client.
+func (c *httpClient) sendRequest(method string, body []byte, idempotencyKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultClientTimeout)
+	defer cancel()
+
+	// the hash is computed before the encryption, so the server checks it after the decryption
+	plain := body
+
+	var err error
 	var encrypted []byte
 	if c.RSAPublicKey != nil {
-		encrypted, err = rsa.EncryptPKCS1v15(rand.Reader, c.RSAPublicKey, body)
+		encrypted, err = envelope.Seal(c.RSAPublicKey, body)
 		if err != nil {
 			c.Logger.Info("can't encrypt body with RSA public key", zap.Error(err))
 			return err
@@ -166,12 +243,24 @@ func (c *httpClient) sendRequest(method string, body []byte) error {
 		req.Header.Set("X-Real-IP", c.LocalIP.String())
 	}
 	req.Header.Set("Content-Encoding", "gzip")
+	if c.InstanceID != "" {
+		req.Header.Set("X-Agent-Instance", c.InstanceID)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	if len(c.HashKey) > 0 || c.SignKey != nil {
+		c.Logger.Info("hash or sign key found, set the request signature headers")
+		c.signRequest(req, plain)
+	}
 
-	if sign != "" {
-		req.Header.Set("HashSHA256", sign)
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		c.Logger.Info("can't send the HTTP request", zap.Error(err))
 		return err
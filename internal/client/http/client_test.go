@@ -1,21 +1,34 @@
 package http
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	"github.com/ivas1ly/uwu-metrics/internal/agent/metrics"
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
 	handlers "github.com/ivas1ly/uwu-metrics/internal/server/handlers/http"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkhash"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checksign"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/decompress"
 	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
 )
 
 const endpoint = "/updates/"
@@ -69,10 +82,72 @@ func TestClientSendRequest(t *testing.T) {
 	b, err := json.Marshal(&payload)
 	assert.NoError(t, err)
 
-	err = client.sendRequest(http.MethodPost, b)
+	err = client.sendRequest(http.MethodPost, b, "")
 	assert.NoError(t, err)
 }
 
+func TestClientSignedRequest(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	key := []byte("some key")
+
+	var accepted atomic.Int32
+	router := chi.NewRouter()
+	router.Use(decompress.New(logger))
+	router.Use(checkhash.New(logger, key, false, nonce.NewStorage(time.Minute)))
+	router.Post(endpoint, func(w http.ResponseWriter, _ *http.Request) {
+		accepted.Add(1)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := httpClient{
+		Logger:  logger,
+		URL:     ts.URL + endpoint,
+		HashKey: key,
+	}
+
+	// each request has a new nonce, so the same body isn't rejected as a replay
+	for i := 0; i < 2; i++ {
+		require.NoError(t, client.sendRequest(http.MethodPost, []byte(`[]`), ""))
+	}
+	assert.Equal(t, int32(2), accepted.Load())
+}
+
+func TestClientAgentSignature(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	registryPath := filepath.Join(t.TempDir(), "agents.json")
+	registryFile := fmt.Sprintf(`{"agents": [{"id": "web-1", "public_key": %q}]}`,
+		base64.StdEncoding.EncodeToString(publicKey))
+	require.NoError(t, os.WriteFile(registryPath, []byte(registryFile), 0o600))
+
+	registry, err := agentkeys.NewRegistry(registryPath)
+	require.NoError(t, err)
+
+	var agentID atomic.Value
+	router := chi.NewRouter()
+	router.Use(decompress.New(logger))
+	router.Use(checksign.New(logger, registry, true, nonce.NewStorage(time.Minute)))
+	router.Post(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		agentID.Store(checksign.AgentID(r.Context()))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	client := NewClient(nil, nil, nil, ts.URL+endpoint, nil, logger,
+		WithSignKey("web-1", privateKey)).(*httpClient)
+
+	require.NoError(t, client.sendRequest(http.MethodPost, []byte(`[]`), ""))
+	assert.Equal(t, "web-1", agentID.Load())
+}
+
 func TestClientSendReport(t *testing.T) {
 	storage := NewTestStorage()
 	logger := zap.Must(zap.NewDevelopment())
@@ -112,14 +187,16 @@ func TestClientSendReport(t *testing.T) {
 }
 
 type testStorage struct {
-	gauge   map[string]float64
-	counter map[string]int64
+	gauge     map[string]float64
+	counter   map[string]int64
+	histogram map[string]entity.Histogram
 }
 
 func NewTestStorage() memory.Storage {
 	return &testStorage{
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
+		gauge:     make(map[string]float64),
+		counter:   make(map[string]int64),
+		histogram: make(map[string]entity.Histogram),
 	}
 }
 
@@ -131,13 +208,27 @@ func (ts *testStorage) UpdateCounter(name string, value int64) {
 	ts.counter[name] += value
 }
 
+func (ts *testStorage) UpdateHistogram(name string, value entity.Histogram) error {
+	stored, ok := ts.histogram[name]
+	if !ok {
+		ts.histogram[name] = value.Clone()
+		return nil
+	}
+	if err := stored.Merge(value); err != nil {
+		return err
+	}
+	ts.histogram[name] = stored
+	return nil
+}
+
 func (ts *testStorage) GetMetrics() entity.Metrics {
-	return entity.Metrics{Counter: ts.counter, Gauge: ts.gauge}
+	return entity.Metrics{Counter: ts.counter, Gauge: ts.gauge, Histogram: ts.histogram}
 }
 
 func (ts *testStorage) SetMetrics(metrics entity.Metrics) {
 	ts.counter = metrics.Counter
 	ts.gauge = metrics.Gauge
+	ts.histogram = metrics.Histogram
 }
 
 func (ts *testStorage) GetCounter(name string) (int64, error) {
@@ -155,3 +246,15 @@ func (ts *testStorage) GetGauge(name string) (float64, error) {
 	}
 	return gauge, nil
 }
+
+func (ts *testStorage) GetHistogram(name string) (entity.Histogram, error) {
+	histogram, ok := ts.histogram[name]
+	if !ok {
+		return entity.Histogram{}, fmt.Errorf("histogram metric %q doesn't exist", name)
+	}
+	return histogram.Clone(), nil
+}
+
+func (ts *testStorage) Transaction(fn func(tx memory.Tx) error) error {
+	return fn(ts)
+}
@@ -7,8 +7,12 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	handlers "github.com/ivas1ly/uwu-metrics/internal/server/handlers/http"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/flags"
 )
 
@@ -34,32 +38,79 @@ const (
 	defaultPprofAddr            = "localhost:9090"
 	examplePrivateKeyPath       = "./cmd/server/private_key.pem"
 	exampleConfigPathUsage      = "./config/server.json"
-	exampleTrustedSubnet        = ""
+	exampleTrustedSubnet        = "192.168.0.0/16,fd00::/8"
+	exampleDeniedSubnets        = "192.168.66.0/24"
+	exampleTrustedProxies       = "10.0.0.1/32"
+	defaultHistoryRetention     = 1 * time.Hour
+	defaultHistoryResolution    = 10 * time.Second
+	exampleHistogramBuckets     = "0.1,0.5,1,5"
+	defaultIdempotencyWindow    = 5 * time.Minute
+	exampleStatsDPort           = "8125"
+	defaultStatsDFlushInterval  = 10 * time.Second
+	exampleGraphitePort         = "2003"
+	exampleTLSCertPath          = "./certs/server.pem"
+	exampleTLSKeyPath           = "./certs/server-key.pem"
+	exampleTLSClientCAPath      = "./certs/ca.pem"
+	exampleAgentKeysPath        = "./config/agents.json"
 )
 
 const (
-	flagEndpoint        = "a"
-	flaggRPCEndpoint    = "grpc"
-	flagStoreInterval   = "i"
-	flagFileStoragePath = "f"
-	flagFileRestore     = "r"
-	flagDatabaseDSN     = "d"
-	flagHashKey         = "k"
-	flagPrivateKey      = "crypto-key"
-	flagTrustedSubnet   = "t"
+	flagEndpoint          = "a"
+	flaggRPCEndpoint      = "grpc"
+	flagStoreInterval     = "i"
+	flagFileStoragePath   = "f"
+	flagFileRestore       = "r"
+	flagDatabaseDSN       = "d"
+	flagHashKey           = "k"
+	flagHashCompat        = "hash-compat"
+	flagPrivateKey        = "crypto-key"
+	flagTrustedSubnet     = "t"
+	flagDeniedSubnets     = "denied-subnets"
+	flagTrustedProxies    = "trusted-proxies"
+	flagClientIPMode      = "client-ip-mode"
+	flagHistoryRetention  = "history-retention"
+	flagHistoryResolution = "history-resolution"
+	flagHistogramBuckets  = "histogram-buckets"
+	flagIdempotencyWindow = "idempotency-window"
+	flagStatsDEndpoint    = "statsd"
+	flagStatsDFlush       = "statsd-flush-interval"
+	flagGraphiteEndpoint  = "graphite"
+	flagTLSCert           = "tls-cert"
+	flagTLSKey            = "tls-key"
+	flagTLSClientCA       = "tls-client-ca"
+	flagAgentKeys         = "agent-keys"
+	flagAgentSignRequired = "agent-sign-required"
 )
 
 // Config structure contains the received information for running the application.
 type Config struct {
-	Endpoint        string
-	GRPCEndpoint    string
-	FileStoragePath string
-	DatabaseDSN     string
-	HashKey         string
-	PrivateKeyPath  string
-	TrustedSubnet   string
-	StoreInterval   int
-	Restore         bool
+	Endpoint            string
+	GRPCEndpoint        string
+	StatsDEndpoint      string
+	GraphiteEndpoint    string
+	FileStoragePath     string
+	DatabaseDSN         string
+	HashKey             string
+	PrivateKeyPath      string
+	TrustedSubnet       string
+	DeniedSubnets       string
+	TrustedProxies      string
+	ClientIPMode        string
+	TLSCertPath         string
+	TLSKeyPath          string
+	TLSClientCAPath     string
+	AgentKeysPath       string
+	HistogramBuckets    []float64
+	GraphiteMappings    []entity.GraphiteRule
+	InfluxRules         []handlers.InfluxRule
+	HistoryRetention    time.Duration
+	HistoryResolution   time.Duration
+	IdempotencyWindow   time.Duration
+	StatsDFlushInterval time.Duration
+	StoreInterval       int
+	Restore             bool
+	HashCompat          bool
+	AgentSignRequired   bool
 }
 
 // NewConfig creates a new configuration depending on the method.
@@ -69,15 +120,33 @@ func NewConfig() Config {
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 
 	cfg := Config{
-		Endpoint:        net.JoinHostPort(defaultHost, defaultPort),
-		GRPCEndpoint:    net.JoinHostPort(defaultHost, defaultgRPCPort),
-		FileStoragePath: defaultFileStoragePath,
-		DatabaseDSN:     "",
-		HashKey:         "",
-		PrivateKeyPath:  "",
-		StoreInterval:   -1,
-		Restore:         false,
-		TrustedSubnet:   "",
+		Endpoint:            net.JoinHostPort(defaultHost, defaultPort),
+		GRPCEndpoint:        net.JoinHostPort(defaultHost, defaultgRPCPort),
+		FileStoragePath:     defaultFileStoragePath,
+		DatabaseDSN:         "",
+		HashKey:             "",
+		HashCompat:          false,
+		PrivateKeyPath:      "",
+		StoreInterval:       -1,
+		Restore:             false,
+		TrustedSubnet:       "",
+		DeniedSubnets:       "",
+		TrustedProxies:      "",
+		ClientIPMode:        string(checkip.ModePeer),
+		HistoryRetention:    defaultHistoryRetention,
+		HistoryResolution:   defaultHistoryResolution,
+		HistogramBuckets:    nil,
+		IdempotencyWindow:   defaultIdempotencyWindow,
+		StatsDEndpoint:      "",
+		StatsDFlushInterval: defaultStatsDFlushInterval,
+		GraphiteEndpoint:    "",
+		GraphiteMappings:    nil,
+		InfluxRules:         nil,
+		TLSCertPath:         "",
+		TLSKeyPath:          "",
+		TLSClientCAPath:     "",
+		AgentKeysPath:       "",
+		AgentSignRequired:   false,
 	}
 
 	endpointUsage := fmt.Sprintf("HTTP server endpoint, example: %q or %q",
@@ -104,17 +173,84 @@ func NewConfig() Config {
 	databaseDSN := flag.String(flagDatabaseDSN, "", dsnUsage)
 
 	hashKeyUsage := fmt.Sprintf("key for checking the request hash and "+
-		"computing the response body hash, example: %q", exampleKey)
+		"computing the response body hash, the hash is required for the agent writes, example: %q", exampleKey)
 	hashKey := flag.String(flagHashKey, "", hashKeyUsage)
 
-	privateKeyPathUsage := fmt.Sprintf("path to the file with rsa private key, example: %s",
-		examplePrivateKeyPath)
+	hashCompatUsage := "accept the hashes of the body only from the old agents, " +
+		"the requests signed without the timestamp and the nonce can be replayed"
+	hashCompat := flag.Bool(flagHashCompat, false, hashCompatUsage)
+
+	privateKeyPathUsage := fmt.Sprintf("comma-separated paths to the files with rsa private keys or "+
+		"the directories with *.pem files, the agents can use any of the keys, the modified files are loaded "+
+		"without a restart, example: %s", examplePrivateKeyPath)
 	privateKeyPath := flag.String(flagPrivateKey, "", privateKeyPathUsage)
 
-	trustedSubnetUsage := fmt.Sprintf("subnet to verify that the request is from a trusted subnet, example: %s",
-		exampleTrustedSubnet)
+	trustedSubnetUsage := fmt.Sprintf("comma-separated IPv4 and IPv6 subnets the requests are allowed from, "+
+		"example: %q", exampleTrustedSubnet)
 	trustedSubnet := flag.String(flagTrustedSubnet, "", trustedSubnetUsage)
 
+	deniedSubnetsUsage := fmt.Sprintf("comma-separated IPv4 and IPv6 subnets the requests are rejected from, "+
+		"even if they are in the trusted subnets, example: %q", exampleDeniedSubnets)
+	deniedSubnets := flag.String(flagDeniedSubnets, "", deniedSubnetsUsage)
+
+	trustedProxiesUsage := fmt.Sprintf("comma-separated subnets of the proxies that may set the X-Forwarded-For "+
+		"and X-Real-IP headers, the proxies must overwrite the headers sent by the clients, example: %q",
+		exampleTrustedProxies)
+	trustedProxies := flag.String(flagTrustedProxies, "", trustedProxiesUsage)
+
+	clientIPModeUsage := fmt.Sprintf("where the client address for the subnet checks is taken from: %q is "+
+		"the peer address or the forwarding headers of the trusted proxies, %q is the X-Real-IP header "+
+		"set by the agents, which any client can forge", checkip.ModePeer, checkip.ModeHeader)
+	clientIPMode := flag.String(flagClientIPMode, string(checkip.ModePeer), clientIPModeUsage)
+
+	historyRetentionUsage := fmt.Sprintf("how long the metrics history is kept, 0 disables the history, "+
+		"example: %q", defaultHistoryRetention)
+	historyRetention := flag.Duration(flagHistoryRetention, defaultHistoryRetention, historyRetentionUsage)
+
+	historyResolutionUsage := fmt.Sprintf("minimum interval between two points of the metrics history, "+
+		"example: %q", defaultHistoryResolution)
+	historyResolution := flag.Duration(flagHistoryResolution, defaultHistoryResolution, historyResolutionUsage)
+
+	histogramBucketsUsage := fmt.Sprintf("comma-separated upper bounds of the histogram buckets "+
+		"for single observations, example: %q", exampleHistogramBuckets)
+	histogramBuckets := flag.String(flagHistogramBuckets, "", histogramBucketsUsage)
+
+	idempotencyWindowUsage := fmt.Sprintf("how long the idempotency keys of the applied batches are kept, "+
+		"0 disables the deduplication, example: %q", defaultIdempotencyWindow)
+	idempotencyWindow := flag.Duration(flagIdempotencyWindow, defaultIdempotencyWindow, idempotencyWindowUsage)
+
+	statsDEndpointUsage := fmt.Sprintf("StatsD UDP listener endpoint, disabled if empty, example: %q",
+		net.JoinHostPort(defaultHost, exampleStatsDPort))
+	statsDEndpoint := flag.String(flagStatsDEndpoint, "", statsDEndpointUsage)
+
+	statsDFlushUsage := fmt.Sprintf("interval of the StatsD samples aggregation, example: %q",
+		defaultStatsDFlushInterval)
+	statsDFlushInterval := flag.Duration(flagStatsDFlush, defaultStatsDFlushInterval, statsDFlushUsage)
+
+	graphiteEndpointUsage := fmt.Sprintf("Graphite plaintext protocol TCP listener endpoint, disabled if empty, "+
+		"the mapping rules are set in the config file, example: %q", net.JoinHostPort(defaultHost, exampleGraphitePort))
+	graphiteEndpoint := flag.String(flagGraphiteEndpoint, "", graphiteEndpointUsage)
+
+	tlsCertUsage := fmt.Sprintf("path to the file with the TLS certificate of the HTTP and gRPC servers, "+
+		"the servers use TLS if it's set, the file is reloaded when it's modified, example: %s", exampleTLSCertPath)
+	tlsCert := flag.String(flagTLSCert, "", tlsCertUsage)
+
+	tlsKeyUsage := fmt.Sprintf("path to the file with the TLS private key, example: %s", exampleTLSKeyPath)
+	tlsKey := flag.String(flagTLSKey, "", tlsKeyUsage)
+
+	tlsClientCAUsage := fmt.Sprintf("path to the file with the CA of the agent certificates, "+
+		"the agents must present a certificate signed by it if it's set, example: %s", exampleTLSClientCAPath)
+	tlsClientCA := flag.String(flagTLSClientCA, "", tlsClientCAUsage)
+
+	agentKeysUsage := fmt.Sprintf("path to the JSON file with the Ed25519 public keys of the agents, "+
+		"the requests signed by the agents are checked if it's set, the file is reloaded when it's modified, "+
+		"example: %s", exampleAgentKeysPath)
+	agentKeys := flag.String(flagAgentKeys, "", agentKeysUsage)
+
+	agentSignRequiredUsage := "reject the requests that aren't signed by an agent from the agent keys file, " +
+		"except the GET and HEAD requests and the gRPC calls that don't change the metrics"
+	agentSignRequired := flag.Bool(flagAgentSignRequired, false, agentSignRequiredUsage)
+
 	var configPath string
 	configPathUsage := fmt.Sprintf("path to the file with with JSON config, example: %s", exampleConfigPathUsage)
 	flag.StringVar(&configPath, "config", "", configPathUsage)
@@ -152,6 +288,10 @@ func NewConfig() Config {
 		cfg.HashKey = *hashKey
 	}
 
+	if flags.IsFlagPassed(flagHashCompat) {
+		cfg.HashCompat = *hashCompat
+	}
+
 	if flags.IsFlagPassed(flagPrivateKey) {
 		cfg.PrivateKeyPath = *privateKeyPath
 	}
@@ -168,6 +308,71 @@ func NewConfig() Config {
 		cfg.TrustedSubnet = *trustedSubnet
 	}
 
+	if flags.IsFlagPassed(flagDeniedSubnets) {
+		cfg.DeniedSubnets = *deniedSubnets
+	}
+
+	if flags.IsFlagPassed(flagTrustedProxies) {
+		cfg.TrustedProxies = *trustedProxies
+	}
+
+	if flags.IsFlagPassed(flagClientIPMode) {
+		cfg.ClientIPMode = *clientIPMode
+	}
+
+	if flags.IsFlagPassed(flagHistoryRetention) {
+		cfg.HistoryRetention = *historyRetention
+	}
+
+	if flags.IsFlagPassed(flagHistoryResolution) {
+		cfg.HistoryResolution = *historyResolution
+	}
+
+	if flags.IsFlagPassed(flagHistogramBuckets) {
+		buckets, err := parseBuckets(*histogramBuckets)
+		if err != nil {
+			fmt.Printf("can't parse histogram buckets: %s\n", err.Error())
+		} else {
+			cfg.HistogramBuckets = buckets
+		}
+	}
+
+	if flags.IsFlagPassed(flagIdempotencyWindow) {
+		cfg.IdempotencyWindow = *idempotencyWindow
+	}
+
+	if flags.IsFlagPassed(flagStatsDEndpoint) {
+		cfg.StatsDEndpoint = *statsDEndpoint
+	}
+
+	if flags.IsFlagPassed(flagStatsDFlush) && *statsDFlushInterval > 0 {
+		cfg.StatsDFlushInterval = *statsDFlushInterval
+	}
+
+	if flags.IsFlagPassed(flagGraphiteEndpoint) {
+		cfg.GraphiteEndpoint = *graphiteEndpoint
+	}
+
+	if flags.IsFlagPassed(flagTLSCert) {
+		cfg.TLSCertPath = *tlsCert
+	}
+
+	if flags.IsFlagPassed(flagTLSKey) {
+		cfg.TLSKeyPath = *tlsKey
+	}
+
+	if flags.IsFlagPassed(flagTLSClientCA) {
+		cfg.TLSClientCAPath = *tlsClientCA
+	}
+
+	if flags.IsFlagPassed(flagAgentKeys) {
+		cfg.AgentKeysPath = *agentKeys
+	}
+
+	if flags.IsFlagPassed(flagAgentSignRequired) {
+		cfg.AgentSignRequired = *agentSignRequired
+	}
+
 	if endpoint := os.Getenv("ADDRESS"); endpoint != "" {
 		cfg.Endpoint = endpoint
 	}
@@ -176,6 +381,21 @@ func NewConfig() Config {
 		cfg.GRPCEndpoint = gRPCEndpoint
 	}
 
+	if statsDEndpoint := os.Getenv("STATSD_ADDRESS"); statsDEndpoint != "" {
+		cfg.StatsDEndpoint = statsDEndpoint
+	}
+
+	if statsDFlushEnv := os.Getenv("STATSD_FLUSH_INTERVAL"); statsDFlushEnv != "" {
+		envValue, err := time.ParseDuration(statsDFlushEnv)
+		if err == nil && envValue > 0 {
+			cfg.StatsDFlushInterval = envValue
+		}
+	}
+
+	if graphiteEndpoint := os.Getenv("GRAPHITE_ADDRESS"); graphiteEndpoint != "" {
+		cfg.GraphiteEndpoint = graphiteEndpoint
+	}
+
 	// check store interval value
 	if cfg.StoreInterval < 0 {
 		cfg.StoreInterval = defaultStoreInterval
@@ -207,6 +427,13 @@ func NewConfig() Config {
 		cfg.HashKey = hashKeyEnv
 	}
 
+	if hashCompatEnv := os.Getenv("HASH_COMPAT"); hashCompatEnv != "" {
+		envValue, err := strconv.ParseBool(hashCompatEnv)
+		if err == nil {
+			cfg.HashCompat = envValue
+		}
+	}
+
 	if privateKeyPathEnv := os.Getenv("CRYPTO_KEY"); privateKeyPathEnv != "" {
 		cfg.PrivateKeyPath = privateKeyPathEnv
 	}
@@ -215,21 +442,102 @@ func NewConfig() Config {
 		cfg.TrustedSubnet = trustedSubnetEnv
 	}
 
+	if deniedSubnetsEnv := os.Getenv("DENIED_SUBNETS"); deniedSubnetsEnv != "" {
+		cfg.DeniedSubnets = deniedSubnetsEnv
+	}
+
+	if trustedProxiesEnv := os.Getenv("TRUSTED_PROXIES"); trustedProxiesEnv != "" {
+		cfg.TrustedProxies = trustedProxiesEnv
+	}
+
+	if clientIPModeEnv := os.Getenv("CLIENT_IP_MODE"); clientIPModeEnv != "" {
+		cfg.ClientIPMode = clientIPModeEnv
+	}
+
+	if historyRetentionEnv := os.Getenv("HISTORY_RETENTION"); historyRetentionEnv != "" {
+		envValue, err := time.ParseDuration(historyRetentionEnv)
+		if err == nil && envValue >= 0 {
+			cfg.HistoryRetention = envValue
+		}
+	}
+
+	if historyResolutionEnv := os.Getenv("HISTORY_RESOLUTION"); historyResolutionEnv != "" {
+		envValue, err := time.ParseDuration(historyResolutionEnv)
+		if err == nil && envValue > 0 {
+			cfg.HistoryResolution = envValue
+		}
+	}
+
+	if histogramBucketsEnv := os.Getenv("HISTOGRAM_BUCKETS"); histogramBucketsEnv != "" {
+		buckets, err := parseBuckets(histogramBucketsEnv)
+		if err == nil {
+			cfg.HistogramBuckets = buckets
+		}
+	}
+
+	if idempotencyWindowEnv := os.Getenv("IDEMPOTENCY_WINDOW"); idempotencyWindowEnv != "" {
+		envValue, err := time.ParseDuration(idempotencyWindowEnv)
+		if err == nil && envValue >= 0 {
+			cfg.IdempotencyWindow = envValue
+		}
+	}
+
+	if tlsCertEnv := os.Getenv("TLS_CERT"); tlsCertEnv != "" {
+		cfg.TLSCertPath = tlsCertEnv
+	}
+
+	if tlsKeyEnv := os.Getenv("TLS_KEY"); tlsKeyEnv != "" {
+		cfg.TLSKeyPath = tlsKeyEnv
+	}
+
+	if tlsClientCAEnv := os.Getenv("TLS_CLIENT_CA"); tlsClientCAEnv != "" {
+		cfg.TLSClientCAPath = tlsClientCAEnv
+	}
+
+	if agentKeysEnv := os.Getenv("AGENT_KEYS"); agentKeysEnv != "" {
+		cfg.AgentKeysPath = agentKeysEnv
+	}
+
+	if agentSignRequiredEnv := os.Getenv("AGENT_SIGN_REQUIRED"); agentSignRequiredEnv != "" {
+		envValue, err := strconv.ParseBool(agentSignRequiredEnv)
+		if err == nil {
+			cfg.AgentSignRequired = envValue
+		}
+	}
+
 	fmt.Printf("\nstart application with final config: %+v\n\n", cfg)
 
 	return cfg
 }
 
 type FileConfig struct {
-	Address       string `json:"address"`
-	GRPCAddress   string `json:"grpc_address"`
-	StoreFile     string `json:"store_file"`
-	DatabaseDSN   string `json:"database_dsn"`
-	HashKey       string `json:"hash_key"`
-	CryptoKey     string `json:"crypto_key"`
-	StoreInterval string `json:"store_interval"`
-	TrustedSubnet string `json:"trusted_subnet"`
-	Restore       bool   `json:"restore"`
+	Address           string                `json:"address"`
+	GRPCAddress       string                `json:"grpc_address"`
+	StatsDAddress     string                `json:"statsd_address"`
+	StatsDFlush       string                `json:"statsd_flush_interval"`
+	GraphiteAddress   string                `json:"graphite_address"`
+	GraphiteMappings  []entity.GraphiteRule `json:"graphite_mappings"`
+	InfluxRules       []handlers.InfluxRule `json:"influx_rules"`
+	StoreFile         string                `json:"store_file"`
+	DatabaseDSN       string                `json:"database_dsn"`
+	HashKey           string                `json:"hash_key"`
+	CryptoKey         string                `json:"crypto_key"`
+	StoreInterval     string                `json:"store_interval"`
+	TrustedSubnet     string                `json:"trusted_subnet"`
+	DeniedSubnets     string                `json:"denied_subnets"`
+	TrustedProxies    string                `json:"trusted_proxies"`
+	ClientIPMode      string                `json:"client_ip_mode"`
+	TLSCert           string                `json:"tls_cert"`
+	TLSKey            string                `json:"tls_key"`
+	TLSClientCA       string                `json:"tls_client_ca"`
+	AgentKeys         string                `json:"agent_keys"`
+	HistoryRetention  string                `json:"history_retention"`
+	HistoryResolution string                `json:"history_resolution"`
+	IdempotencyWindow string                `json:"idempotency_window"`
+	HistogramBuckets  []float64             `json:"histogram_buckets"`
+	Restore           bool                  `json:"restore"`
+	HashCompat        bool                  `json:"hash_compat"`
+	AgentSignRequired bool                  `json:"agent_sign_required"`
 }
 
 func (c *Config) GetConfigFromFile(filePath string) error {
@@ -246,16 +554,58 @@ func (c *Config) GetConfigFromFile(filePath string) error {
 		return err
 	}
 
+	// the buckets are checked like the flag and env ones, before the file config is applied
+	if len(fileConfig.HistogramBuckets) > 0 {
+		if err = validateBuckets(fileConfig.HistogramBuckets); err != nil {
+			return fmt.Errorf("can't parse histogram buckets: %w", err)
+		}
+	}
+
 	fmt.Printf("config file: %+v\n", fileConfig)
 
 	c.Endpoint = fileConfig.Address
 	c.GRPCEndpoint = fileConfig.GRPCAddress
+	c.StatsDEndpoint = fileConfig.StatsDAddress
+	c.GraphiteEndpoint = fileConfig.GraphiteAddress
+	c.GraphiteMappings = fileConfig.GraphiteMappings
+	c.InfluxRules = fileConfig.InfluxRules
 	c.FileStoragePath = fileConfig.StoreFile
 	c.DatabaseDSN = fileConfig.DatabaseDSN
 	c.HashKey = fileConfig.HashKey
+	c.HashCompat = fileConfig.HashCompat
 	c.PrivateKeyPath = fileConfig.CryptoKey
 	c.Restore = fileConfig.Restore
 	c.TrustedSubnet = fileConfig.TrustedSubnet
+	c.DeniedSubnets = fileConfig.DeniedSubnets
+	c.TrustedProxies = fileConfig.TrustedProxies
+	if fileConfig.ClientIPMode != "" {
+		c.ClientIPMode = fileConfig.ClientIPMode
+	}
+	c.TLSCertPath = fileConfig.TLSCert
+	c.TLSKeyPath = fileConfig.TLSKey
+	c.TLSClientCAPath = fileConfig.TLSClientCA
+	c.AgentKeysPath = fileConfig.AgentKeys
+	c.AgentSignRequired = fileConfig.AgentSignRequired
+
+	if retention, errParse := time.ParseDuration(fileConfig.HistoryRetention); errParse == nil {
+		c.HistoryRetention = retention
+	}
+
+	if resolution, errParse := time.ParseDuration(fileConfig.HistoryResolution); errParse == nil && resolution > 0 {
+		c.HistoryResolution = resolution
+	}
+
+	if window, errParse := time.ParseDuration(fileConfig.IdempotencyWindow); errParse == nil {
+		c.IdempotencyWindow = window
+	}
+
+	if flush, errParse := time.ParseDuration(fileConfig.StatsDFlush); errParse == nil && flush > 0 {
+		c.StatsDFlushInterval = flush
+	}
+
+	if len(fileConfig.HistogramBuckets) > 0 {
+		c.HistogramBuckets = fileConfig.HistogramBuckets
+	}
 
 	seconds, err := time.ParseDuration(fileConfig.StoreInterval)
 	if err != nil {
@@ -268,3 +618,30 @@ func (c *Config) GetConfigFromFile(filePath string) error {
 
 	return err
 }
+
+// parseBuckets parses comma-separated histogram bucket upper bounds.
+func parseBuckets(value string) ([]float64, error) {
+	fields := strings.Split(value, ",")
+	buckets := make([]float64, 0, len(fields))
+
+	for _, field := range fields {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bound)
+	}
+
+	if err := validateBuckets(buckets); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+// validateBuckets checks that the bucket upper bounds are finite and strictly increasing.
+func validateBuckets(buckets []float64) error {
+	histogram := entity.NewHistogram(buckets)
+
+	return histogram.Validate()
+}
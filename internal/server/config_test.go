@@ -2,9 +2,12 @@ package server
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfig(t *testing.T) {
@@ -16,5 +19,45 @@ func TestConfig(t *testing.T) {
 		assert.Equal(t, config.StoreInterval, defaultStoreInterval)
 		assert.Equal(t, config.FileStoragePath, defaultFileStoragePath)
 		assert.Equal(t, config.Restore, defaultFileRestore)
+		assert.Equal(t, config.HistoryRetention, defaultHistoryRetention)
+		assert.Equal(t, config.HistoryResolution, defaultHistoryResolution)
+		assert.Equal(t, config.IdempotencyWindow, defaultIdempotencyWindow)
+		assert.Equal(t, config.StatsDEndpoint, "")
+		assert.Equal(t, config.StatsDFlushInterval, defaultStatsDFlushInterval)
+		assert.Equal(t, config.GraphiteEndpoint, "")
 	})
 }
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := parseBuckets("0.1, 0.5,1,5")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.5, 1, 5}, buckets)
+
+	_, err = parseBuckets("1,0.5")
+	assert.Error(t, err)
+
+	_, err = parseBuckets("1,uwu")
+	assert.Error(t, err)
+}
+
+func TestConfigFileBuckets(t *testing.T) {
+	load := func(t *testing.T, content string) (Config, error) {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+		var cfg Config
+		err := cfg.GetConfigFromFile(path)
+
+		return cfg, err
+	}
+
+	cfg, err := load(t, `{"histogram_buckets":[0.1,0.5,1],"store_interval":"1s"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.5, 1}, cfg.HistogramBuckets)
+
+	cfg, err = load(t, `{"histogram_buckets":[1,0.5],"store_interval":"1s"}`)
+	assert.Error(t, err)
+	assert.Nil(t, cfg.HistogramBuckets)
+}
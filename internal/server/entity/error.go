@@ -1,10 +1,62 @@
 package entity
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	ErrIncorrectMetricValue = errors.New("incorrect metric value")
 	ErrUnknownMetricType    = errors.New("unknown metric type")
 	ErrEmptyMetricValue     = errors.New("empty metric value")
 	ErrCanNotGetMetricValue = errors.New("can't get metric value")
+	ErrHistoryDisabled      = errors.New("metrics history is disabled")
+	ErrIncorrectTimeRange   = errors.New("incorrect time range")
+	ErrIncorrectLabelName   = errors.New("incorrect label name")
+	ErrIncorrectMetricName  = errors.New("incorrect metric name")
+	ErrIncorrectFilter      = errors.New("incorrect filter")
 )
+
+// ErrorMessage returns the message of the metric validation error for the response,
+// the messages of the errors without details have the metric type.
+func ErrorMessage(err error, mType string) string {
+	switch {
+	case errors.Is(err, ErrEmptyMetricValue):
+		return fmt.Sprintf("%s %q", ErrEmptyMetricValue.Error(), mType)
+	case errors.Is(err, ErrUnknownMetricType):
+		return fmt.Sprintf("%s %q", ErrUnknownMetricType.Error(), mType)
+	default:
+		return err.Error()
+	}
+}
+
+// ItemError is the error of a single metric in a batch.
+type ItemError struct {
+	Err   error
+	ID    string
+	MType string
+	Index int
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("metric %d %q: %s", e.Index, e.ID, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError lists the rejected metrics of a batch, if a batch has errors none of its metrics are applied.
+type BatchError struct {
+	Items []*ItemError
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		msgs = append(msgs, item.Error())
+	}
+
+	return fmt.Sprintf("batch rejected: %s", strings.Join(msgs, "; "))
+}
@@ -0,0 +1,15 @@
+package entity
+
+// GraphiteRule maps the dotted Graphite paths matching the pattern to a metric name and labels.
+//
+// Each "*" in Match matches a single path component, the matched components can be used
+// in Name and Labels as $1, $2 and so on. For example, the rule
+//
+//	{"match": "servers.*.cpu.*", "name": "cpu_usage", "labels": {"host": "$1", "cpu": "$2"}}
+//
+// maps "servers.web1.cpu.3" to cpu_usage{cpu="3",host="web1"}.
+type GraphiteRule struct {
+	Labels map[string]string `json:"labels"`
+	Match  string            `json:"match"`
+	Name   string            `json:"name"`
+}
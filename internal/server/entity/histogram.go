@@ -0,0 +1,121 @@
+package entity
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultHistogramBuckets are the upper bounds used for single observations
+// when the server isn't configured with other buckets.
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a bucketed distribution of observed values, bucket counts are not cumulative.
+//
+// Counts[i] is the number of observations v with Bounds[i-1] < v <= Bounds[i],
+// the last element of Counts holds the observations above the last bound (+Inf bucket),
+// so len(Counts) is always len(Bounds)+1.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// NewHistogram creates an empty histogram with the specified bucket upper bounds.
+func NewHistogram(bounds []float64) Histogram {
+	return Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Validate checks that the bounds are sorted and the counts match the bounds.
+// A zero Count is computed from the bucket counts.
+func (h *Histogram) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: histogram has %d bounds and %d bucket counts, want %d counts",
+			ErrIncorrectMetricValue, len(h.Bounds), len(h.Counts), len(h.Bounds)+1)
+	}
+
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("%w: histogram bound %v isn't finite", ErrIncorrectMetricValue, bound)
+		}
+		if i > 0 && h.Bounds[i-1] >= bound {
+			return fmt.Errorf("%w: histogram bounds must be strictly increasing", ErrIncorrectMetricValue)
+		}
+	}
+
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+
+	if h.Count == 0 {
+		h.Count = total
+	}
+	if h.Count != total {
+		return fmt.Errorf("%w: histogram count %d doesn't match the sum of bucket counts %d",
+			ErrIncorrectMetricValue, h.Count, total)
+	}
+
+	return nil
+}
+
+// Observe adds a single value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.ObserveN(value, 1)
+}
+
+// ObserveN adds the value observed n times to the histogram, e.g. a sampled observation.
+func (h *Histogram) ObserveN(value float64, n uint64) {
+	i := 0
+	for i < len(h.Bounds) && value > h.Bounds[i] {
+		i++
+	}
+
+	h.Counts[i] += n
+	h.Sum += value * float64(n)
+	h.Count += n
+}
+
+// Merge adds the bucket counts of another histogram with the same bounds.
+func (h *Histogram) Merge(other Histogram) error {
+	if !h.SameBounds(other) {
+		return fmt.Errorf("%w: histogram bounds %v don't match the stored bounds %v",
+			ErrIncorrectMetricValue, other.Bounds, h.Bounds)
+	}
+
+	for i, count := range other.Counts {
+		h.Counts[i] += count
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+
+	return nil
+}
+
+// SameBounds reports whether both histograms have the same bucket layout.
+func (h *Histogram) SameBounds(other Histogram) bool {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return false
+	}
+
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clone returns a deep copy of the histogram.
+func (h *Histogram) Clone() Histogram {
+	return Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
@@ -0,0 +1,115 @@
+package entity
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidateLabels checks that all label names are valid identifiers.
+// The error also matches ErrIncorrectMetricValue.
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: %w %q", ErrIncorrectMetricValue, ErrIncorrectLabelName, name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateName checks that the metric name doesn't contain the characters used by
+// the label set of the series key, so a name can't collide with a labeled series.
+// The error also matches ErrIncorrectMetricValue.
+func ValidateName(name string) error {
+	if strings.ContainsAny(name, `{}"`) {
+		return fmt.Errorf("%w: %w %q", ErrIncorrectMetricValue, ErrIncorrectMetricName, name)
+	}
+
+	return nil
+}
+
+// ValidateSeries checks the metric name and its labels, see ValidateName and ValidateLabels.
+func ValidateSeries(name string, labels map[string]string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	return ValidateLabels(labels)
+}
+
+// SeriesKey builds the storage key of a metric from its name and labels.
+//
+// A metric without labels is stored by its name, otherwise the sorted labels are appended
+// in the `name{cpu="3",host="a"}` form, so the same label set always produces the same key.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, labelName := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(labelName)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[labelName]))
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// ParseSeriesKey splits the storage key into the metric name and labels.
+// A key that doesn't contain a valid label set is returned as the name.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	start := strings.IndexByte(key, '{')
+	if start <= 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	labels := make(map[string]string)
+	rest := key[start+1 : len(key)-1]
+
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 || !labelNameRegexp.MatchString(rest[:eq]) {
+			return key, nil
+		}
+		labelName := rest[:eq]
+
+		quoted, err := strconv.QuotedPrefix(rest[eq+1:])
+		if err != nil {
+			return key, nil
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return key, nil
+		}
+		labels[labelName] = value
+
+		rest = rest[eq+1+len(quoted):]
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return key, nil
+		}
+		rest = rest[1:]
+	}
+
+	return key[:start], labels
+}
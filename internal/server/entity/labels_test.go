@@ -0,0 +1,72 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		name   string
+		want   string
+	}{
+		{
+			name: "PollCount",
+			want: "PollCount",
+		},
+		{
+			name:   "CPUutilization",
+			labels: map[string]string{"host": "a", "cpu": "3"},
+			want:   `CPUutilization{cpu="3",host="a"}`,
+		},
+		{
+			name:   "requests",
+			labels: map[string]string{"path": `/a,b="c"}`},
+			want:   `requests{path="/a,b=\"c\"}"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			key := SeriesKey(test.name, test.labels)
+			assert.Equal(t, test.want, key)
+
+			name, labels := ParseSeriesKey(key)
+			assert.Equal(t, test.name, name)
+			assert.Equal(t, test.labels, labels)
+		})
+	}
+}
+
+func TestParseSeriesKeyWithoutLabels(t *testing.T) {
+	for _, key := range []string{"uwu{", "{cpu=\"3\"}", "uwu{cpu=3}", "uwu{cpu=\"3\"host=\"a\"}"} {
+		name, labels := ParseSeriesKey(key)
+		assert.Equal(t, key, name)
+		assert.Nil(t, labels)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(nil))
+	assert.NoError(t, ValidateLabels(map[string]string{"_host": "", "cpu0": "3"}))
+
+	err := ValidateLabels(map[string]string{"0cpu": "3"})
+	assert.True(t, errors.Is(err, ErrIncorrectLabelName))
+	assert.True(t, errors.Is(err, ErrIncorrectMetricValue))
+}
+
+func TestValidateSeries(t *testing.T) {
+	assert.NoError(t, ValidateSeries("CPUutilization", map[string]string{"cpu": "3"}))
+
+	for _, name := range []string{`CPUutilization{cpu="3"}`, "uwu{", "uwu}", `uwu"`} {
+		err := ValidateSeries(name, nil)
+		assert.True(t, errors.Is(err, ErrIncorrectMetricName), name)
+		assert.True(t, errors.Is(err, ErrIncorrectMetricValue), name)
+	}
+
+	err := ValidateSeries("CPUutilization", map[string]string{"0cpu": "3"})
+	assert.True(t, errors.Is(err, ErrIncorrectLabelName))
+}
@@ -0,0 +1,33 @@
+package entity
+
+// Sort orders of the metrics list, the "-" prefix reverses the order, e.g. "-name".
+const (
+	SortByName = "name"
+	SortByType = "type"
+)
+
+// MetricFilter selects the metrics by type and name.
+type MetricFilter struct {
+	// MType is the metric type, an empty type matches all of them.
+	MType string
+	// NamePrefix and NameRegexp match the metric name without labels.
+	NamePrefix string
+	NameRegexp string
+}
+
+// ListFilter selects the metrics of the list and sets the page.
+type ListFilter struct {
+	MetricFilter
+	// Sort is the sort order, the default is SortByName.
+	Sort string
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	Limit  int
+}
+
+// MetricsPage is a page of the metrics list.
+type MetricsPage struct {
+	// NextCursor is empty on the last page.
+	NextCursor string
+	Metrics    []*Metric
+}
@@ -1,19 +1,66 @@
 package entity
 
+import "time"
+
 const (
-	CounterType = "counter"
-	GaugeType   = "gauge"
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
 )
 
+// Modes define how the counter delta, the gauge value or the histogram is applied to the stored value.
+const (
+	// CounterModeDelta is the default mode, the delta is added to the stored value.
+	CounterModeDelta = "delta"
+	// CounterModeCumulative means the delta (or the histogram) is the running total of the source,
+	// the increment since its last report is added to the stored value.
+	CounterModeCumulative = "cumulative"
+	// GaugeModeRelative means the gauge value is added to the stored value, a missing gauge starts from zero.
+	GaugeModeRelative = "relative"
+)
+
+// maxInstanceIDLen is the maximum length of the agent instance ID, the longer IDs are ignored.
+const maxInstanceIDLen = 64
+
+// InstanceSource returns the source of the agent instance within the scope, the authenticated
+// identity or the client address. The instance ID is set by the agent, so an agent can only
+// choose between the sources of its own scope. The scope itself is the source of the clients
+// without an instance ID.
+func InstanceSource(scope, instanceID string) string {
+	if instanceID == "" || len(instanceID) > maxInstanceIDLen {
+		return scope
+	}
+
+	return scope + "\n" + instanceID
+}
+
 // Metrics is a structure for temporarily working with metrics.
+// The maps are keyed by the series key, see SeriesKey.
 type Metrics struct {
-	Counter map[string]int64
-	Gauge   map[string]float64
+	Counter   map[string]int64
+	Gauge     map[string]float64
+	Histogram map[string]Histogram `json:",omitempty"`
 }
 
 type Metric struct {
-	Delta *int64
-	Value *float64
-	ID    string
-	MType string
+	Delta     *int64
+	Value     *float64
+	Histogram *Histogram
+	Labels    map[string]string
+	ID        string
+	MType     string
+	// Mode is the counter, gauge or histogram mode, an empty mode is CounterModeDelta
+	// for counters and histograms, the gauge value replaces the stored one.
+	Mode string
+	// Weight is the number of times the histogram observation is counted, zero counts it once.
+	Weight uint64
+	// Source identifies the reporting agent for cumulative counters and histograms.
+	Source string
+}
+
+// HistoryPoint is a metric value at a point in time.
+type HistoryPoint struct {
+	Timestamp time.Time
+	Delta     *int64
+	Value     *float64
 }
@@ -0,0 +1,292 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/writesync"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent"
+)
+
+const (
+	// maxBatchSize limits the number of lines saved at once, a client that keeps sending
+	// doesn't hold the whole input in memory.
+	maxBatchSize = 1000
+	// maxLineSize limits the length of a line, the connection is closed when it's exceeded.
+	maxLineSize = 4096
+)
+
+var (
+	errIncorrectLine = errors.New("incorrect Graphite line")
+	errLineTooLong   = errors.New("too long Graphite line")
+)
+
+type MetricsService interface {
+	UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error)
+}
+
+// Server receives the metrics in the Graphite plaintext protocol over TCP,
+// each line is `metric.path value timestamp`. The values are saved as gauges,
+// the paths are mapped to the metric names and labels by the mapper.
+type Server struct {
+	metricsService MetricsService
+	mapper         *Mapper
+	log            *zap.Logger
+	listener       net.Listener
+	policy         *checkip.Policy
+	storage        persistent.Storage
+	conns          map[net.Conn]struct{}
+	addr           string
+	wg             sync.WaitGroup
+	mu             sync.Mutex
+	closed         bool
+}
+
+// Option configures the Graphite server.
+type Option func(s *Server)
+
+// WithIPPolicy sets the policy of the client addresses, the connections from the addresses
+// that aren't allowed are closed.
+func WithIPPolicy(policy *checkip.Policy) Option {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithWriteSync sets the persistent storage that is saved after each saved batch.
+func WithWriteSync(storage persistent.Storage) Option {
+	return func(s *Server) {
+		s.storage = storage
+	}
+}
+
+// NewServer creates a new Graphite server that listens on the TCP address.
+func NewServer(addr string, mapper *Mapper, metricsService MetricsService, log *zap.Logger,
+	opts ...Option) *Server {
+	s := &Server{
+		metricsService: metricsService,
+		mapper:         mapper,
+		log:            log.With(zap.String("server", "Graphite")),
+		conns:          make(map[net.Conn]struct{}),
+		addr:           addr,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ListenAndServe listens on the TCP address and serves the connections until Shutdown is called,
+// after Shutdown it returns nil.
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve accepts the connections until Shutdown is called.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.log.Info("Graphite server started", zap.String("addr", listener.Addr().String()))
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+
+		if s.policy != nil && !s.policy.PeerAllowed(conn.RemoteAddr()) {
+			s.log.Warn("ip address is not allowed", zap.Stringer("addr", conn.RemoteAddr()))
+			conn.Close()
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// Shutdown stops accepting the connections and interrupts reading from the active ones,
+// the lines read before are saved. It waits for the connections to be closed
+// until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		// unblocks the pending read, the handler saves the batch and closes the connection
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// track registers the active connection, it returns false if the server is closed.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+// handleConn reads the lines until the connection is closed. The lines are saved in batches,
+// a batch is saved when all received data is read or it's full. The connection with a line
+// longer than maxLineSize is closed, the lines read before are saved.
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	l := s.log.With(zap.String("remote addr", conn.RemoteAddr().String()))
+
+	reader := bufio.NewReaderSize(conn, maxLineSize)
+	batch := make([]*entity.Metric, 0, maxBatchSize)
+
+	for {
+		raw, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			err = fmt.Errorf("%w: more than %d bytes", errLineTooLong, maxLineSize)
+		}
+		// the line interrupted by Shutdown may be incomplete, e.g. "cpu 1" instead of "cpu 12"
+		interrupted := err != nil && !errors.Is(err, io.EOF)
+		if line := strings.TrimSpace(string(raw)); line != "" && !interrupted {
+			metric, errParse := s.parseLine(line)
+			if errParse != nil {
+				l.Info("can't parse Graphite line", zap.Error(errParse))
+			} else {
+				batch = append(batch, metric)
+			}
+		}
+
+		if len(batch) > 0 && (err != nil || reader.Buffered() == 0 || len(batch) == maxBatchSize) {
+			s.save(l, batch)
+			batch = batch[:0]
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !s.isClosed() {
+				l.Info("can't read Graphite connection", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+func (s *Server) save(l *zap.Logger, batch []*entity.Metric) {
+	if _, err := s.metricsService.UpsertTypeMetrics(batch); err != nil {
+		l.Info("can't save Graphite metrics", zap.Error(err))
+		return
+	}
+
+	l.Info("Graphite metrics saved", zap.Int("metrics", len(batch)))
+	if s.storage != nil {
+		writesync.Save(context.Background(), s.storage, l)
+	}
+}
+
+// parseLine parses the `metric.path value timestamp` line, the timestamp is optional.
+// The metrics are saved as they are received, so the timestamp is only checked.
+func (s *Server) parseLine(line string) (*entity.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("%w: want path, value and timestamp in %q", errIncorrectLine, line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: incorrect value in %q", errIncorrectLine, line)
+	}
+
+	if len(fields) == 3 {
+		if _, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return nil, fmt.Errorf("%w: incorrect timestamp in %q", errIncorrectLine, line)
+		}
+	}
+
+	name, labels := s.mapper.Map(fields[0])
+
+	return &entity.Metric{
+		Value:  &value,
+		Labels: labels,
+		ID:     name,
+		MType:  entity.GaugeType,
+	}, nil
+}
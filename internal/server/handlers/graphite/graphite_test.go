@@ -0,0 +1,135 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+)
+
+func TestServer(t *testing.T) {
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+
+	mapper, err := NewMapper([]entity.GraphiteRule{
+		{Match: "servers.*.cpu.*", Name: "cpu_usage", Labels: map[string]string{"host": "$1", "cpu": "$2"}},
+	})
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	server := NewServer("", mapper, metricsService, zap.NewNop())
+
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("servers.web1.cpu.0 12.5 1700000000\n" +
+		"servers.web1.cpu.0 13.5 1700000010\n" +
+		"uwu\n" +
+		"servers.web1.load 0.75 1700000010\n" +
+		"servers.web1.disk NaN 1700000010\n"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, _, errGet := metricsService.GetMetric(entity.GaugeType, "servers.web1.load", nil)
+		return errGet == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, cpu, err := metricsService.GetMetric(entity.GaugeType, "cpu_usage",
+		map[string]string{"host": "web1", "cpu": "0"})
+	require.NoError(t, err)
+	assert.Equal(t, 13.5, *cpu)
+
+	_, load, err := metricsService.GetMetric(entity.GaugeType, "servers.web1.load", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.75, *load)
+
+	_, _, err = metricsService.GetMetric(entity.GaugeType, "servers.web1.disk", nil)
+	assert.Error(t, err)
+
+	// the open connection doesn't block the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, server.Shutdown(ctx))
+	require.NoError(t, <-served)
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestServerLimits(t *testing.T) {
+	serve := func(t *testing.T, opts ...Option) (*service.MetricsService, string) {
+		t.Helper()
+
+		metricsService := service.NewMetricsService(memory.NewMemStorage())
+		mapper, err := NewMapper(nil)
+		require.NoError(t, err)
+
+		listener, err := net.Listen("tcp", "localhost:0")
+		require.NoError(t, err)
+
+		server := NewServer("", mapper, metricsService, zap.NewNop(), opts...)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_ = server.Shutdown(ctx)
+		})
+
+		return metricsService, listener.Addr().String()
+	}
+
+	t.Run("too long line", func(t *testing.T) {
+		metricsService, addr := serve(t)
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("servers.web1.load 0.75\n" + strings.Repeat("a", maxLineSize+1)))
+		require.NoError(t, err)
+
+		// the connection is closed without waiting for the end of the line, the unread data resets it
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		require.Error(t, err)
+		assert.False(t, os.IsTimeout(err))
+
+		_, load, err := metricsService.GetMetric(entity.GaugeType, "servers.web1.load", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0.75, *load)
+	})
+
+	t.Run("denied address", func(t *testing.T) {
+		_, addr := serve(t, WithIPPolicy(checkip.DenyAll()))
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
@@ -0,0 +1,158 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// Mapper maps the paths with the first matching rule, a path without a matching rule
+// is used as the metric name.
+type Mapper struct {
+	rules []mappingRule
+}
+
+type mappingRule struct {
+	entity.GraphiteRule
+	parts []string
+}
+
+// NewMapper checks the rules and creates a new mapper.
+func NewMapper(rules []entity.GraphiteRule) (*Mapper, error) {
+	m := &Mapper{
+		rules: make([]mappingRule, 0, len(rules)),
+	}
+
+	for i, rule := range rules {
+		if rule.Match == "" || rule.Name == "" {
+			return nil, fmt.Errorf("graphite mapping rule %d: match and name are required", i)
+		}
+		if err := entity.ValidateLabels(rule.Labels); err != nil {
+			return nil, fmt.Errorf("graphite mapping rule %d: %w", i, err)
+		}
+
+		parts := strings.Split(rule.Match, ".")
+		wildcards := 0
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("graphite mapping rule %d: empty path component in %q", i, rule.Match)
+			}
+			if part == "*" {
+				wildcards++
+			}
+		}
+
+		if err := checkTemplate(rule.Name, wildcards); err != nil {
+			return nil, fmt.Errorf("graphite mapping rule %d: %w", i, err)
+		}
+		for _, value := range rule.Labels {
+			if err := checkTemplate(value, wildcards); err != nil {
+				return nil, fmt.Errorf("graphite mapping rule %d: %w", i, err)
+			}
+		}
+
+		m.rules = append(m.rules, mappingRule{GraphiteRule: rule, parts: parts})
+	}
+
+	return m, nil
+}
+
+// Map returns the metric name and labels of the path.
+func (m *Mapper) Map(path string) (string, map[string]string) {
+	parts := strings.Split(path, ".")
+
+	for _, rule := range m.rules {
+		captures, ok := rule.match(parts)
+		if !ok {
+			continue
+		}
+
+		labels := make(map[string]string, len(rule.Labels))
+		for name, value := range rule.Labels {
+			labels[name] = expand(value, captures)
+		}
+
+		return expand(rule.Name, captures), labels
+	}
+
+	return path, nil
+}
+
+func (r *mappingRule) match(parts []string) ([]string, bool) {
+	if len(parts) != len(r.parts) {
+		return nil, false
+	}
+
+	var captures []string
+	for i, part := range r.parts {
+		switch {
+		case part == "*" && parts[i] != "":
+			captures = append(captures, parts[i])
+		case part != parts[i]:
+			return nil, false
+		}
+	}
+
+	return captures, true
+}
+
+var errIncorrectTemplate = errors.New("incorrect template")
+
+// checkTemplate checks that all $n references of the template point to a wildcard.
+func checkTemplate(template string, wildcards int) error {
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			continue
+		}
+
+		n, width := reference(template[i+1:])
+		if width == 0 || n < 1 || n > wildcards {
+			return fmt.Errorf("%w %q: the rule has %d wildcards", errIncorrectTemplate, template, wildcards)
+		}
+		i += width
+	}
+
+	return nil
+}
+
+// expand replaces the $n references with the matched path components.
+func expand(template string, captures []string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			sb.WriteByte(template[i])
+			continue
+		}
+
+		n, width := reference(template[i+1:])
+		sb.WriteString(captures[n-1])
+		i += width
+	}
+
+	return sb.String()
+}
+
+// reference parses the number after $ and returns it with its width.
+func reference(s string) (int, int) {
+	width := 0
+	for width < len(s) && s[width] >= '0' && s[width] <= '9' {
+		width++
+	}
+	if width == 0 {
+		return 0, 0
+	}
+
+	n, err := strconv.Atoi(s[:width])
+	if err != nil {
+		return 0, 0
+	}
+
+	return n, width
+}
@@ -0,0 +1,79 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+func TestMapper(t *testing.T) {
+	mapper, err := NewMapper([]entity.GraphiteRule{
+		{Match: "servers.*.cpu.*", Name: "cpu_usage", Labels: map[string]string{"host": "$1", "cpu": "$2"}},
+		{Match: "servers.*.*", Name: "$2", Labels: map[string]string{"host": "$1"}},
+		{Match: "apps.*.requests", Name: "requests_$1_total"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		wantLabels map[string]string
+		path       string
+		wantName   string
+	}{
+		{
+			path:       "servers.web1.cpu.3",
+			wantName:   "cpu_usage",
+			wantLabels: map[string]string{"host": "web1", "cpu": "3"},
+		},
+		{
+			path:       "servers.web1.load",
+			wantName:   "load",
+			wantLabels: map[string]string{"host": "web1"},
+		},
+		{
+			path:       "apps.checkout.requests",
+			wantName:   "requests_checkout_total",
+			wantLabels: map[string]string{},
+		},
+		{
+			path:     "servers.web1.cpu.3.user",
+			wantName: "servers.web1.cpu.3.user",
+		},
+		{
+			path:     "servers..load",
+			wantName: "servers..load",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			name, labels := mapper.Map(test.path)
+			assert.Equal(t, test.wantName, name)
+			assert.Equal(t, test.wantLabels, labels)
+		})
+	}
+}
+
+func TestNewMapperErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule entity.GraphiteRule
+	}{
+		{name: "no match", rule: entity.GraphiteRule{Name: "cpu"}},
+		{name: "no name", rule: entity.GraphiteRule{Match: "servers.*"}},
+		{name: "empty component", rule: entity.GraphiteRule{Match: "servers..cpu", Name: "cpu"}},
+		{name: "reference without wildcard", rule: entity.GraphiteRule{Match: "servers.*", Name: "$2"}},
+		{name: "bad reference", rule: entity.GraphiteRule{Match: "servers.*", Name: "cpu_$"}},
+		{name: "incorrect label name", rule: entity.GraphiteRule{Match: "servers.*", Name: "cpu",
+			Labels: map[string]string{"host-name": "$1"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewMapper([]entity.GraphiteRule{test.rule})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -4,68 +4,481 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checksign"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/tlsconfig"
 	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// instanceKey is the request metadata with the agent instance ID.
+const instanceKey = "x-agent-instance"
+
 type MetricsService interface {
-	UpsertMetric(mType, mName, mValue string) error
-	GetMetric(mType, mName string) (*int64, *float64, error)
+	UpsertMetric(mType, mName, mValue string, labels map[string]string) error
+	GetMetric(mType, mName string, labels map[string]string) (*int64, *float64, error)
 	GetAllMetrics() entity.Metrics
 	UpsertTypeMetric(metric *entity.Metric) (*entity.Metric, error)
+	UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error)
+	GetHistory(mType, mName string, labels map[string]string, from, to time.Time,
+		step time.Duration) ([]entity.HistoryPoint, error)
+	GetHistogram(mName string, labels map[string]string) (*entity.Histogram, error)
+	ListMetrics(filter entity.ListFilter) (*entity.MetricsPage, error)
+	Watch(ctx context.Context, filter entity.MetricFilter) (<-chan *entity.Metric, error)
 }
 
 type MetricsgRPCHandler struct {
 	pb.UnimplementedMetricsServiceServer
-	metricsService MetricsService
-	log            *zap.Logger
+	metricsService    MetricsService
+	log               *zap.Logger
+	batchInterceptors []grpc.UnaryServerInterceptor
+}
+
+// Option configures optional handler settings.
+type Option func(h *MetricsgRPCHandler)
+
+// WithBatchInterceptors sets the unary interceptors that are applied to each batch
+// of StreamUpdates as if it were an Updates call, e.g. the idempotency and write sync ones.
+func WithBatchInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(h *MetricsgRPCHandler) {
+		h.batchInterceptors = interceptors
+	}
 }
 
-func NewRoutes(metricsService MetricsService, log *zap.Logger) *MetricsgRPCHandler {
+func NewRoutes(metricsService MetricsService, log *zap.Logger, opts ...Option) *MetricsgRPCHandler {
 	h := &MetricsgRPCHandler{
 		metricsService: metricsService,
 		log:            log.With(zap.String("gRPC handler", "metrics")),
 	}
 
+	for _, opt := range opts {
+		opt(h)
+	}
+
 	return h
 }
 
-func (h *MetricsgRPCHandler) Updates(_ context.Context, in *pb.MetricsRequest) (*emptypb.Empty, error) {
-	for _, metric := range in.Metrics {
+// Update saves the metric and returns its current stored value.
+func (h *MetricsgRPCHandler) Update(ctx context.Context, in *pb.Metric) (*pb.Metric, error) {
+	if errMsg, ok := checkRequestFields(in); !ok {
+		return nil, status.Error(codes.InvalidArgument, strings.Join(errMsg, ", "))
+	}
+
+	upserted, err := h.metricsService.UpsertTypeMetric(metricFromPb(in, RequestSource(ctx)))
+	switch {
+	case errors.Is(err, entity.ErrCanNotGetMetricValue):
+		h.log.Info("can't get updated value", zap.String("type", in.Mtype), zap.String("name", in.Id))
+		return nil, status.Error(codes.Internal, "can't get updated value")
+	case errors.Is(err, entity.ErrIncorrectMetricValue), errors.Is(err, entity.ErrEmptyMetricValue),
+		errors.Is(err, entity.ErrUnknownMetricType), errors.Is(err, entity.ErrIncorrectLabelName),
+		errors.Is(err, entity.ErrIncorrectMetricName):
+		h.log.Info("metric rejected", zap.String("type", in.Mtype), zap.String("name", in.Id), zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, entity.ErrorMessage(err, in.Mtype))
+	case err != nil:
+		h.log.Info("can't save metric", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't save metric")
+	}
+
+	h.log.Info("metric saved", zap.String("type", in.Mtype), zap.String("name", in.Id))
+
+	return metricToPb(upserted), nil
+}
+
+// Updates applies the batch of metrics all-or-nothing. If any metric is rejected, none of them
+// are saved and the InvalidArgument status has the errors of all rejected metrics in
+// the BadRequest details, the field of a violation is the index of the metric, e.g. "metrics[3]".
+func (h *MetricsgRPCHandler) Updates(ctx context.Context, in *pb.MetricsRequest) (*emptypb.Empty, error) {
+	source := RequestSource(ctx)
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	batch := make([]*entity.Metric, 0, len(in.Metrics))
+	for i, metric := range in.Metrics {
 		errMsg, ok := checkRequestFields(metric)
 		if !ok {
-			return nil, status.Error(codes.InvalidArgument, strings.Join(errMsg, ", "))
+			violations = append(violations, fieldViolation(i, strings.Join(errMsg, ", ")))
+			continue
+		}
+
+		batch = append(batch, metricFromPb(metric, source))
+	}
+
+	if len(violations) == 0 {
+		_, err := h.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			for _, item := range batchErr.Items {
+				violations = append(violations, fieldViolation(item.Index, entity.ErrorMessage(item.Err, item.MType)))
+			}
+		} else if err != nil {
+			h.log.Info("can't apply batch", zap.Error(err))
+			return nil, status.Error(codes.Internal, "can't apply batch")
+		}
+	}
+
+	if len(violations) > 0 {
+		h.log.Info("batch rejected", zap.Int("rejected", len(violations)), zap.Int("total", len(in.Metrics)))
+
+		st, err := status.New(codes.InvalidArgument, violations[0].Description).
+			WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, violations[0].Description)
+		}
+		return nil, st.Err()
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// StreamUpdates applies the batches received over the stream until the client closes it.
+// Each batch is applied as an Updates call and acknowledged with its status, a rejected
+// batch doesn't close the stream.
+func (h *MetricsgRPCHandler) StreamUpdates(stream pb.MetricsService_StreamUpdatesServer) error {
+	ctx := stream.Context()
+	apply := h.batchHandler()
+
+	for sequence := uint64(1); ; sequence++ {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &pb.UpdatesAck{Sequence: sequence}
+		if _, err = apply(ctx, in); err != nil {
+			st := status.Convert(err)
+			ack.Code = int32(st.Code())
+			ack.Message = st.Message()
+		}
+
+		if err = stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// batchHandler chains the batch interceptors with the Updates handler.
+func (h *MetricsgRPCHandler) batchHandler() grpc.UnaryHandler {
+	info := &grpc.UnaryServerInfo{
+		Server:     h,
+		FullMethod: pb.MetricsService_StreamUpdates_FullMethodName,
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return h.Updates(ctx, req.(*pb.MetricsRequest))
+	}
+
+	for i := len(h.batchInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := h.batchInterceptors[i], handler
+		handler = func(ctx context.Context, req any) (any, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+
+	return handler
+}
+
+// Value gets the metric by its type, name and labels, a missing metric is reported
+// with the NotFound status.
+func (h *MetricsgRPCHandler) Value(_ context.Context, in *pb.ValueRequest) (*pb.Metric, error) {
+	if strings.TrimSpace(in.Id) == "" || strings.TrimSpace(in.Mtype) == "" {
+		return nil, status.Error(codes.InvalidArgument, "fields \"id\" and \"type\" are required")
+	}
+
+	metric := &entity.Metric{
+		Labels: in.Labels,
+		ID:     in.Id,
+		MType:  in.Mtype,
+	}
+
+	var err error
+	if in.Mtype == entity.HistogramType {
+		metric.Histogram, err = h.metricsService.GetHistogram(in.Id, in.Labels)
+	} else {
+		metric.Delta, metric.Value, err = h.metricsService.GetMetric(in.Mtype, in.Id, in.Labels)
+	}
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, entity.ErrUnknownMetricType) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s %q", entity.ErrUnknownMetricType.Error(), in.Mtype)
+	}
+	if errors.Is(err, entity.ErrCanNotGetMetricValue) {
+		h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		h.log.Info("can't get metric", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't get metric")
+	}
+
+	return metricToPb(metric), nil
+}
+
+func (h *MetricsgRPCHandler) History(_ context.Context, in *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	if strings.TrimSpace(in.Id) == "" || strings.TrimSpace(in.Mtype) == "" {
+		return nil, status.Error(codes.InvalidArgument, "fields \"id\" and \"type\" are required")
+	}
+
+	var from, to time.Time
+	var step time.Duration
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+	if in.To != nil {
+		to = in.To.AsTime()
+	}
+	if in.Step != nil {
+		step = in.Step.AsDuration()
+	}
+
+	points, err := h.metricsService.GetHistory(in.Mtype, in.Id, in.Labels, from, to, step)
+	if errors.Is(err, entity.ErrHistoryDisabled) {
+		return nil, status.Error(codes.Unimplemented, entity.ErrHistoryDisabled.Error())
+	}
+	if errors.Is(err, entity.ErrUnknownMetricType) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s %q", entity.ErrUnknownMetricType.Error(), in.Mtype)
+	}
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, entity.ErrIncorrectTimeRange) {
+		return nil, status.Error(codes.InvalidArgument, entity.ErrIncorrectTimeRange.Error())
+	}
+	if errors.Is(err, entity.ErrCanNotGetMetricValue) {
+		h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	resp := &pb.HistoryResponse{
+		Id:     in.Id,
+		Mtype:  in.Mtype,
+		Labels: in.Labels,
+		Points: make([]*pb.HistoryPoint, 0, len(points)),
+	}
+	for _, point := range points {
+		hp := &pb.HistoryPoint{Timestamp: timestamppb.New(point.Timestamp)}
+		if point.Delta != nil {
+			hp.Delta = *point.Delta
+		}
+		if point.Value != nil {
+			hp.Value = *point.Value
+		}
+		resp.Points = append(resp.Points, hp)
+	}
+
+	return resp, nil
+}
+
+// List returns a page of the metrics matching the filters of the request, a bad filter
+// or cursor is reported with the InvalidArgument status.
+func (h *MetricsgRPCHandler) List(_ context.Context, in *pb.ListRequest) (*pb.ListResponse, error) {
+	page, err := h.metricsService.ListMetrics(entity.ListFilter{
+		MetricFilter: entity.MetricFilter{
+			MType:      in.Mtype,
+			NamePrefix: in.Prefix,
+			NameRegexp: in.Regex,
+		},
+		Sort:   in.Sort,
+		Cursor: in.Cursor,
+		Limit:  int(in.Limit),
+	})
+	if errors.Is(err, entity.ErrIncorrectFilter) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		h.log.Info("can't list metrics", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't list metrics")
+	}
+
+	resp := &pb.ListResponse{
+		Metrics:    make([]*pb.Metric, 0, len(page.Metrics)),
+		NextCursor: page.NextCursor,
+	}
+	for _, metric := range page.Metrics {
+		resp.Metrics = append(resp.Metrics, metricToPb(metric))
+	}
+
+	return resp, nil
+}
+
+// Watch streams the metric updates matching the filters of the request until the client
+// cancels the call. A client that doesn't keep up with the updates gets the ResourceExhausted status.
+func (h *MetricsgRPCHandler) Watch(in *pb.WatchRequest, stream pb.MetricsService_WatchServer) error {
+	ctx := stream.Context()
+
+	updates, err := h.metricsService.Watch(ctx, entity.MetricFilter{
+		MType:      in.Mtype,
+		NamePrefix: in.Prefix,
+		NameRegexp: in.Regex,
+	})
+	if errors.Is(err, entity.ErrIncorrectFilter) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		h.log.Info("can't watch metrics", zap.Error(err))
+		return status.Error(codes.Internal, "can't watch metrics")
+	}
+
+	h.log.Info("watcher connected", zap.String("source", RequestSource(ctx)))
+
+	for metric := range updates {
+		if err = stream.Send(metricToPb(metric)); err != nil {
+			return err
 		}
+	}
 
-		_, err := h.metricsService.UpsertTypeMetric(&entity.Metric{
-			Delta: &metric.Delta,
-			Value: &metric.Value,
-			ID:    metric.Id,
-			MType: metric.Mtype,
-		})
-		if errors.Is(err, entity.ErrEmptyMetricValue) {
-			h.log.Info(entity.ErrEmptyMetricValue.Error(), zap.String("type", metric.Mtype))
-			return nil, status.Errorf(codes.InvalidArgument, "%s %q",
-				entity.ErrEmptyMetricValue.Error(), metric.Mtype)
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	h.log.Info("watcher dropped, it's too slow", zap.String("source", RequestSource(ctx)))
+	return status.Error(codes.ResourceExhausted, "watcher fell behind the updates")
+}
+
+// RequestSource identifies the agent instance that sent the request by the x-agent-instance metadata
+// within the scope of its client certificate or the client address. The scope isn't set by the client,
+// so a client can't pose as another agent and reset the cumulative totals of its counters, and the agents
+// sharing an address have the separate totals.
+func RequestSource(ctx context.Context) string {
+	var instanceID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(instanceKey); len(values) > 0 {
+			instanceID = values[0]
 		}
-		if errors.Is(err, entity.ErrUnknownMetricType) {
-			h.log.Info(entity.ErrUnknownMetricType.Error(), zap.String("type", metric.Mtype))
-			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("%s %q",
-				entity.ErrEmptyMetricValue.Error(), metric.Mtype))
+	}
+
+	return entity.InstanceSource(requestScope(ctx), instanceID)
+}
+
+// requestScope returns the agent ID of the signature, the identity of the client certificate
+// or the client address allowed by the address policy, if it's checked, or the peer address.
+func requestScope(ctx context.Context) string {
+	if agentID := checksign.AgentID(ctx); agentID != "" {
+		return agentID
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if tlsInfo, isTLS := p.AuthInfo.(credentials.TLSInfo); isTLS {
+		if identity := tlsconfig.Identity(&tlsInfo.State); identity != "" {
+			return identity
 		}
-		if errors.Is(err, entity.ErrCanNotGetMetricValue) {
-			h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.String("type", metric.Mtype), zap.String("name", metric.Id))
-			return nil, status.Error(codes.Internal, "")
+	}
+
+	if ip := checkip.RequestIP(ctx); ip != nil {
+		return ip.String()
+	}
+
+	if p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func fieldViolation(index int, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       fmt.Sprintf("metrics[%d]", index),
+		Description: description,
+	}
+}
+
+// metricFromPb converts the metric of the version 1 API. Its value fields can't be missing,
+// so only the field of the metric type is used, a histogram without buckets is a single observation.
+func metricFromPb(metric *pb.Metric, source string) *entity.Metric {
+	m := &entity.Metric{
+		Labels: metric.Labels,
+		ID:     metric.Id,
+		MType:  metric.Mtype,
+		Mode:   metric.Mode,
+		Source: source,
+	}
+
+	switch metric.Mtype {
+	case entity.CounterType:
+		delta := metric.Delta
+		m.Delta = &delta
+	case entity.GaugeType:
+		value := metric.Value
+		m.Value = &value
+	case entity.HistogramType:
+		m.Histogram = histogramFromPb(metric.Histogram)
+		if m.Histogram == nil {
+			value := metric.Value
+			m.Value = &value
 		}
 	}
 
-	return nil, nil
+	return m
+}
+
+func metricToPb(metric *entity.Metric) *pb.Metric {
+	m := &pb.Metric{
+		Histogram: histogramToPb(metric.Histogram),
+		Labels:    metric.Labels,
+		Id:        metric.ID,
+		Mtype:     metric.MType,
+	}
+	if metric.Delta != nil {
+		m.Delta = *metric.Delta
+	}
+	if metric.Value != nil {
+		m.Value = *metric.Value
+	}
+
+	return m
+}
+
+func histogramFromPb(histogram *pb.Histogram) *entity.Histogram {
+	if histogram == nil {
+		return nil
+	}
+
+	return &entity.Histogram{
+		Bounds: histogram.Bounds,
+		Counts: histogram.Counts,
+		Sum:    histogram.Sum,
+		Count:  histogram.Count,
+	}
+}
+
+func histogramToPb(histogram *entity.Histogram) *pb.Histogram {
+	if histogram == nil {
+		return nil
+	}
+
+	return &pb.Histogram{
+		Bounds: histogram.Bounds,
+		Counts: histogram.Counts,
+		Sum:    histogram.Sum,
+		Count:  histogram.Count,
+	}
 }
 
 // checkRequestFields method for simple validation of query values.
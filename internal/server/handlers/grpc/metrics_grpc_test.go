@@ -0,0 +1,291 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+	pbv2 "github.com/ivas1ly/uwu-metrics/pkg/api/metrics/v2"
+)
+
+func TestUpdateValueList(t *testing.T) {
+	ctx := context.Background()
+	h := NewRoutes(service.NewMetricsService(memory.NewMemStorage()), zap.NewNop())
+
+	labels := map[string]string{"cpu": "0"}
+
+	t.Run("update and value", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			res, err := h.Update(ctx, &pb.Metric{Id: "PollCount", Mtype: entity.CounterType, Delta: 5})
+			require.NoError(t, err)
+			assert.Equal(t, int64(5*(i+1)), res.Delta)
+		}
+
+		_, err := h.Update(ctx, &pb.Metric{Id: "CPUutilization", Mtype: entity.GaugeType, Value: 12.5, Labels: labels})
+		require.NoError(t, err)
+
+		res, err := h.Value(ctx, &pb.ValueRequest{Id: "CPUutilization", Mtype: entity.GaugeType, Labels: labels})
+		require.NoError(t, err)
+		assert.Equal(t, 12.5, res.Value)
+		assert.Equal(t, labels, res.Labels)
+
+		_, err = h.Update(ctx, &pb.Metric{Id: "RequestDuration", Mtype: entity.HistogramType, Value: 0.2})
+		require.NoError(t, err)
+
+		res, err = h.Value(ctx, &pb.ValueRequest{Id: "RequestDuration", Mtype: entity.HistogramType})
+		require.NoError(t, err)
+		require.NotNil(t, res.Histogram)
+		assert.Equal(t, uint64(1), res.Histogram.Count)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			call func() error
+			name string
+			code codes.Code
+		}{
+			{
+				name: "update without type",
+				call: func() error {
+					_, err := h.Update(ctx, &pb.Metric{Id: "PollCount"})
+					return err
+				},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "update with unknown type",
+				call: func() error {
+					_, err := h.Update(ctx, &pb.Metric{Id: "PollCount", Mtype: "summary"})
+					return err
+				},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "update with incorrect label",
+				call: func() error {
+					_, err := h.Update(ctx, &pb.Metric{Id: "Alloc", Mtype: entity.GaugeType, Labels: map[string]string{"1cpu": "0"}})
+					return err
+				},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "missing value",
+				call: func() error {
+					_, err := h.Value(ctx, &pb.ValueRequest{Id: "CPUutilization", Mtype: entity.GaugeType})
+					return err
+				},
+				code: codes.NotFound,
+			},
+			{
+				name: "value with unknown type",
+				call: func() error {
+					_, err := h.Value(ctx, &pb.ValueRequest{Id: "PollCount", Mtype: "summary"})
+					return err
+				},
+				code: codes.InvalidArgument,
+			},
+			{
+				name: "list with incorrect regex",
+				call: func() error {
+					_, err := h.List(ctx, &pb.ListRequest{Regex: "("})
+					return err
+				},
+				code: codes.InvalidArgument,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.code, status.Code(tt.call()))
+			})
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		res, err := h.List(ctx, &pb.ListRequest{Sort: "-" + entity.SortByType, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, res.Metrics, 2)
+		assert.Equal(t, "RequestDuration", res.Metrics[0].Id)
+		assert.Equal(t, "CPUutilization", res.Metrics[1].Id)
+		require.NotEmpty(t, res.NextCursor)
+
+		res, err = h.List(ctx, &pb.ListRequest{Sort: "-" + entity.SortByType, Limit: 2, Cursor: res.NextCursor})
+		require.NoError(t, err)
+		require.Len(t, res.Metrics, 1)
+		assert.Equal(t, "PollCount", res.Metrics[0].Id)
+		assert.Equal(t, int64(10), res.Metrics[0].Delta)
+		assert.Empty(t, res.NextCursor)
+	})
+}
+
+// watchStream is the server side of the Watch stream, Send signals the sending
+// and blocks until the unblock channel is closed.
+type watchStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	sending chan struct{}
+	unblock chan struct{}
+	sent    []*pb.Metric
+}
+
+func newWatchStream(ctx context.Context) *watchStream {
+	return &watchStream{
+		ctx:     ctx,
+		sending: make(chan struct{}, 1),
+		unblock: make(chan struct{}),
+	}
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(metric *pb.Metric) error {
+	select {
+	case s.sending <- struct{}{}:
+	default:
+	}
+	<-s.unblock
+
+	s.sent = append(s.sent, metric)
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+	h := NewRoutes(metricsService, zap.NewNop())
+
+	t.Run("client cancels the call", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := newWatchStream(ctx)
+
+		done := make(chan error)
+		go func() {
+			done <- h.Watch(&pb.WatchRequest{Mtype: entity.CounterType}, stream)
+		}()
+
+		cancel()
+
+		select {
+		case err := <-done:
+			assert.Equal(t, codes.Canceled, status.Code(err))
+		case <-time.After(time.Second):
+			t.Fatal("Watch didn't return after the call was canceled")
+		}
+	})
+
+	t.Run("slow client is dropped", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream := newWatchStream(ctx)
+
+		done := make(chan error)
+		go func() {
+			done <- h.Watch(&pb.WatchRequest{Prefix: "Gauge"}, stream)
+		}()
+
+		update := func(name string) {
+			_, err := h.Update(ctx, &pb.Metric{Id: name, Mtype: entity.GaugeType, Value: 1})
+			require.NoError(t, err)
+		}
+
+		// the client gets stuck on the first update it receives
+		require.Eventually(t, func() bool {
+			update("Gauge")
+			select {
+			case <-stream.sending:
+				return true
+			default:
+				return false
+			}
+		}, time.Second, 10*time.Millisecond)
+
+		// the ingestion isn't blocked by the stuck client
+		for i := 0; i < 1000; i++ {
+			update(fmt.Sprintf("Gauge%d", i))
+		}
+
+		close(stream.unblock)
+
+		select {
+		case err := <-done:
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+			assert.NotEmpty(t, stream.sent)
+		case <-time.After(time.Second):
+			t.Fatal("Watch didn't return after the client was dropped")
+		}
+	})
+}
+
+func TestUpdatesV2(t *testing.T) {
+	ctx := context.Background()
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+	h := NewRoutesV2(metricsService, zap.NewNop())
+
+	_, err := metricsService.UpsertTypeMetric(&entity.Metric{
+		Histogram: &entity.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1},
+		ID:        "RequestDuration",
+		MType:     entity.HistogramType,
+	})
+	require.NoError(t, err)
+
+	res, err := h.Updates(ctx, &pbv2.UpdatesRequest{Metrics: []*pbv2.Metric{
+		{Id: "PollCount", Type: pbv2.MetricType_METRIC_TYPE_COUNTER, Value: &pbv2.Metric_Delta{Delta: 5}},
+		{Id: "Alloc", Type: pbv2.MetricType_METRIC_TYPE_GAUGE, Value: &pbv2.Metric_Delta{Delta: 1}},
+		{Id: "Zero", Type: pbv2.MetricType_METRIC_TYPE_GAUGE, Value: &pbv2.Metric_Gauge{Gauge: 0}},
+		{Id: "Missing", Type: pbv2.MetricType_METRIC_TYPE_GAUGE},
+		{Id: "Untyped", Value: &pbv2.Metric_Gauge{Gauge: 1}},
+		{Id: "RequestDuration", Type: pbv2.MetricType_METRIC_TYPE_HISTOGRAM, Value: &pbv2.Metric_Histogram{
+			Histogram: &pbv2.Histogram{Bounds: []float64{2}, Counts: []uint64{1, 0}, Sum: 1.5, Count: 1},
+		}},
+		{Id: "RequestDuration", Type: pbv2.MetricType_METRIC_TYPE_HISTOGRAM, Value: &pbv2.Metric_Observation{Observation: 2}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, res.Results, 7)
+
+	codesOf := make([]codes.Code, 0, len(res.Results))
+	for _, result := range res.Results {
+		codesOf = append(codesOf, codes.Code(result.Code))
+	}
+	assert.Equal(t, []codes.Code{
+		codes.OK,
+		codes.InvalidArgument,
+		codes.OK,
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.OK,
+	}, codesOf)
+
+	assert.Equal(t, int64(5), res.Results[0].Metric.GetDelta())
+
+	// the zero value isn't taken for a missing one
+	zero := res.Results[2].Metric
+	require.IsType(t, &pbv2.Metric_Gauge{}, zero.Value)
+	assert.Equal(t, 0.0, zero.GetGauge())
+
+	histogram := res.Results[6].Metric.GetHistogram()
+	require.NotNil(t, histogram)
+	assert.Equal(t, []uint64{1, 1}, histogram.Counts)
+
+	for _, i := range []int{1, 3, 4, 5} {
+		assert.NotEmpty(t, res.Results[i].Message)
+		assert.Nil(t, res.Results[i].Metric)
+	}
+
+	_, _, err = metricsService.GetMetric(entity.GaugeType, "Alloc", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	pbv2 "github.com/ivas1ly/uwu-metrics/pkg/api/metrics/v2"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	metricTypes = map[pbv2.MetricType]string{
+		pbv2.MetricType_METRIC_TYPE_COUNTER:   entity.CounterType,
+		pbv2.MetricType_METRIC_TYPE_GAUGE:     entity.GaugeType,
+		pbv2.MetricType_METRIC_TYPE_HISTOGRAM: entity.HistogramType,
+	}
+	counterModes = map[pbv2.CounterMode]string{
+		pbv2.CounterMode_COUNTER_MODE_UNSPECIFIED: "",
+		pbv2.CounterMode_COUNTER_MODE_DELTA:       entity.CounterModeDelta,
+		pbv2.CounterMode_COUNTER_MODE_CUMULATIVE:  entity.CounterModeCumulative,
+	}
+)
+
+// MetricsV2gRPCHandler serves the version 2 of the metrics API.
+type MetricsV2gRPCHandler struct {
+	pbv2.UnimplementedMetricsServiceServer
+	metricsService MetricsService
+	log            *zap.Logger
+}
+
+func NewRoutesV2(metricsService MetricsService, log *zap.Logger) *MetricsV2gRPCHandler {
+	return &MetricsV2gRPCHandler{
+		metricsService: metricsService,
+		log:            log.With(zap.String("gRPC handler", "metrics v2")),
+	}
+}
+
+// Updates applies each metric of the batch separately and returns the result of each one.
+// The valid metrics are saved in a single transaction, the rejected ones get the InvalidArgument
+// code and the error message in their results.
+func (h *MetricsV2gRPCHandler) Updates(ctx context.Context, in *pbv2.UpdatesRequest) (*pbv2.UpdatesResponse, error) {
+	source := RequestSource(ctx)
+
+	results := make([]*pbv2.UpdateResult, len(in.Metrics))
+	batch := make([]*entity.Metric, 0, len(in.Metrics))
+	// indexes are the positions of the batch metrics in the request
+	indexes := make([]int, 0, len(in.Metrics))
+
+	for i, metric := range in.Metrics {
+		m, err := metricFromPbV2(metric, source)
+		if err != nil {
+			results[i] = rejectedResult(err.Error())
+			continue
+		}
+		batch = append(batch, m)
+		indexes = append(indexes, i)
+	}
+
+	// the rejected metrics are excluded from the batch and the rest of it is applied again,
+	// each attempt rejects at least one metric
+	for len(batch) > 0 {
+		upserted, err := h.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			rejected := make(map[int]struct{}, len(batchErr.Items))
+			for _, item := range batchErr.Items {
+				results[indexes[item.Index]] = rejectedResult(entity.ErrorMessage(item.Err, item.MType))
+				rejected[item.Index] = struct{}{}
+			}
+
+			n := 0
+			for j := range batch {
+				if _, ok := rejected[j]; !ok {
+					batch[n], indexes[n] = batch[j], indexes[j]
+					n++
+				}
+			}
+			batch, indexes = batch[:n], indexes[:n]
+			continue
+		}
+		if err != nil {
+			h.log.Info("can't apply batch", zap.Error(err))
+			return nil, status.Error(codes.Internal, "can't apply batch")
+		}
+
+		for j, metric := range upserted {
+			results[indexes[j]] = &pbv2.UpdateResult{
+				Code:   int32(codes.OK),
+				Metric: metricToPbV2(metric),
+			}
+		}
+		break
+	}
+
+	saved := 0
+	for _, result := range results {
+		if codes.Code(result.Code) == codes.OK {
+			saved++
+		}
+	}
+	h.log.Info("batch applied", zap.Int("saved", saved), zap.Int("total", len(in.Metrics)))
+
+	return &pbv2.UpdatesResponse{Results: results}, nil
+}
+
+func rejectedResult(message string) *pbv2.UpdateResult {
+	return &pbv2.UpdateResult{
+		Code:    int32(codes.InvalidArgument),
+		Message: message,
+	}
+}
+
+// metricFromPbV2 checks that the metric has the id and the value of its type.
+func metricFromPbV2(metric *pbv2.Metric, source string) (*entity.Metric, error) {
+	if strings.TrimSpace(metric.Id) == "" {
+		return nil, fmt.Errorf("field %q is required", "id")
+	}
+
+	mType, ok := metricTypes[metric.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s %q", entity.ErrUnknownMetricType.Error(), metric.Type.String())
+	}
+
+	mode, ok := counterModes[metric.Mode]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown counter mode %q", entity.ErrIncorrectMetricValue.Error(), metric.Mode.String())
+	}
+
+	m := &entity.Metric{
+		Labels: metric.Labels,
+		ID:     metric.Id,
+		MType:  mType,
+		Mode:   mode,
+		Source: source,
+	}
+
+	switch value := metric.Value.(type) {
+	case *pbv2.Metric_Delta:
+		if mType == entity.CounterType {
+			m.Delta = &value.Delta
+		}
+	case *pbv2.Metric_Gauge:
+		if mType == entity.GaugeType {
+			m.Value = &value.Gauge
+		}
+	case *pbv2.Metric_Histogram:
+		if mType == entity.HistogramType {
+			m.Histogram = histogramFromPbV2(value.Histogram)
+		}
+	case *pbv2.Metric_Observation:
+		if mType == entity.HistogramType {
+			m.Value = &value.Observation
+		}
+	case nil:
+		return nil, fmt.Errorf("%s %q", entity.ErrEmptyMetricValue.Error(), mType)
+	}
+
+	if m.Delta == nil && m.Value == nil && m.Histogram == nil {
+		return nil, fmt.Errorf("%s: the value doesn't match the metric type %q",
+			entity.ErrIncorrectMetricValue.Error(), mType)
+	}
+
+	return m, nil
+}
+
+func metricToPbV2(metric *entity.Metric) *pbv2.Metric {
+	m := &pbv2.Metric{
+		Id:     metric.ID,
+		Labels: metric.Labels,
+	}
+
+	for pbType, mType := range metricTypes {
+		if mType == metric.MType {
+			m.Type = pbType
+		}
+	}
+
+	switch {
+	case metric.Delta != nil:
+		m.Value = &pbv2.Metric_Delta{Delta: *metric.Delta}
+	case metric.Value != nil:
+		m.Value = &pbv2.Metric_Gauge{Gauge: *metric.Value}
+	case metric.Histogram != nil:
+		m.Value = &pbv2.Metric_Histogram{Histogram: &pbv2.Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Sum:    metric.Histogram.Sum,
+			Count:  metric.Histogram.Count,
+		}}
+	}
+
+	return m
+}
+
+func histogramFromPbV2(histogram *pbv2.Histogram) *entity.Histogram {
+	if histogram == nil {
+		return nil
+	}
+
+	return &entity.Histogram{
+		Bounds: histogram.Bounds,
+		Counts: histogram.Counts,
+		Sum:    histogram.Sum,
+		Count:  histogram.Count,
+	}
+}
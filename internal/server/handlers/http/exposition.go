@@ -0,0 +1,364 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+const (
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	openMetricsMediaType   = "application/openmetrics-text"
+	textMediaType          = "text/plain"
+)
+
+// bucketLabel is the label of the histogram bucket upper bound, the user label
+// with the same name is exposed as exported_le.
+const (
+	bucketLabel         = "le"
+	exportedBucketLabel = "exported_le"
+)
+
+// The specificity of the Accept media range that matches a media type.
+const (
+	matchAny = iota + 1
+	matchMainType
+	matchExact
+)
+
+// family is a group of series with the same sanitized name and type.
+type family struct {
+	// keys are the series keys of the family, to skip the series with the same sanitized name and labels
+	keys   map[string]struct{}
+	name   string
+	mType  string
+	series []series
+}
+
+type series struct {
+	labels    map[string]string
+	histogram entity.Histogram
+	delta     int64
+	value     float64
+}
+
+// exposition renders all stored metrics in the Prometheus text format
+// or in the OpenMetrics format if it's requested in the Accept header.
+//
+// Metric names are sanitized to match [a-zA-Z_:][a-zA-Z0-9_:]*, the series with the same
+// sanitized name and a different type or the same labels are skipped, as well as the series
+// with the sample names of another metric, e.g. x_total and the counter x. If the client refuses
+// both formats, the response is 406 Not Acceptable.
+func (h *metricsHandler) exposition(w http.ResponseWriter, r *http.Request) {
+	openMetrics, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "only the Prometheus text and OpenMetrics formats are available", http.StatusNotAcceptable)
+		return
+	}
+
+	families := h.families(h.metricsService.GetAllMetrics(), openMetrics)
+
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", textContentType)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		writeFamily(bw, f, openMetrics)
+	}
+	if openMetrics {
+		_, _ = bw.WriteString("# EOF\n")
+	}
+
+	if err := bw.Flush(); err != nil {
+		h.log.Info("can't write metrics exposition", zap.Error(err))
+	}
+}
+
+// families groups the metrics by the sanitized name, the result is sorted by the name.
+//
+// The families with the sample names used by another family are skipped, e.g. the gauge x_total
+// and the OpenMetrics samples of the counter x or the gauge x_sum and the samples of the histogram x.
+func (h *metricsHandler) families(metrics entity.Metrics, openMetrics bool) []*family {
+	byName := make(map[string]*family)
+	// samples are the sample names of the families, to skip the families with the same sample names
+	samples := make(map[string]string)
+
+	add := func(key, mType string, s series) {
+		name, labels := entity.ParseSeriesKey(key)
+		name = sanitizeName(name)
+		if openMetrics && mType == entity.CounterType {
+			// the _total suffix belongs to the counter sample, not to the family name
+			name = strings.TrimSuffix(name, "_total")
+		}
+
+		f, ok := byName[name]
+		if !ok {
+			names := sampleNames(name, mType, openMetrics)
+			for _, sample := range names {
+				if other, used := samples[sample]; used {
+					h.log.Info("metric sample name conflicts with the samples of another metric, skip",
+						zap.String("name", key), zap.String("sample", sample), zap.String("conflicts with", other))
+					return
+				}
+			}
+			for _, sample := range names {
+				samples[sample] = name
+			}
+
+			f = &family{name: name, mType: mType, keys: make(map[string]struct{})}
+			byName[name] = f
+		}
+		if f.mType != mType {
+			h.log.Info("metric name conflicts with a metric of another type, skip",
+				zap.String("name", key), zap.String("type", mType), zap.String("conflicts with", f.mType))
+			return
+		}
+
+		if value, ok := labels[bucketLabel]; ok && mType == entity.HistogramType {
+			if _, exists := labels[exportedBucketLabel]; exists {
+				h.log.Info("histogram labels conflict with the bucket label, skip", zap.String("name", key))
+				return
+			}
+			delete(labels, bucketLabel)
+			labels[exportedBucketLabel] = value
+		}
+
+		seriesKey := entity.SeriesKey(name, labels)
+		if _, ok := f.keys[seriesKey]; ok {
+			h.log.Info("metric conflicts with another series after the name is sanitized, skip",
+				zap.String("name", key), zap.String("conflicts with", seriesKey))
+			return
+		}
+		f.keys[seriesKey] = struct{}{}
+
+		s.labels = labels
+		f.series = append(f.series, s)
+	}
+
+	// the keys are sorted, so the conflicting series are skipped in the same order every time
+	for _, key := range sortedKeys(metrics.Counter) {
+		add(key, entity.CounterType, series{delta: metrics.Counter[key]})
+	}
+	for _, key := range sortedKeys(metrics.Gauge) {
+		add(key, entity.GaugeType, series{value: metrics.Gauge[key]})
+	}
+	for _, key := range sortedKeys(metrics.Histogram) {
+		add(key, entity.HistogramType, series{histogram: metrics.Histogram[key]})
+	}
+
+	families := make([]*family, 0, len(byName))
+	for _, f := range byName {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	return families
+}
+
+// sampleNames returns the names of the samples of the family, as they are written by writeFamily.
+func sampleNames(name, mType string, openMetrics bool) []string {
+	switch {
+	case mType == entity.CounterType && openMetrics:
+		return []string{name + "_total"}
+	case mType == entity.HistogramType:
+		return []string{name + "_bucket", name + "_sum", name + "_count"}
+	default:
+		return []string{name}
+	}
+}
+
+func writeFamily(w io.StringWriter, f *family, openMetrics bool) {
+	_, _ = w.WriteString("# TYPE " + f.name + " " + f.mType + "\n")
+
+	for _, s := range f.series {
+		switch f.mType {
+		case entity.CounterType:
+			name := f.name
+			if openMetrics {
+				name += "_total"
+			}
+			writeSample(w, name, s.labels, "", "", strconv.FormatInt(s.delta, 10))
+		case entity.GaugeType:
+			writeSample(w, f.name, s.labels, "", "", formatFloat(s.value))
+		case entity.HistogramType:
+			var cumulative uint64
+			for i, count := range s.histogram.Counts {
+				cumulative += count
+
+				le := "+Inf"
+				if i < len(s.histogram.Bounds) {
+					le = formatFloat(s.histogram.Bounds[i])
+				}
+				writeSample(w, f.name+"_bucket", s.labels, bucketLabel, le, strconv.FormatUint(cumulative, 10))
+			}
+			writeSample(w, f.name+"_sum", s.labels, "", "", formatFloat(s.histogram.Sum))
+			writeSample(w, f.name+"_count", s.labels, "", "", strconv.FormatUint(s.histogram.Count, 10))
+		}
+	}
+}
+
+// writeSample writes a sample line, the extra label (e.g. le of a histogram bucket) goes last.
+func writeSample(w io.StringWriter, name string, labels map[string]string, extraName, extraValue, value string) {
+	_, _ = w.WriteString(name)
+
+	names := make([]string, 0, len(labels))
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 || extraName != "" {
+		_, _ = w.WriteString("{")
+		for i, labelName := range names {
+			if i > 0 {
+				_, _ = w.WriteString(",")
+			}
+			_, _ = w.WriteString(labelName + `="` + escapeLabelValue(labels[labelName]) + `"`)
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				_, _ = w.WriteString(",")
+			}
+			_, _ = w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		_, _ = w.WriteString("}")
+	}
+
+	_, _ = w.WriteString(" " + value + "\n")
+}
+
+// negotiateFormat returns whether the OpenMetrics format is chosen by the Accept header, ok is false
+// if the client refuses both formats with q=0.
+//
+// The quality of a format is taken from the most specific media range that matches it. The OpenMetrics
+// format is chosen if it's listed explicitly and isn't less preferred than the text format, or if it's
+// the only acceptable one. An empty header accepts the text format.
+func negotiateFormat(accept string) (bool, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return false, true
+	}
+
+	openMetrics, explicit := mediaQuality(accept, openMetricsMediaType)
+	text, _ := mediaQuality(accept, textMediaType)
+
+	switch {
+	case explicit && openMetrics > 0 && openMetrics >= text:
+		return true, true
+	case text > 0:
+		return false, true
+	case openMetrics > 0:
+		return true, true
+	}
+
+	return false, false
+}
+
+// mediaQuality returns the quality of the media type in the Accept header and whether
+// the media type is listed explicitly, the quality is 0 if no media range matches it.
+func mediaQuality(accept, mediaType string) (float64, bool) {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, 0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		rangeType := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var rangeSpecificity int
+		switch rangeType {
+		case mediaType:
+			rangeSpecificity = matchExact
+		case mainType + "/*":
+			rangeSpecificity = matchMainType
+		case "*/*":
+			rangeSpecificity = matchAny
+		default:
+			continue
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+
+		quality, specificity = q, rangeSpecificity
+	}
+
+	return quality, specificity == matchExact
+}
+
+// sanitizeName replaces the characters that aren't allowed in a metric name with underscores.
+func sanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
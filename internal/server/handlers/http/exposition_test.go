@@ -0,0 +1,148 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+)
+
+func TestExpositionHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	delta := int64(5)
+	value := 12.5
+	_, err := metricsService.UpsertTypeMetrics([]*entity.Metric{
+		{ID: "PollCount", MType: entity.CounterType, Delta: &delta},
+		{ID: "requests_total", MType: entity.CounterType, Delta: &delta},
+		{ID: "CPUutilization", MType: entity.GaugeType, Value: &value,
+			Labels: map[string]string{"cpu": "1", "host": `a"b`}},
+		{ID: "3d.gauge", MType: entity.GaugeType, Value: &value},
+		// sanitized to the same name and labels as 3d.gauge
+		{ID: "3d gauge", MType: entity.GaugeType, Value: &value},
+		// the OpenMetrics sample of the counter has the same name as the gauge
+		{ID: "jobs", MType: entity.CounterType, Delta: &delta},
+		{ID: "jobs_total", MType: entity.GaugeType, Value: &value},
+		{ID: "latency", MType: entity.HistogramType, Histogram: &entity.Histogram{
+			Bounds: []float64{0.1, 1},
+			Counts: []uint64{1, 2, 1},
+			Sum:    6.05,
+		}},
+		{ID: "requests", MType: entity.HistogramType, Labels: map[string]string{"le": "a"},
+			Histogram: &entity.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5}},
+	})
+	require.NoError(t, err)
+
+	t.Run("text format", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/metrics", http.NoBody)
+		require.NoError(t, err)
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `# TYPE CPUutilization gauge
+CPUutilization{cpu="1",host="a\"b"} 12.5
+# TYPE PollCount counter
+PollCount 5
+# TYPE _3d_gauge gauge
+_3d_gauge 12.5
+# TYPE jobs counter
+jobs 5
+# TYPE jobs_total gauge
+jobs_total 12.5
+# TYPE latency histogram
+latency_bucket{le="0.1"} 1
+latency_bucket{le="1"} 3
+latency_bucket{le="+Inf"} 4
+latency_sum 6.05
+latency_count 4
+# TYPE requests histogram
+requests_bucket{exported_le="a",le="1"} 1
+requests_bucket{exported_le="a",le="+Inf"} 1
+requests_sum{exported_le="a"} 0.5
+requests_count{exported_le="a"} 1
+# TYPE requests_total counter
+requests_total 5
+`, string(body))
+	})
+
+	t.Run("OpenMetrics format", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/metrics", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/openmetrics-text; version=1.0.0; charset=utf-8", res.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "# TYPE PollCount counter\nPollCount_total 5\n")
+		assert.Contains(t, string(body), "# TYPE requests counter\nrequests_total 5\n")
+		// the histogram has the same name as the counter without the _total suffix
+		assert.NotContains(t, string(body), "requests_bucket")
+		// the gauge has the same name as the counter sample
+		assert.Contains(t, string(body), "# TYPE jobs counter\njobs_total 5\n")
+		assert.NotContains(t, string(body), "# TYPE jobs_total gauge")
+		assert.NotContains(t, string(body), "jobs_total 12.5")
+		assert.Regexp(t, "# EOF\n$", string(body))
+	})
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept      string
+		openMetrics bool
+		ok          bool
+	}{
+		{accept: "", ok: true},
+		{accept: "*/*", ok: true},
+		{accept: "application/openmetrics-text;version=1.0.0,text/plain;q=0.5", openMetrics: true, ok: true},
+		{accept: "application/openmetrics-text;q=0.5,text/plain;version=0.0.4;q=0.4,*/*;q=0.1",
+			openMetrics: true, ok: true},
+		{accept: "application/openmetrics-text;q=0,text/plain", ok: true},
+		{accept: "application/openmetrics-text;q=0,*/*", ok: true},
+		{accept: "text/plain;q=0,*/*", openMetrics: true, ok: true},
+		{accept: "application/openmetrics-text;q=0,text/*;q=0"},
+		{accept: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			openMetrics, ok := negotiateFormat(tt.accept)
+			assert.Equal(t, tt.openMetrics, openMetrics)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "CPUutilization3", sanitizeName("CPUutilization3"))
+	assert.Equal(t, "my_counter", sanitizeName("my counter"))
+	assert.Equal(t, "_1st:metric_", sanitizeName("1st:metric!"))
+	assert.Equal(t, "_", sanitizeName(""))
+}
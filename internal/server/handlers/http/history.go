@@ -0,0 +1,146 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// historyParams are the query parameters of the history endpoint that aren't metric labels.
+var historyParams = map[string]struct{}{"from": {}, "to": {}, "step": {}}
+
+// HistoryPoint structure for marshaling a metric history point to the response body.
+type HistoryPoint struct {
+	Delta     *int64    `json:"delta,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HistoryRes structure for marshaling the metric history to the response body.
+type HistoryRes struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Points []HistoryPoint    `json:"points"`
+}
+
+// history gets the metric values over time at the type and name specified in the URL.
+//
+// Optional query parameters:
+//   - from, to - interval boundaries in RFC 3339 format or Unix time in seconds;
+//   - step - interval between the points, Go duration (e.g. "30s") or number of seconds.
+//
+// All other query parameters are the metric labels.
+func (h *metricsHandler) history(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	mType := strings.ToLower(chi.URLParam(r, "type"))
+	mName := chi.URLParam(r, "name")
+
+	query := r.URL.Query()
+
+	from, err := parseTime(query.Get("from"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": fmt.Sprintf("incorrect %q parameter", "from")})
+		return
+	}
+
+	to, err := parseTime(query.Get("to"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": fmt.Sprintf("incorrect %q parameter", "to")})
+		return
+	}
+
+	step, err := parseStep(query.Get("step"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": fmt.Sprintf("incorrect %q parameter", "step")})
+		return
+	}
+
+	labels := queryLabels(r, historyParams)
+
+	points, err := h.metricsService.GetHistory(mType, mName, labels, from, to, step)
+	if errors.Is(err, entity.ErrHistoryDisabled) {
+		h.log.Info(entity.ErrHistoryDisabled.Error())
+		w.WriteHeader(http.StatusNotImplemented)
+		render.JSON(w, r, render.M{"message": entity.ErrHistoryDisabled.Error()})
+		return
+	}
+	if errors.Is(err, entity.ErrUnknownMetricType) {
+		h.log.Info(entity.ErrUnknownMetricType.Error(), zap.String("type", mType))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": fmt.Sprintf("%s %q",
+			entity.ErrUnknownMetricType.Error(), mType)})
+		return
+	}
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, entity.ErrIncorrectTimeRange) {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": entity.ErrIncorrectTimeRange.Error()})
+		return
+	}
+	if errors.Is(err, entity.ErrCanNotGetMetricValue) {
+		h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusNotFound)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
+
+	res := HistoryRes{
+		Labels: labels,
+		ID:     mName,
+		MType:  mType,
+		Points: make([]HistoryPoint, 0, len(points)),
+	}
+	for _, point := range points {
+		res.Points = append(res.Points, HistoryPoint{
+			Delta:     point.Delta,
+			Value:     point.Value,
+			Timestamp: point.Timestamp,
+		})
+	}
+
+	render.JSON(w, r, res)
+}
+
+// parseTime parses time in RFC 3339 format or Unix time in seconds, an empty value is a zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseStep parses a Go duration or number of seconds, an empty value is a zero duration.
+func parseStep(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/history"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	testStorage := NewTestStorage()
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(testStorage,
+		service.WithHistory(history.NewHistoryStorage(time.Hour, time.Second)))
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	require.NoError(t, metricsService.UpsertMetric("gauge", "HeapAlloc", "123.456", nil))
+	require.NoError(t, metricsService.UpsertMetric("counter", "PollCount", "5", nil))
+	require.NoError(t, metricsService.UpsertMetric("counter", "PollCount", "5", nil))
+
+	type want struct {
+		body       string
+		statusCode int
+	}
+	tests := []struct {
+		name string
+		path string
+		want want
+	}{
+		{
+			name: "unknown metric",
+			path: "/history/gauge/uwu",
+			want: want{statusCode: http.StatusNotFound},
+		},
+		{
+			name: "unknown metric type",
+			path: "/history/uwu/HeapAlloc",
+			want: want{statusCode: http.StatusBadRequest, body: `{"message":"unknown metric type \"uwu\""}`},
+		},
+		{
+			name: "incorrect step",
+			path: "/history/gauge/HeapAlloc?step=uwu",
+			want: want{statusCode: http.StatusBadRequest, body: `{"message":"incorrect \"step\" parameter"}`},
+		},
+		{
+			name: "incorrect time range",
+			path: "/history/gauge/HeapAlloc?from=2024-04-02T00:00:00Z&to=2024-04-01T00:00:00Z",
+			want: want{statusCode: http.StatusBadRequest, body: `{"message":"incorrect time range"}`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := testRequest(t, ts, http.MethodGet, test.path, nil, "")
+			defer res.Body.Close()
+			assert.Equal(t, test.want.statusCode, res.StatusCode)
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+			if test.want.body != "" {
+				resBody, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, test.want.body, strings.TrimSpace(string(resBody)))
+			}
+		})
+	}
+
+	t.Run("gauge and counter history", func(t *testing.T) {
+		res := testRequest(t, ts, http.MethodGet, "/history/gauge/HeapAlloc?step=1m", nil, "")
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var gauge HistoryRes
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&gauge))
+		require.Len(t, gauge.Points, 1)
+		assert.Equal(t, 123.456, *gauge.Points[0].Value)
+
+		res = testRequest(t, ts, http.MethodGet, "/history/counter/PollCount", nil, "")
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var counter HistoryRes
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&counter))
+		require.NotEmpty(t, counter.Points)
+		assert.Equal(t, int64(10), *counter.Points[len(counter.Points)-1].Delta)
+	})
+
+	t.Run("history is disabled", func(t *testing.T) {
+		r := chi.NewRouter()
+		NewRoutes(r, service.NewMetricsService(NewTestStorage()), logger)
+
+		disabled := httptest.NewServer(r)
+		defer disabled.Close()
+
+		res := testRequest(t, disabled, http.MethodGet, "/history/gauge/HeapAlloc", nil, "")
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusNotImplemented, res.StatusCode)
+	})
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// InfluxRule sets the type of the integer fields of the InfluxDB line protocol.
+//
+// Match is a path.Match pattern of the metric name, e.g. "net_bytes_*". Mode is the counter
+// mode, Telegraf reports the running totals, so an empty mode is the cumulative one.
+// The integer fields without a matching rule are saved as gauges.
+type InfluxRule struct {
+	Match string `json:"match"`
+	Type  string `json:"type"`
+	Mode  string `json:"mode"`
+}
+
+// ValidateInfluxRules checks the patterns, types and modes of the rules.
+func ValidateInfluxRules(rules []InfluxRule) error {
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Match, ""); err != nil || rule.Match == "" {
+			return fmt.Errorf("influx rule %d: incorrect pattern %q", i, rule.Match)
+		}
+		if rule.Type != entity.CounterType && rule.Type != entity.GaugeType {
+			return fmt.Errorf("influx rule %d: type must be %q or %q", i, entity.CounterType, entity.GaugeType)
+		}
+		if rule.Mode != "" && rule.Mode != entity.CounterModeDelta && rule.Mode != entity.CounterModeCumulative {
+			return fmt.Errorf("influx rule %d: unknown counter mode %q", i, rule.Mode)
+		}
+	}
+
+	return nil
+}
+
+// influxWrite receives the metrics in the InfluxDB line protocol, so Telegraf
+// can use the server as an output.
+//
+// Each field is saved as a separate metric named measurement_field, a field named "value"
+// is saved with the measurement name. The tags are the labels. Float and boolean fields are
+// gauges, the integer fields are counters or gauges according to the rules, string fields
+// are skipped. The timestamps are only checked, the metrics are saved as they are received.
+//
+// The request is applied with all-or-nothing semantics, a line that can't be parsed
+// rejects the whole request.
+func (h *metricsHandler) influxWrite(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var batch []*entity.Metric
+
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, maxPushBodySize))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxPushBodySize)
+	source := RequestSource(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseLineProtocol(line)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, render.M{"message": fmt.Sprintf("line %d: %s", n, err.Error())})
+			return
+		}
+
+		batch = append(batch, h.influxMetrics(p, source)...)
+	}
+	if err := scanner.Err(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": "can't read body"})
+		return
+	}
+
+	if len(batch) > 0 {
+		_, err := h.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			h.log.Info("line protocol batch rejected", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, render.M{"message": batchErr.Error()})
+			return
+		}
+		if err != nil {
+			h.log.Info("can't apply line protocol batch", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.log.Info("line protocol metrics saved", zap.Int("metrics", len(batch)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// influxMetrics converts the fields of the point to metrics.
+func (h *metricsHandler) influxMetrics(p *point, source string) []*entity.Metric {
+	labels := make(map[string]string, len(p.tags))
+	for key, value := range p.tags {
+		labels[sanitizeLabelName(key)] = value
+	}
+
+	metrics := make([]*entity.Metric, 0, len(p.fields))
+	for _, f := range p.fields {
+		if f.kind == fieldString {
+			continue
+		}
+
+		name := p.measurement
+		if f.key != "value" {
+			name += "_" + f.key
+		}
+
+		metric := &entity.Metric{
+			Labels: labels,
+			ID:     name,
+			MType:  entity.GaugeType,
+		}
+
+		rule, ok := h.influxRule(name)
+		if f.kind == fieldInteger && ok && rule.Type == entity.CounterType {
+			delta := f.integer
+			metric.MType = entity.CounterType
+			metric.Delta = &delta
+			metric.Mode = rule.Mode
+			if metric.Mode == "" {
+				metric.Mode = entity.CounterModeCumulative
+			}
+			metric.Source = source
+		} else {
+			value := f.value
+			metric.Value = &value
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics
+}
+
+// influxRule returns the first rule matching the metric name.
+func (h *metricsHandler) influxRule(name string) (InfluxRule, bool) {
+	for _, rule := range h.influxRules {
+		if ok, _ := path.Match(rule.Match, name); ok {
+			return rule, true
+		}
+	}
+
+	return InfluxRule{}, false
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+)
+
+func TestInfluxWriteHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	rules := []InfluxRule{
+		{Match: "net_bytes_*", Type: entity.CounterType},
+		{Match: "requests", Type: entity.CounterType, Mode: entity.CounterModeDelta},
+	}
+	require.NoError(t, ValidateInfluxRules(rules))
+
+	NewRoutes(router, metricsService, logger, WithInfluxRules(rules))
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	write := func(t *testing.T, body string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/write?db=telegraf&precision=ns", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	labels := map[string]string{"host": "server01"}
+
+	t.Run("Telegraf output", func(t *testing.T) {
+		for _, body := range []string{
+			"# telegraf\n" +
+				"net,host=server01 bytes_recv=1000i,bytes_sent=300i,err_in=2i 1700000000000000000\n" +
+				"cpu,host=server01,cpu=cpu-total usage_idle=92.5,usage_user=3.5 1700000000000000000\n" +
+				"system,host=server01 uptime=3600i,load1=0.25 1700000000000000000\n" +
+				"requests,host=server01 value=5i,path=\"/metrics\"\n",
+			"net,host=server01 bytes_recv=1500i,bytes_sent=300i,err_in=3i 1700000010000000000\n" +
+				"requests,host=server01 value=2i\n",
+		} {
+			assert.Equal(t, http.StatusNoContent, write(t, body))
+		}
+
+		// the cumulative counters keep the last running total
+		received, _, err := metricsService.GetMetric(entity.CounterType, "net_bytes_recv", labels)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1500), *received)
+
+		sent, _, err := metricsService.GetMetric(entity.CounterType, "net_bytes_sent", labels)
+		require.NoError(t, err)
+		assert.Equal(t, int64(300), *sent)
+
+		// the delta counters are summed up
+		requests, _, err := metricsService.GetMetric(entity.CounterType, "requests", labels)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), *requests)
+
+		// the integer fields without a rule are gauges
+		_, errors, err := metricsService.GetMetric(entity.GaugeType, "net_err_in", labels)
+		require.NoError(t, err)
+		assert.Equal(t, 3.0, *errors)
+
+		_, idle, err := metricsService.GetMetric(entity.GaugeType, "cpu_usage_idle",
+			map[string]string{"host": "server01", "cpu": "cpu-total"})
+		require.NoError(t, err)
+		assert.Equal(t, 92.5, *idle)
+
+		_, uptime, err := metricsService.GetMetric(entity.GaugeType, "system_uptime", labels)
+		require.NoError(t, err)
+		assert.Equal(t, 3600.0, *uptime)
+	})
+
+	t.Run("incorrect line rejects the whole request", func(t *testing.T) {
+		status := write(t, "mem,host=server01 used=100i\nmem,host=server01 free=uwu\n")
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		_, _, err := metricsService.GetMetric(entity.GaugeType, "mem_used", labels)
+		assert.Error(t, err)
+	})
+
+	t.Run("tag names are sanitized", func(t *testing.T) {
+		status := write(t, "mem,1host=server01 free=5i\n")
+		assert.Equal(t, http.StatusNoContent, status)
+
+		_, _, err := metricsService.GetMetric(entity.GaugeType, "mem_free", map[string]string{"key_1host": "server01"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestValidateInfluxRules(t *testing.T) {
+	assert.Error(t, ValidateInfluxRules([]InfluxRule{{Match: "[", Type: entity.CounterType}}))
+	assert.Error(t, ValidateInfluxRules([]InfluxRule{{Match: "net_*", Type: entity.HistogramType}}))
+	assert.Error(t, ValidateInfluxRules([]InfluxRule{{Match: "net_*", Type: entity.CounterType, Mode: "uwu"}}))
+	assert.NoError(t, ValidateInfluxRules([]InfluxRule{{Match: "net_*", Type: entity.CounterType}}))
+}
@@ -0,0 +1,168 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errIncorrectLineProtocol = errors.New("incorrect line protocol")
+
+// point is a parsed line of the InfluxDB line protocol.
+type point struct {
+	tags        map[string]string
+	measurement string
+	fields      []field
+}
+
+type fieldKind int
+
+const (
+	fieldFloat fieldKind = iota
+	fieldInteger
+	fieldBoolean
+	fieldString
+)
+
+type field struct {
+	key     string
+	kind    fieldKind
+	value   float64
+	integer int64
+}
+
+// parseLineProtocol parses the `measurement[,tag=value...] field=value[,field=value...] [timestamp]`
+// line. The commas, equal signs and spaces in the names are escaped with a backslash,
+// as well as the double quotes in the string field values.
+func parseLineProtocol(line string) (*point, error) {
+	p := &point{tags: make(map[string]string)}
+
+	measurement, i := readToken(line, 0, ", ")
+	if measurement == "" {
+		return nil, fmt.Errorf("%w: no measurement", errIncorrectLineProtocol)
+	}
+	p.measurement = measurement
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = readToken(line, i+1, ",= ")
+		if key == "" || i >= len(line) || line[i] != '=' {
+			return nil, fmt.Errorf("%w: incorrect tag", errIncorrectLineProtocol)
+		}
+		value, i = readToken(line, i+1, ", ")
+		if value == "" {
+			return nil, fmt.Errorf("%w: empty value of the tag %q", errIncorrectLineProtocol, key)
+		}
+		p.tags[key] = value
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return nil, fmt.Errorf("%w: no fields", errIncorrectLineProtocol)
+	}
+
+	for {
+		var (
+			f   field
+			err error
+		)
+		f.key, i = readToken(line, i+1, ",= ")
+		if f.key == "" || i >= len(line) || line[i] != '=' {
+			return nil, fmt.Errorf("%w: incorrect field", errIncorrectLineProtocol)
+		}
+
+		f, i, err = readFieldValue(line, i+1, f)
+		if err != nil {
+			return nil, err
+		}
+		p.fields = append(p.fields, f)
+
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+	}
+
+	if i < len(line) {
+		timestamp := strings.TrimSpace(line[i:])
+		if _, err := strconv.ParseInt(timestamp, 10, 64); timestamp != "" && err != nil {
+			return nil, fmt.Errorf("%w: incorrect timestamp %q", errIncorrectLineProtocol, timestamp)
+		}
+	}
+
+	return p, nil
+}
+
+// readToken reads the line from i until one of the unescaped stop characters.
+func readToken(line string, i int, stops string) (string, int) {
+	var sb strings.Builder
+	for i < len(line) {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && strings.IndexByte(stops, line[i+1]) >= 0 {
+			sb.WriteByte(line[i+1])
+			i += 2
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), i
+}
+
+func readFieldValue(line string, i int, f field) (field, int, error) {
+	// string values can't be saved, so they are only skipped
+	if i < len(line) && line[i] == '"' {
+		for i++; i < len(line); i++ {
+			if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+				i++
+				continue
+			}
+			if line[i] == '"' {
+				f.kind = fieldString
+				return f, i + 1, nil
+			}
+		}
+		return f, i, fmt.Errorf("%w: unterminated string value of the field %q", errIncorrectLineProtocol, f.key)
+	}
+
+	raw, i := readToken(line, i, ", ")
+
+	var err error
+	switch {
+	case raw == "":
+		err = errors.New("empty value")
+	case strings.HasSuffix(raw, "i"):
+		f.kind = fieldInteger
+		f.integer, err = strconv.ParseInt(strings.TrimSuffix(raw, "i"), 10, 64)
+		f.value = float64(f.integer)
+	case strings.HasSuffix(raw, "u"):
+		var unsigned uint64
+		f.kind = fieldInteger
+		unsigned, err = strconv.ParseUint(strings.TrimSuffix(raw, "u"), 10, 64)
+		if err == nil && unsigned > math.MaxInt64 {
+			err = errors.New("unsigned value is out of range")
+		}
+		f.integer = int64(unsigned)
+		f.value = float64(unsigned)
+	case raw == "t" || raw == "T" || raw == "true" || raw == "True" || raw == "TRUE":
+		f.kind = fieldBoolean
+		f.value = 1
+	case raw == "f" || raw == "F" || raw == "false" || raw == "False" || raw == "FALSE":
+		f.kind = fieldBoolean
+	default:
+		f.kind = fieldFloat
+		f.value, err = strconv.ParseFloat(raw, 64)
+		if err == nil && (math.IsNaN(f.value) || math.IsInf(f.value, 0)) {
+			err = errors.New("value isn't finite")
+		}
+	}
+	if err != nil {
+		return f, i, fmt.Errorf("%w: incorrect value %q of the field %q: %w", errIncorrectLineProtocol, raw, f.key, err)
+	}
+
+	return f, i, nil
+}
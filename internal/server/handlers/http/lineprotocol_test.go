@@ -0,0 +1,76 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	tests := []struct {
+		want    *point
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{
+			name: "tags, fields and timestamp",
+			line: "cpu,host=server01,region=eu usage_idle=92.5,usage_user=3 1700000000000000000",
+			want: &point{
+				measurement: "cpu",
+				tags:        map[string]string{"host": "server01", "region": "eu"},
+				fields: []field{
+					{key: "usage_idle", kind: fieldFloat, value: 92.5},
+					{key: "usage_user", kind: fieldFloat, value: 3},
+				},
+			},
+		},
+		{
+			name: "integer, unsigned, boolean and string fields without timestamp",
+			line: `net bytes_recv=1024i,packets=7u,up=true,iface="eth0 \"main\""`,
+			want: &point{
+				measurement: "net",
+				tags:        map[string]string{},
+				fields: []field{
+					{key: "bytes_recv", kind: fieldInteger, value: 1024, integer: 1024},
+					{key: "packets", kind: fieldInteger, value: 7, integer: 7},
+					{key: "up", kind: fieldBoolean, value: 1},
+					{key: "iface", kind: fieldString},
+				},
+			},
+		},
+		{
+			name: "escaped characters",
+			line: `disk\ io,path=/var\,log,mode\=x=rw free\ bytes=1i`,
+			want: &point{
+				measurement: "disk io",
+				tags:        map[string]string{"path": "/var,log", "mode=x": "rw"},
+				fields: []field{
+					{key: "free bytes", kind: fieldInteger, value: 1, integer: 1},
+				},
+			},
+		},
+		{name: "no fields", line: "cpu,host=a", wantErr: true},
+		{name: "no measurement", line: ",host=a value=1", wantErr: true},
+		{name: "empty tag value", line: "cpu,host= value=1", wantErr: true},
+		{name: "incorrect field value", line: "cpu value=uwu", wantErr: true},
+		{name: "non-finite field value", line: "cpu value=NaN", wantErr: true},
+		{name: "unsigned value out of range", line: "cpu value=18446744073709551615u", wantErr: true},
+		{name: "unterminated string", line: `cpu value="uwu`, wantErr: true},
+		{name: "incorrect timestamp", line: "cpu value=1 yesterday", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseLineProtocol(test.line)
+			if test.wantErr {
+				assert.ErrorIs(t, err, errIncorrectLineProtocol)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// ListRes structure for marshaling a page of the metrics list to the response body.
+type ListRes struct {
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Metrics    []MetricReqRes `json:"metrics"`
+}
+
+// list gets the metrics in JSON format.
+//
+// Optional query parameters:
+//   - type - metric type;
+//   - prefix, regex - metric name prefix and regular expression, the name doesn't include the labels;
+//   - sort - "name" (default) or "type", the "-" prefix reverses the order;
+//   - limit - page size, 100 by default and at most 1000;
+//   - cursor - "next_cursor" of the previous page, it's returned while there are more metrics.
+func (h *metricsHandler) list(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	var limit int
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, render.M{"message": fmt.Sprintf("incorrect %q parameter", "limit")})
+			return
+		}
+	}
+
+	page, err := h.metricsService.ListMetrics(entity.ListFilter{
+		MetricFilter: entity.MetricFilter{
+			MType:      query.Get("type"),
+			NamePrefix: query.Get("prefix"),
+			NameRegexp: query.Get("regex"),
+		},
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+	})
+	if errors.Is(err, entity.ErrIncorrectFilter) {
+		h.log.Info(entity.ErrIncorrectFilter.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log.Info("can't list metrics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res := ListRes{
+		Metrics:    make([]MetricReqRes, 0, len(page.Metrics)),
+		NextCursor: page.NextCursor,
+	}
+	for _, metric := range page.Metrics {
+		res.Metrics = append(res.Metrics, MetricReqRes{
+			Delta:     metric.Delta,
+			Value:     metric.Value,
+			Histogram: newHistogramReqRes(metric.Histogram),
+			Labels:    metric.Labels,
+			ID:        metric.ID,
+			MType:     metric.MType,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	render.JSON(w, r, res)
+}
@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+)
+
+func TestListHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, metric := range []struct {
+		labels map[string]string
+		mType  string
+		name   string
+		value  string
+	}{
+		{mType: entity.GaugeType, name: "Alloc", value: "10"},
+		{mType: entity.GaugeType, name: "CPUutilization", value: "12.5", labels: map[string]string{"cpu": "1"}},
+		{mType: entity.GaugeType, name: "CPUutilization", value: "7.5", labels: map[string]string{"cpu": "0"}},
+		{mType: entity.CounterType, name: "PollCount", value: "5"},
+		{mType: entity.HistogramType, name: "RequestDuration", value: "0.2"},
+		{mType: entity.CounterType, name: "Alloc", value: "3"},
+	} {
+		require.NoError(t, metricsService.UpsertMetric(metric.mType, metric.name, metric.value, metric.labels))
+	}
+
+	list := func(t *testing.T, query url.Values) (int, ListRes) {
+		t.Helper()
+
+		res, err := ts.Client().Get(ts.URL + "/values?" + query.Encode())
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		var body ListRes
+		if res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		}
+
+		return res.StatusCode, body
+	}
+
+	series := func(res ListRes) []string {
+		keys := make([]string, 0, len(res.Metrics))
+		for _, metric := range res.Metrics {
+			keys = append(keys, metric.MType+" "+entity.SeriesKey(metric.ID, metric.Labels))
+		}
+		return keys
+	}
+
+	t.Run("all metrics sorted by name", func(t *testing.T) {
+		code, res := list(t, nil)
+		require.Equal(t, http.StatusOK, code)
+
+		assert.Equal(t, []string{
+			"counter Alloc",
+			"gauge Alloc",
+			`gauge CPUutilization{cpu="0"}`,
+			`gauge CPUutilization{cpu="1"}`,
+			"counter PollCount",
+			"histogram RequestDuration",
+		}, series(res))
+		assert.Empty(t, res.NextCursor)
+
+		assert.Equal(t, int64(3), *res.Metrics[0].Delta)
+		assert.Equal(t, 10.0, *res.Metrics[1].Value)
+		require.NotNil(t, res.Metrics[5].Histogram)
+		assert.Equal(t, uint64(1), res.Metrics[5].Histogram.Count)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		code, res := list(t, url.Values{"type": {entity.GaugeType}, "prefix": {"CPU"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{`gauge CPUutilization{cpu="0"}`, `gauge CPUutilization{cpu="1"}`}, series(res))
+
+		code, res = list(t, url.Values{"regex": {"^(Alloc|Poll)"}, "sort": {"-type"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"gauge Alloc", "counter PollCount", "counter Alloc"}, series(res))
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		var pages [][]string
+		query := url.Values{"sort": {"type"}, "limit": {"4"}}
+		for {
+			code, res := list(t, query)
+			require.Equal(t, http.StatusOK, code)
+			pages = append(pages, series(res))
+
+			if res.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", res.NextCursor)
+
+			// a metric added before the cursor doesn't shift the next page
+			require.NoError(t, metricsService.UpsertMetric(entity.CounterType, "AAA", "1", nil))
+		}
+
+		assert.Equal(t, [][]string{
+			{"counter Alloc", "counter PollCount", "gauge Alloc", `gauge CPUutilization{cpu="0"}`},
+			{`gauge CPUutilization{cpu="1"}`, "histogram RequestDuration"},
+		}, pages)
+	})
+
+	t.Run("incorrect parameters", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"type": {"summary"}},
+			{"regex": {"("}},
+			{"sort": {"value"}},
+			{"limit": {"0"}},
+			{"cursor": {"not a cursor"}},
+		} {
+			code, _ := list(t, query)
+			assert.Equal(t, http.StatusBadRequest, code, query.Encode())
+		}
+
+		// the cursor of another sort order
+		_, res := list(t, url.Values{"limit": {"1"}})
+		require.NotEmpty(t, res.NextCursor)
+		code, _ := list(t, url.Values{"sort": {"-name"}, "cursor": {res.NextCursor}})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
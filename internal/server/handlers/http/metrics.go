@@ -1,11 +1,14 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,43 +19,89 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checksign"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/tlsconfig"
 	"github.com/ivas1ly/uwu-metrics/web"
 )
 
 type MetricsService interface {
-	UpsertMetric(mType, mName, mValue string) error
-	GetMetric(mType, mName string) (*int64, *float64, error)
+	UpsertMetric(mType, mName, mValue string, labels map[string]string) error
+	GetMetric(mType, mName string, labels map[string]string) (*int64, *float64, error)
 	GetAllMetrics() entity.Metrics
 	UpsertTypeMetric(metric *entity.Metric) (*entity.Metric, error)
+	UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error)
+	GetHistory(mType, mName string, labels map[string]string, from, to time.Time,
+		step time.Duration) ([]entity.HistoryPoint, error)
+	GetHistogram(mName string, labels map[string]string) (*entity.Histogram, error)
+	ListMetrics(filter entity.ListFilter) (*entity.MetricsPage, error)
+	Watch(ctx context.Context, filter entity.MetricFilter) (<-chan *entity.Metric, error)
 }
 
 type metricsHandler struct {
-	log            *zap.Logger
-	metricsService MetricsService
+	log              *zap.Logger
+	metricsService   MetricsService
+	influxRules      []InfluxRule
+	writeMiddlewares []func(http.Handler) http.Handler
+}
+
+// Option configures optional handler settings.
+type Option func(h *metricsHandler)
+
+// WithInfluxRules sets the rules for the integer fields of the InfluxDB line protocol.
+func WithInfluxRules(rules []InfluxRule) Option {
+	return func(h *metricsHandler) {
+		h.influxRules = rules
+	}
+}
+
+// WithWriteMiddlewares sets the middlewares that are applied only to the endpoints that change
+// the metrics, e.g. the write sync and idempotency ones.
+func WithWriteMiddlewares(middlewares ...func(http.Handler) http.Handler) Option {
+	return func(h *metricsHandler) {
+		h.writeMiddlewares = middlewares
+	}
 }
 
 // NewRoutes adds HTTP endpoints to work with metrics.
-func NewRoutes(router *chi.Mux, metricsService MetricsService, log *zap.Logger) {
+func NewRoutes(router *chi.Mux, metricsService MetricsService, log *zap.Logger, opts ...Option) {
 	h := &metricsHandler{
 		metricsService: metricsService,
 		log:            log.With(zap.String("handler", "metrics")),
 	}
 
+	for _, opt := range opts {
+		opt(h)
+	}
+
 	router.Get("/", h.webpage)
-	router.Route("/update", func(r chi.Router) {
-		r.Post("/", h.updateJSON)
-		r.Post("/{type}/{name}/{value}", h.updateURL)
-	})
 	router.Route("/value", func(r chi.Router) {
 		r.Post("/", h.valueJSON)
 		r.Get("/{type}/{name}", h.valueURL)
 	})
-	router.Route("/updates", func(r chi.Router) {
-		r.Post("/", h.updatesJSON)
+	router.Get("/values", h.list)
+	router.Get("/watch", h.watch)
+	router.Get("/history/{type}/{name}", h.history)
+	router.Get("/metrics", h.exposition)
+
+	router.Group(func(r chi.Router) {
+		r.Use(h.writeMiddlewares...)
+
+		r.Route("/update", func(r chi.Router) {
+			r.Post("/", h.updateJSON)
+			r.Post("/{type}/{name}/{value}", h.updateURL)
+		})
+		r.Route("/updates", func(r chi.Router) {
+			r.Post("/", h.updatesJSON)
+		})
+		r.Post("/api/v1/write", h.remoteWrite)
+		r.Post("/v1/metrics", h.otlpMetrics)
+		r.Post("/write", h.influxWrite)
 	})
 }
 
 // updateURL adds the metric specified in the URL to the storage.
+// The metric labels are passed in the query parameters, e.g. /update/gauge/CPUutilization/12.5?cpu=3.
 func (h *metricsHandler) updateURL(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
@@ -72,7 +121,12 @@ func (h *metricsHandler) updateURL(w http.ResponseWriter, r *http.Request) {
 
 	mValue := chi.URLParam(r, "value")
 
-	err := h.metricsService.UpsertMetric(mType, mName, mValue)
+	err := h.metricsService.UpsertMetric(mType, mName, mValue, queryLabels(r, nil))
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		h.log.Info("incorrect metric series", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if errors.Is(err, entity.ErrIncorrectMetricValue) {
 		h.log.Info(entity.ErrIncorrectMetricValue.Error(), zap.Error(err))
 		http.Error(w, fmt.Sprintf("%s %q", err, mValue), http.StatusBadRequest)
@@ -91,6 +145,7 @@ func (h *metricsHandler) updateURL(w http.ResponseWriter, r *http.Request) {
 }
 
 // valueURL gets the metric from the storage at the specified name in the URL.
+// The metric labels are passed in the query parameters.
 func (h *metricsHandler) valueURL(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
@@ -108,7 +163,32 @@ func (h *metricsHandler) valueURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	delta, value, err := h.metricsService.GetMetric(mType, mName)
+	labels := queryLabels(r, nil)
+
+	if mType == entity.HistogramType {
+		histogram, err := h.metricsService.GetHistogram(mName, labels)
+		if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+			h.log.Info("incorrect metric series", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newHistogramReqRes(histogram))
+		return
+	}
+
+	delta, value, err := h.metricsService.GetMetric(mType, mName, labels)
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		h.log.Info("incorrect metric series", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if errors.Is(err, entity.ErrCanNotGetMetricValue) {
 		h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
 		http.NotFound(w, r)
@@ -140,9 +220,10 @@ func (h *metricsHandler) webpage(w http.ResponseWriter, _ *http.Request) {
 	metrics := h.metricsService.GetAllMetrics()
 
 	viewMap := template.FuncMap{
-		"now":     time.Now().Format(time.RFC850),
-		"Gauge":   metrics.Gauge,
-		"Counter": metrics.Counter,
+		"now":       time.Now().Format(time.RFC850),
+		"Gauge":     metrics.Gauge,
+		"Counter":   metrics.Counter,
+		"Histogram": metrics.Histogram,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -155,11 +236,60 @@ func (h *metricsHandler) webpage(w http.ResponseWriter, _ *http.Request) {
 }
 
 // MetricReqRes structure for unmarshaling metrics from the request body.
+//
+// A metric is identified by its name and labels, metrics with the same name
+// and different labels are stored separately.
+//
+// Mode is the counter or histogram mode: "delta" (default) or "cumulative". A cumulative counter
+// delta or histogram is the running total of the agent, the server adds only the increment
+// since its last report. The gauge mode is empty or "relative", a relative gauge value is added
+// to the stored one.
 type MetricReqRes struct {
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
+	Delta     *int64            `json:"delta,omitempty"`
+	Value     *float64          `json:"value,omitempty"`
+	Histogram *HistogramReqRes  `json:"histogram,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	ID        string            `json:"id"`
+	MType     string            `json:"type"`
+	Mode      string            `json:"mode,omitempty"`
+}
+
+// HistogramReqRes structure for the histogram metric value.
+//
+// Counts has one more element than Bounds, the last one is the number of observations
+// above the last bound. A histogram metric can also be updated with a single observation
+// in the "value" field, it goes to the buckets of the stored histogram or the server's default buckets.
+type HistogramReqRes struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+func newHistogramReqRes(histogram *entity.Histogram) *HistogramReqRes {
+	if histogram == nil {
+		return nil
+	}
+
+	return &HistogramReqRes{
+		Bounds: histogram.Bounds,
+		Counts: histogram.Counts,
+		Sum:    histogram.Sum,
+		Count:  histogram.Count,
+	}
+}
+
+func (hr *HistogramReqRes) toEntity() *entity.Histogram {
+	if hr == nil {
+		return nil
+	}
+
+	return &entity.Histogram{
+		Bounds: hr.Bounds,
+		Counts: hr.Counts,
+		Sum:    hr.Sum,
+		Count:  hr.Count,
+	}
 }
 
 // updateJSON adds the metric specified in the request body to the storage.
@@ -188,11 +318,21 @@ func (h *metricsHandler) updateJSON(w http.ResponseWriter, r *http.Request) {
 	}
 
 	upserted, err := h.metricsService.UpsertTypeMetric(&entity.Metric{
-		Delta: request.Delta,
-		Value: request.Value,
-		ID:    request.ID,
-		MType: request.MType,
+		Delta:     request.Delta,
+		Value:     request.Value,
+		Histogram: request.Histogram.toEntity(),
+		Labels:    request.Labels,
+		ID:        request.ID,
+		MType:     request.MType,
+		Mode:      request.Mode,
+		Source:    RequestSource(r),
 	})
+	if errors.Is(err, entity.ErrIncorrectMetricValue) {
+		h.log.Info(entity.ErrIncorrectMetricValue.Error(), zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
 	if errors.Is(err, entity.ErrEmptyMetricValue) {
 		h.log.Info(entity.ErrEmptyMetricValue.Error(), zap.String("type", request.MType))
 		w.WriteHeader(http.StatusBadRequest)
@@ -214,10 +354,12 @@ func (h *metricsHandler) updateJSON(w http.ResponseWriter, r *http.Request) {
 	}
 
 	render.JSON(w, r, &MetricReqRes{
-		Delta: upserted.Delta,
-		Value: upserted.Value,
-		ID:    upserted.ID,
-		MType: upserted.MType,
+		Delta:     upserted.Delta,
+		Value:     upserted.Value,
+		Histogram: newHistogramReqRes(upserted.Histogram),
+		Labels:    upserted.Labels,
+		ID:        upserted.ID,
+		MType:     upserted.MType,
 	})
 
 	h.log.Info("metric saved",
@@ -226,7 +368,25 @@ func (h *metricsHandler) updateJSON(w http.ResponseWriter, r *http.Request) {
 	h.log.Debug("in storage", zap.String("metrics", fmt.Sprintf("%+v", h.metricsService.GetAllMetrics())))
 }
 
+// ItemErrorRes structure for marshaling the error of a rejected batch metric.
+type ItemErrorRes struct {
+	ID      string `json:"id"`
+	MType   string `json:"type"`
+	Message string `json:"message"`
+	Index   int    `json:"index"`
+}
+
+// BatchErrorRes structure for marshaling the errors of a rejected batch,
+// the message is the error of the first rejected metric.
+type BatchErrorRes struct {
+	Message string         `json:"message"`
+	Errors  []ItemErrorRes `json:"errors"`
+}
+
 // updatesJSON adds the array of metrics specified in the body of the request to the storage.
+//
+// The batch is applied all-or-nothing: if any metric is rejected, none of them are saved
+// and the response lists the errors of all rejected metrics.
 func (h *metricsHandler) updatesJSON(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -243,41 +403,65 @@ func (h *metricsHandler) updatesJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, metric := range request {
+	source := RequestSource(r)
+
+	var res BatchErrorRes
+	batch := make([]*entity.Metric, 0, len(request))
+	for i, metric := range request {
 		errMsg, ok := checkRequestFields(metric)
 		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, render.M{"message": strings.Join(errMsg, ", ")})
-			return
+			res.Errors = append(res.Errors, ItemErrorRes{
+				ID:      metric.ID,
+				MType:   metric.MType,
+				Message: strings.Join(errMsg, ", "),
+				Index:   i,
+			})
+			continue
 		}
 
-		_, err := h.metricsService.UpsertTypeMetric(&entity.Metric{
-			Delta: metric.Delta,
-			Value: metric.Value,
-			ID:    metric.ID,
-			MType: metric.MType,
+		batch = append(batch, &entity.Metric{
+			Delta:     metric.Delta,
+			Value:     metric.Value,
+			Histogram: metric.Histogram.toEntity(),
+			Labels:    metric.Labels,
+			ID:        metric.ID,
+			MType:     metric.MType,
+			Mode:      metric.Mode,
+			Source:    source,
 		})
-		if errors.Is(err, entity.ErrEmptyMetricValue) {
-			h.log.Info(entity.ErrEmptyMetricValue.Error(), zap.String("type", metric.MType))
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, render.M{"message": fmt.Sprintf("%s %q",
-				entity.ErrEmptyMetricValue.Error(), metric.MType)})
-			return
-		}
-		if errors.Is(err, entity.ErrUnknownMetricType) {
-			h.log.Info(entity.ErrUnknownMetricType.Error(), zap.String("type", metric.MType))
-			w.WriteHeader(http.StatusBadRequest)
-			render.JSON(w, r, render.M{"message": fmt.Sprintf("%s %q",
-				entity.ErrUnknownMetricType.Error(), metric.MType)})
-			return
-		}
-		if errors.Is(err, entity.ErrCanNotGetMetricValue) {
-			h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.String("type", metric.MType), zap.String("name", metric.ID))
+	}
+
+	if len(res.Errors) == 0 {
+		_, err = h.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			for _, item := range batchErr.Items {
+				res.Errors = append(res.Errors, ItemErrorRes{
+					ID:      item.ID,
+					MType:   item.MType,
+					Message: entity.ErrorMessage(item.Err, item.MType),
+					Index:   item.Index,
+				})
+			}
+		} else if err != nil {
+			h.log.Info("can't apply batch", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 
+	if len(res.Errors) > 0 {
+		h.log.Info("batch rejected", zap.String("source", source),
+			zap.Int("rejected", len(res.Errors)), zap.Int("total", len(request)))
+		res.Message = res.Errors[0].Message
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.log.Info("batch saved", zap.String("source", source), zap.Int("metrics", len(batch)))
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -307,7 +491,38 @@ func (h *metricsHandler) valueJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	delta, value, err := h.metricsService.GetMetric(request.MType, request.ID)
+	if request.MType == entity.HistogramType {
+		var histogram *entity.Histogram
+		histogram, err = h.metricsService.GetHistogram(request.ID, request.Labels)
+		if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+			h.log.Info("incorrect metric series", zap.Error(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, render.M{"message": err.Error()})
+			return
+		}
+		if err != nil {
+			h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, render.M{"message": err.Error()})
+			return
+		}
+
+		render.JSON(w, r, MetricReqRes{
+			Histogram: newHistogramReqRes(histogram),
+			Labels:    request.Labels,
+			ID:        request.ID,
+			MType:     request.MType,
+		})
+		return
+	}
+
+	delta, value, err := h.metricsService.GetMetric(request.MType, request.ID, request.Labels)
+	if errors.Is(err, entity.ErrIncorrectLabelName) || errors.Is(err, entity.ErrIncorrectMetricName) {
+		h.log.Info("incorrect metric series", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
 	if errors.Is(err, entity.ErrCanNotGetMetricValue) {
 		h.log.Info(entity.ErrCanNotGetMetricValue.Error(), zap.Error(err))
 		fmt.Println(err)
@@ -326,21 +541,81 @@ func (h *metricsHandler) valueJSON(w http.ResponseWriter, r *http.Request) {
 	switch request.MType {
 	case entity.GaugeType:
 		render.JSON(w, r, MetricReqRes{
-			Delta: nil,
-			Value: value,
-			ID:    request.ID,
-			MType: request.MType,
+			Delta:  nil,
+			Value:  value,
+			Labels: request.Labels,
+			ID:     request.ID,
+			MType:  request.MType,
 		})
 	case entity.CounterType:
 		render.JSON(w, r, MetricReqRes{
-			Delta: delta,
-			Value: nil,
-			ID:    request.ID,
-			MType: request.MType,
+			Delta:  delta,
+			Value:  nil,
+			Labels: request.Labels,
+			ID:     request.ID,
+			MType:  request.MType,
 		})
 	}
 }
 
+// RequestSource identifies the agent instance that sent the request by the X-Agent-Instance header
+// within the scope of its signature, its client certificate or the client address. The scope isn't set
+// by the client, so a client can't pose as another agent and reset the cumulative totals of its counters,
+// and the agents sharing an address have the separate totals.
+func RequestSource(r *http.Request) string {
+	return entity.InstanceSource(requestScope(r), r.Header.Get("X-Agent-Instance"))
+}
+
+// requestScope returns the agent ID of the signature, the identity of the client certificate
+// or the client address allowed by the address policy, if it's checked, or the remote address.
+func requestScope(r *http.Request) string {
+	if agentID := checksign.AgentID(r.Context()); agentID != "" {
+		return agentID
+	}
+
+	if identity := tlsconfig.Identity(r.TLS); identity != "" {
+		return identity
+	}
+
+	if ip := checkip.RequestIP(r.Context()); ip != nil {
+		return ip.String()
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// queryLabels gets the metric labels from the URL query parameters, except the reserved ones.
+func queryLabels(r *http.Request, reserved map[string]struct{}) map[string]string {
+	query := r.URL.Query()
+
+	labels := make(map[string]string, len(query))
+	for name, values := range query {
+		if _, ok := reserved[name]; ok || len(values) == 0 {
+			continue
+		}
+		labels[name] = values[0]
+	}
+
+	return labels
+}
+
+// counterDelta rounds the float counter sample to the delta, the stored counters are integers.
+// The cumulative totals are rounded as they are, so the rounding errors don't add up. It returns
+// false if the sample isn't finite or is out of the int64 range.
+func counterDelta(value float64) (int64, bool) {
+	rounded := math.Round(value)
+	if math.IsNaN(rounded) || rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(rounded), true
+}
+
 // checkRequestFields method for simple validation of query values.
 func checkRequestFields(request MetricReqRes) ([]string, bool) {
 	var errMsg []string
@@ -238,6 +238,46 @@ func TestMetricsHandler(t *testing.T) {
 				body:        "",
 			},
 		},
+		{
+			name:   "update with labels / gauge",
+			path:   "/update/gauge/CPUutilization/1.5?cpu=2",
+			method: http.MethodPost,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				body:        ``,
+				statusCode:  http.StatusOK,
+			},
+		},
+		{
+			name:   "get metric value with labels / gauge",
+			path:   "/value/gauge/CPUutilization?cpu=2",
+			method: http.MethodGet,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				body:        `1.5`,
+				statusCode:  http.StatusOK,
+			},
+		},
+		{
+			name:   "get metric value without labels / gauge",
+			path:   "/value/gauge/CPUutilization",
+			method: http.MethodGet,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				body:        ``,
+				statusCode:  http.StatusNotFound,
+			},
+		},
+		{
+			name:   "update with incorrect label name",
+			path:   "/update/gauge/CPUutilization/1.5?2cpu=2",
+			method: http.MethodPost,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				body:        ``,
+				statusCode:  http.StatusBadRequest,
+			},
+		},
 		{
 			name:   "get metrics webpage",
 			path:   "/",
@@ -564,6 +604,168 @@ func TestMetricsHandlerJSON(t *testing.T) {
 				statusCode:  400,
 			},
 		},
+		{
+			name:   "update histogram with bucket counts",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"histogram":{"bounds":[0.1,1],"counts":[1,2,0],"sum":1.05},"id":"latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"histogram":{"bounds":[0.1,1],"counts":[1,2,0],"sum":1.05,"count":3},"id":"latency","type":"histogram"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update histogram with a single observation",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"value":5,"id":"latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"histogram":{"bounds":[0.1,1],"counts":[1,2,1],"sum":6.05,"count":4},"id":"latency","type":"histogram"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update histogram with different bounds",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"histogram":{"bounds":[0.5],"counts":[1,0]},"id":"latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "update histogram with incorrect counts",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"histogram":{"bounds":[0.5],"counts":[1]},"id":"other latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "update histogram without value",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"id":"latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"message":"empty metric value \"histogram\""}`,
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "get histogram value",
+			path:   "/value",
+			method: http.MethodPost,
+			body:   `{"id":"latency","type":"histogram"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"histogram":{"bounds":[0.1,1],"counts":[1,2,1],"sum":6.05,"count":4},"id":"latency","type":"histogram"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update with labels / gauge",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"value":12.5,"labels":{"host":"a","cpu":"3"},"id":"CPUutilization","type":"gauge"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"value":12.5,"labels":{"cpu":"3","host":"a"},"id":"CPUutilization","type":"gauge"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "value with labels / gauge",
+			path:   "/value",
+			method: http.MethodPost,
+			body:   `{"labels":{"cpu":"3","host":"a"},"id":"CPUutilization","type":"gauge"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"value":12.5,"labels":{"cpu":"3","host":"a"},"id":"CPUutilization","type":"gauge"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "value with other labels / gauge",
+			path:   "/value",
+			method: http.MethodPost,
+			body:   `{"labels":{"cpu":"4","host":"a"},"id":"CPUutilization","type":"gauge"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  404,
+			},
+		},
+		{
+			name:   "update with incorrect label name",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"value":12.5,"labels":{"cpu-3":"3"},"id":"CPUutilization","type":"gauge"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"message":"incorrect metric value: incorrect label name \"cpu-3\""}`,
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "update cumulative counter, first report",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"delta":5,"id":"PollCount","type":"counter","mode":"cumulative"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"delta":5,"id":"PollCount","type":"counter"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update cumulative counter, increment",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"delta":8,"id":"PollCount","type":"counter","mode":"cumulative"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"delta":8,"id":"PollCount","type":"counter"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update cumulative counter, reset",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"delta":2,"id":"PollCount","type":"counter","mode":"cumulative"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"delta":10,"id":"PollCount","type":"counter"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update delta counter after cumulative",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"delta":1,"id":"PollCount","type":"counter","mode":"delta"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"delta":11,"id":"PollCount","type":"counter"}`,
+				statusCode:  200,
+			},
+		},
+		{
+			name:   "update counter with unknown mode",
+			path:   "/update",
+			method: http.MethodPost,
+			body:   `{"delta":1,"id":"PollCount","type":"counter","mode":"uwu"}`,
+			want: want{
+				contentType: "application/json",
+				body:        `{"message":"incorrect metric value: unknown counter mode \"uwu\""}`,
+				statusCode:  400,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -627,8 +829,9 @@ func TestMetricsUpdatesHandlerJSON(t *testing.T) {
 {"value": 789.456,"id": "my gauge","type": "gauge"}]`,
 			want: want{
 				contentType: "application/json",
-				body:        `{"message":"unknown metric type \"abc\""}`,
-				statusCode:  400,
+				body: `{"message":"unknown metric type \"abc\"","errors":[` +
+					`{"id":"my counter","type":"abc","message":"unknown metric type \"abc\"","index":0}]}`,
+				statusCode: 400,
 			},
 		},
 		{
@@ -639,8 +842,9 @@ func TestMetricsUpdatesHandlerJSON(t *testing.T) {
 {"value": 789.456,"id": "my gauge","type": "gauge"}]`,
 			want: want{
 				contentType: "application/json",
-				body:        `{"message":"field \"id\" is required"}`,
-				statusCode:  400,
+				body: `{"message":"field \"id\" is required","errors":[` +
+					`{"id":"","type":"abc","message":"field \"id\" is required","index":0}]}`,
+				statusCode: 400,
 			},
 		},
 		{
@@ -651,8 +855,48 @@ func TestMetricsUpdatesHandlerJSON(t *testing.T) {
 {"value": 789.456,"id": "my gauge","type": "gauge"}]`,
 			want: want{
 				contentType: "application/json",
-				body:        `{"message":"field \"type\" is required, field \"id\" is required"}`,
-				statusCode:  400,
+				body: `{"message":"field \"type\" is required, field \"id\" is required","errors":[` +
+					`{"id":"","type":"","message":"field \"type\" is required, field \"id\" is required","index":0}]}`,
+				statusCode: 400,
+			},
+		},
+		{
+			name:   "updates with an incorrect metric are not applied",
+			path:   "/updates",
+			method: http.MethodPost,
+			body: `[{"delta": 1,"id": "partial counter","type": "counter"},
+{"id": "partial gauge","type": "gauge"},
+{"value": 1,"id": "partial gauge","type": "abc"}]`,
+			want: want{
+				contentType: "application/json",
+				body: `{"message":"empty metric value \"gauge\"","errors":[` +
+					`{"id":"partial gauge","type":"gauge","message":"empty metric value \"gauge\"","index":1},` +
+					`{"id":"partial gauge","type":"abc","message":"unknown metric type \"abc\"","index":2}]}`,
+				statusCode: 400,
+			},
+		},
+		{
+			name:   "value of the rejected batch metric",
+			path:   "/value",
+			method: http.MethodPost,
+			body:   `{"id": "partial counter","type": "counter"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  404,
+			},
+		},
+		{
+			name:   "updates with different histogram bounds in a batch",
+			path:   "/updates",
+			method: http.MethodPost,
+			body: `[{"histogram":{"bounds":[1],"counts":[1,0]},"id":"batch latency","type":"histogram"},
+{"histogram":{"bounds":[2],"counts":[1,0]},"id":"batch latency","type":"histogram"}]`,
+			want: want{
+				contentType: "application/json",
+				body: `{"message":"incorrect metric value: histogram bounds [2] don't match the stored bounds [1]","errors":[` +
+					`{"id":"batch latency","type":"histogram",` +
+					`"message":"incorrect metric value: histogram bounds [2] don't match the stored bounds [1]","index":1}]}`,
+				statusCode: 400,
 			},
 		},
 		{
@@ -712,14 +956,16 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io
 }
 
 type testStorage struct {
-	gauge   map[string]float64
-	counter map[string]int64
+	gauge     map[string]float64
+	counter   map[string]int64
+	histogram map[string]entity.Histogram
 }
 
 func NewTestStorage() memory.Storage {
 	return &testStorage{
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
+		gauge:     make(map[string]float64),
+		counter:   make(map[string]int64),
+		histogram: make(map[string]entity.Histogram),
 	}
 }
 
@@ -731,13 +977,27 @@ func (ts *testStorage) UpdateCounter(name string, value int64) {
 	ts.counter[name] += value
 }
 
+func (ts *testStorage) UpdateHistogram(name string, value entity.Histogram) error {
+	stored, ok := ts.histogram[name]
+	if !ok {
+		ts.histogram[name] = value.Clone()
+		return nil
+	}
+	if err := stored.Merge(value); err != nil {
+		return err
+	}
+	ts.histogram[name] = stored
+	return nil
+}
+
 func (ts *testStorage) GetMetrics() entity.Metrics {
-	return entity.Metrics{Counter: ts.counter, Gauge: ts.gauge}
+	return entity.Metrics{Counter: ts.counter, Gauge: ts.gauge, Histogram: ts.histogram}
 }
 
 func (ts *testStorage) SetMetrics(metrics entity.Metrics) {
 	ts.counter = metrics.Counter
 	ts.gauge = metrics.Gauge
+	ts.histogram = metrics.Histogram
 }
 
 func (ts *testStorage) GetCounter(name string) (int64, error) {
@@ -755,3 +1015,65 @@ func (ts *testStorage) GetGauge(name string) (float64, error) {
 	}
 	return gauge, nil
 }
+
+func (ts *testStorage) GetHistogram(name string) (entity.Histogram, error) {
+	histogram, ok := ts.histogram[name]
+	if !ok {
+		return entity.Histogram{}, fmt.Errorf("histogram metric %q doesn't exist", name)
+	}
+	return histogram.Clone(), nil
+}
+
+func (ts *testStorage) Transaction(fn func(tx memory.Tx) error) error {
+	return fn(ts)
+}
+
+func TestCumulativeCountersOfAgentInstances(t *testing.T) {
+	router := chi.NewRouter()
+	NewRoutes(router, service.NewMetricsService(memory.NewMemStorage()), zap.NewNop())
+
+	report := func(instanceID string, total int64) string {
+		body := fmt.Sprintf(`[{"delta":%d,"id":"PollCount","type":"counter","mode":"cumulative"}]`, total)
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		// the agents are behind the same address
+		req.RemoteAddr = "10.0.0.1:4242"
+		req.Header.Set("X-Agent-Instance", instanceID)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		req = httptest.NewRequest(http.MethodGet, "/value/counter/PollCount", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "100", report("a", 100))
+	// the first total of another instance is its own increment, not a reset of the first one
+	assert.Equal(t, "110", report("b", 10))
+	assert.Equal(t, "115", report("a", 105))
+	assert.Equal(t, "117", report("b", 12))
+}
+
+func TestWriteMiddlewares(t *testing.T) {
+	var applied []string
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			applied = append(applied, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router := chi.NewRouter()
+	NewRoutes(router, service.NewMetricsService(memory.NewMemStorage()), zap.NewNop(),
+		WithWriteMiddlewares(middleware))
+
+	for _, path := range []string{"/update/gauge/uwu/1", "/value/", "/updates/"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`[]`))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, []string{"/update/gauge/uwu/1", "/updates/"}, applied)
+}
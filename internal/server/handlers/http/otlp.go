@@ -0,0 +1,430 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/pkg/api/otlp"
+)
+
+const (
+	protobufContentType = "application/x-protobuf"
+	jsonContentType     = "application/json"
+)
+
+// otlpMetrics receives the metrics exported with OTLP/HTTP in the protobuf or JSON encoding.
+//
+// Gauge and Sum data points are saved as gauges and counters, a monotonic Sum is a counter
+// and a non-monotonic cumulative Sum is a gauge. The stored counters are integers, so the double
+// data points of a monotonic Sum are rounded. The rounded cumulative totals don't add up
+// the rounding errors, but the fractions of the delta double sums are lost. Histogram data
+// points are saved as histograms. Cumulative sums and histograms are saved in the cumulative mode.
+//
+// The data points that can't be converted or saved are reported as rejected in the partial
+// success response, the other ones are saved. Errors are returned as a google.rpc.Status
+// in the request encoding.
+func (h *metricsHandler) otlpMetrics(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == jsonContentType
+	if !isJSON && mediaType != protobufContentType {
+		h.otlpError(w, http.StatusUnsupportedMediaType, false, codes.InvalidArgument,
+			fmt.Sprintf("unsupported content type %q", mediaType))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBodySize))
+	if err != nil {
+		h.otlpError(w, http.StatusBadRequest, isJSON, codes.InvalidArgument, "can't read body")
+		return
+	}
+
+	var request otlp.ExportMetricsServiceRequest
+	if isJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, &request)
+	} else {
+		err = proto.Unmarshal(body, &request)
+	}
+	if err != nil {
+		h.otlpError(w, http.StatusBadRequest, isJSON, codes.InvalidArgument, "can't parse request body")
+		return
+	}
+
+	batch, rejected := otlpBatch(&request, RequestSource(r))
+
+	// the rejected data points are excluded from the batch and the rest of it is applied again,
+	// each attempt rejects at least one data point
+	for len(batch) > 0 {
+		_, err = h.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			excluded := make(map[int]struct{}, len(batchErr.Items))
+			for _, item := range batchErr.Items {
+				excluded[item.Index] = struct{}{}
+				rejected.RejectedDataPoints++
+				if rejected.ErrorMessage == "" {
+					rejected.ErrorMessage = fmt.Sprintf("metric %q: %s", batch[item.Index].ID,
+						entity.ErrorMessage(item.Err, item.MType))
+				}
+			}
+
+			n := 0
+			for i := range batch {
+				if _, ok := excluded[i]; !ok {
+					batch[n] = batch[i]
+					n++
+				}
+			}
+			batch = batch[:n]
+			continue
+		}
+		if err != nil {
+			h.log.Info("can't apply OTLP batch", zap.Error(err))
+			h.otlpError(w, http.StatusInternalServerError, isJSON, codes.Internal, "can't apply batch")
+			return
+		}
+		break
+	}
+
+	response := &otlp.ExportMetricsServiceResponse{}
+	if rejected.RejectedDataPoints > 0 {
+		h.log.Info("OTLP data points rejected", zap.Int64("rejected", rejected.RejectedDataPoints),
+			zap.String("reason", rejected.ErrorMessage))
+		response.PartialSuccess = rejected
+	}
+
+	h.log.Info("OTLP data points saved", zap.Int("saved", len(batch)))
+
+	h.writeOTLP(w, http.StatusOK, isJSON, response)
+}
+
+// otlpError writes the error status in the request encoding.
+func (h *metricsHandler) otlpError(w http.ResponseWriter, statusCode int, isJSON bool, code codes.Code,
+	message string) {
+	h.writeOTLP(w, statusCode, isJSON, &spb.Status{
+		Code:    int32(code),
+		Message: message,
+	})
+}
+
+func (h *metricsHandler) writeOTLP(w http.ResponseWriter, statusCode int, isJSON bool, message proto.Message) {
+	var (
+		body []byte
+		err  error
+	)
+	if isJSON {
+		w.Header().Set("Content-Type", jsonContentType)
+		body, err = protojson.Marshal(message)
+	} else {
+		w.Header().Set("Content-Type", protobufContentType)
+		body, err = proto.Marshal(message)
+	}
+	if err != nil {
+		h.log.Info("can't marshal OTLP response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+	if _, err = w.Write(body); err != nil {
+		h.log.Info("can't write OTLP response", zap.Error(err))
+	}
+}
+
+// otlpBatch converts the data points to metrics, the data points that can't be converted
+// are counted as rejected.
+func otlpBatch(request *otlp.ExportMetricsServiceRequest, source string) ([]*entity.Metric,
+	*otlp.ExportMetricsPartialSuccess) {
+	var batch []*entity.Metric
+	rejected := &otlp.ExportMetricsPartialSuccess{}
+
+	for _, rm := range request.ResourceMetrics {
+		resource := resourceLabels(rm.GetResource())
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics, err := otlpMetric(m, resource, source)
+				if err != nil {
+					rejected.RejectedDataPoints += int64(dataPoints(m))
+					if rejected.ErrorMessage == "" {
+						rejected.ErrorMessage = fmt.Sprintf("metric %q: %s", m.Name, err)
+					}
+					continue
+				}
+				batch = append(batch, metrics...)
+			}
+		}
+	}
+
+	return batch, rejected
+}
+
+// otlpMetric converts the data points of the metric, the data points without a recorded value are skipped.
+func otlpMetric(m *otlp.Metric, resource map[string]string, source string) ([]*entity.Metric, error) {
+	var metrics []*entity.Metric
+
+	switch data := m.Data.(type) {
+	case *otlp.Metric_Gauge:
+		for _, point := range data.Gauge.DataPoints {
+			if noRecordedValue(point.Flags) {
+				continue
+			}
+
+			value := numberValue(point)
+			metrics = append(metrics, &entity.Metric{
+				Value:  &value,
+				Labels: pointLabels(resource, point.Attributes),
+				ID:     m.Name,
+				MType:  entity.GaugeType,
+			})
+		}
+	case *otlp.Metric_Sum:
+		mode, err := temporalityMode(data.Sum.AggregationTemporality)
+		if err != nil {
+			return nil, err
+		}
+		if !data.Sum.IsMonotonic && mode != entity.CounterModeCumulative {
+			return nil, errors.New("non-monotonic delta sum isn't supported")
+		}
+
+		for _, point := range data.Sum.DataPoints {
+			if noRecordedValue(point.Flags) {
+				continue
+			}
+
+			metric := &entity.Metric{
+				Labels: pointLabels(resource, point.Attributes),
+				ID:     m.Name,
+				MType:  entity.GaugeType,
+			}
+
+			value := numberValue(point)
+			if data.Sum.IsMonotonic {
+				delta, ok := counterDelta(value)
+				if asInt, isInt := point.Value.(*otlp.NumberDataPoint_AsInt); isInt {
+					delta, ok = asInt.AsInt, true
+				}
+				if !ok {
+					return nil, fmt.Errorf("counter value %g is out of range", value)
+				}
+
+				metric.MType = entity.CounterType
+				metric.Delta = &delta
+				metric.Mode = mode
+				metric.Source = source
+			} else {
+				metric.Value = &value
+			}
+
+			metrics = append(metrics, metric)
+		}
+	case *otlp.Metric_Histogram:
+		mode, err := temporalityMode(data.Histogram.AggregationTemporality)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, point := range data.Histogram.DataPoints {
+			if noRecordedValue(point.Flags) {
+				continue
+			}
+
+			metrics = append(metrics, &entity.Metric{
+				Histogram: histogramValue(point),
+				Labels:    pointLabels(resource, point.Attributes),
+				ID:        m.Name,
+				MType:     entity.HistogramType,
+				Mode:      mode,
+				Source:    source,
+			})
+		}
+	case *otlp.Metric_ExponentialHistogram:
+		return nil, errors.New("exponential histogram isn't supported")
+	case *otlp.Metric_Summary:
+		return nil, errors.New("summary isn't supported")
+	}
+
+	return metrics, nil
+}
+
+func temporalityMode(temporality otlp.AggregationTemporality) (string, error) {
+	switch temporality {
+	case otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return entity.CounterModeDelta, nil
+	case otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return entity.CounterModeCumulative, nil
+	default:
+		return "", errors.New("unspecified aggregation temporality")
+	}
+}
+
+func dataPoints(m *otlp.Metric) int {
+	switch data := m.Data.(type) {
+	case *otlp.Metric_Gauge:
+		return len(data.Gauge.DataPoints)
+	case *otlp.Metric_Sum:
+		return len(data.Sum.DataPoints)
+	case *otlp.Metric_Histogram:
+		return len(data.Histogram.DataPoints)
+	case *otlp.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.DataPoints)
+	case *otlp.Metric_Summary:
+		return len(data.Summary.DataPoints)
+	default:
+		return 0
+	}
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(otlp.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func numberValue(point *otlp.NumberDataPoint) float64 {
+	if value, ok := point.Value.(*otlp.NumberDataPoint_AsInt); ok {
+		return float64(value.AsInt)
+	}
+
+	return point.GetAsDouble()
+}
+
+// histogramValue converts the data point to a histogram, a data point without buckets
+// has a single +Inf bucket.
+func histogramValue(point *otlp.HistogramDataPoint) *entity.Histogram {
+	histogram := &entity.Histogram{
+		Bounds: point.ExplicitBounds,
+		Counts: point.BucketCounts,
+		Sum:    point.GetSum(),
+		Count:  point.Count,
+	}
+	if len(histogram.Counts) == 0 {
+		histogram.Bounds = nil
+		histogram.Counts = []uint64{point.Count}
+	}
+
+	return histogram
+}
+
+// resourceLabels converts the resource attributes to the job and instance labels,
+// as the other resource attributes are the same for all series of the resource
+// they are not added to the labels.
+func resourceLabels(resource *otlp.Resource) map[string]string {
+	var namespace, name, instance string
+	for _, attr := range resource.GetAttributes() {
+		switch attr.Key {
+		case "service.namespace":
+			namespace = attributeValue(attr.Value)
+		case "service.name":
+			name = attributeValue(attr.Value)
+		case "service.instance.id":
+			instance = attributeValue(attr.Value)
+		}
+	}
+
+	labels := make(map[string]string, 2)
+	if name != "" {
+		labels["job"] = name
+		if namespace != "" {
+			labels["job"] = namespace + "/" + name
+		}
+	}
+	if instance != "" {
+		labels["instance"] = instance
+	}
+
+	return labels
+}
+
+// pointLabels merges the resource labels and the data point attributes, the attribute keys
+// are sanitized to be valid label names.
+func pointLabels(resource map[string]string, attributes []*otlp.KeyValue) map[string]string {
+	labels := make(map[string]string, len(resource)+len(attributes))
+	for name, value := range resource {
+		labels[name] = value
+	}
+	for _, attr := range attributes {
+		if attr.Key == "" {
+			continue
+		}
+		labels[sanitizeLabelName(attr.Key)] = attributeValue(attr.Value)
+	}
+
+	return labels
+}
+
+// sanitizeLabelName replaces the characters that aren't allowed in a label name with underscores,
+// e.g. "http.method" is converted to "http_method".
+func sanitizeLabelName(name string) string {
+	var sb strings.Builder
+	if name[0] >= '0' && name[0] <= '9' {
+		sb.WriteString("key_")
+	}
+
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteByte('_')
+	}
+
+	return sb.String()
+}
+
+// attributeValue converts the attribute value to the label value,
+// arrays and key-value lists are encoded to JSON.
+func attributeValue(value *otlp.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *otlp.AnyValue_StringValue:
+		return v.StringValue
+	case *otlp.AnyValue_ArrayValue, *otlp.AnyValue_KvlistValue:
+		encoded, err := json.Marshal(anyValue(value))
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(anyValue(value))
+	}
+}
+
+func anyValue(value *otlp.AnyValue) any {
+	switch v := value.GetValue().(type) {
+	case *otlp.AnyValue_StringValue:
+		return v.StringValue
+	case *otlp.AnyValue_BoolValue:
+		return v.BoolValue
+	case *otlp.AnyValue_IntValue:
+		return v.IntValue
+	case *otlp.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *otlp.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *otlp.AnyValue_ArrayValue:
+		values := make([]any, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, anyValue(item))
+		}
+		return values
+	case *otlp.AnyValue_KvlistValue:
+		values := make(map[string]any, len(v.KvlistValue.GetValues()))
+		for _, item := range v.KvlistValue.GetValues() {
+			values[item.Key] = anyValue(item.Value)
+		}
+		return values
+	default:
+		return ""
+	}
+}
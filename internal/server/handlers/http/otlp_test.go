@@ -0,0 +1,246 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/pkg/api/otlp"
+)
+
+func TestOTLPHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(t *testing.T, contentType string, body []byte) (int, string, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/metrics", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+
+		return res.StatusCode, res.Header.Get("Content-Type"), resBody
+	}
+
+	str := func(key, value string) *otlp.KeyValue {
+		return &otlp.KeyValue{Key: key, Value: &otlp.AnyValue{Value: &otlp.AnyValue_StringValue{StringValue: value}}}
+	}
+
+	request := func(total int64, buckets []uint64) *otlp.ExportMetricsServiceRequest {
+		var count uint64
+		for _, bucket := range buckets {
+			count += bucket
+		}
+		sum := float64(count) * 0.2
+
+		return &otlp.ExportMetricsServiceRequest{
+			ResourceMetrics: []*otlp.ResourceMetrics{{
+				Resource: &otlp.Resource{Attributes: []*otlp.KeyValue{
+					str("service.name", "checkout"),
+					str("service.instance.id", "pod-1"),
+					str("host.name", "node-1"),
+				}},
+				ScopeMetrics: []*otlp.ScopeMetrics{{
+					Scope: &otlp.InstrumentationScope{Name: "checkout"},
+					Metrics: []*otlp.Metric{
+						{Name: "queue.size", Data: &otlp.Metric_Gauge{Gauge: &otlp.Gauge{
+							DataPoints: []*otlp.NumberDataPoint{{Value: &otlp.NumberDataPoint_AsInt{AsInt: 12}}},
+						}}},
+						{Name: "http.server.requests", Data: &otlp.Metric_Sum{Sum: &otlp.Sum{
+							AggregationTemporality: otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							IsMonotonic:            true,
+							DataPoints: []*otlp.NumberDataPoint{{
+								Attributes: []*otlp.KeyValue{str("http.method", "GET")},
+								Value:      &otlp.NumberDataPoint_AsInt{AsInt: total},
+							}},
+						}}},
+						{Name: "active.connections", Data: &otlp.Metric_Sum{Sum: &otlp.Sum{
+							AggregationTemporality: otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints:             []*otlp.NumberDataPoint{{Value: &otlp.NumberDataPoint_AsDouble{AsDouble: 3}}},
+						}}},
+						{Name: "http.server.duration", Data: &otlp.Metric_Histogram{Histogram: &otlp.Histogram{
+							AggregationTemporality: otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*otlp.HistogramDataPoint{{
+								Count:          count,
+								Sum:            &sum,
+								BucketCounts:   buckets,
+								ExplicitBounds: []float64{0.1, 1},
+							}},
+						}}},
+						{Name: "http.server.latency", Data: &otlp.Metric_Summary{Summary: &otlp.Summary{
+							DataPoints: []*otlp.SummaryDataPoint{{}},
+						}}},
+					},
+				}},
+			}},
+		}
+	}
+
+	labels := map[string]string{"job": "checkout", "instance": "pod-1"}
+
+	t.Run("protobuf", func(t *testing.T) {
+		for _, r := range []*otlp.ExportMetricsServiceRequest{
+			request(10, []uint64{1, 2, 0}),
+			request(15, []uint64{2, 3, 1}),
+		} {
+			body, err := proto.Marshal(r)
+			require.NoError(t, err)
+
+			status, contentType, resBody := post(t, "application/x-protobuf", body)
+			require.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "application/x-protobuf", contentType)
+
+			var response otlp.ExportMetricsServiceResponse
+			require.NoError(t, proto.Unmarshal(resBody, &response))
+			assert.Equal(t, int64(1), response.GetPartialSuccess().GetRejectedDataPoints())
+			assert.Contains(t, response.GetPartialSuccess().GetErrorMessage(), "summary isn't supported")
+		}
+
+		_, size, err := metricsService.GetMetric(entity.GaugeType, "queue.size", labels)
+		require.NoError(t, err)
+		assert.Equal(t, 12.0, *size)
+
+		// the cumulative totals aren't summed up
+		requests, _, err := metricsService.GetMetric(entity.CounterType, "http.server.requests",
+			map[string]string{"job": "checkout", "instance": "pod-1", "http_method": "GET"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(15), *requests)
+
+		_, connections, err := metricsService.GetMetric(entity.GaugeType, "active.connections", labels)
+		require.NoError(t, err)
+		assert.Equal(t, 3.0, *connections)
+
+		histogram, err := metricsService.GetHistogram("http.server.duration", labels)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{2, 3, 1}, histogram.Counts)
+		assert.Equal(t, uint64(6), histogram.Count)
+		assert.InDelta(t, 1.2, histogram.Sum, 1e-9)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		body := `{"resourceMetrics":[{"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"checkout"}},
+			{"key":"service.instance.id","value":{"stringValue":"pod-1"}}]},
+			"scopeMetrics":[{"scope":{"name":"checkout"},"metrics":[
+			{"name":"orders","unit":"1","sum":{"aggregationTemporality":1,"isMonotonic":true,
+			"dataPoints":[{"asInt":"7","timeUnixNano":"1700000000000000000",
+			"attributes":[{"key":"region","value":{"stringValue":"eu"}}]}]}}]}]}]}`
+
+		for i := 0; i < 2; i++ {
+			status, contentType, resBody := post(t, "application/json", []byte(body))
+			require.Equal(t, http.StatusOK, status)
+			assert.Equal(t, "application/json", contentType)
+			assert.Equal(t, "{}", string(resBody))
+		}
+
+		// the delta sum is added on every export
+		orders, _, err := metricsService.GetMetric(entity.CounterType, "orders",
+			map[string]string{"job": "checkout", "instance": "pod-1", "region": "eu"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(14), *orders)
+	})
+
+	t.Run("rejected data points", func(t *testing.T) {
+		body := `{"resourceMetrics":[{"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"checkout"}},
+			{"key":"service.instance.id","value":{"stringValue":"pod-1"}}]},
+			"scopeMetrics":[{"metrics":[
+			{"name":"accepted.gauge","gauge":{"dataPoints":[{"asDouble":1}]}},
+			{"name":"http.server.duration","histogram":{"aggregationTemporality":2,
+			"dataPoints":[{"count":"1","sum":1,"bucketCounts":["1","0"],"explicitBounds":[5]}]}}]}]}]}`
+
+		status, _, resBody := post(t, "application/json", []byte(body))
+		require.Equal(t, http.StatusOK, status)
+
+		var response otlp.ExportMetricsServiceResponse
+		require.NoError(t, protojson.Unmarshal(resBody, &response))
+		assert.Equal(t, int64(1), response.GetPartialSuccess().GetRejectedDataPoints())
+		assert.Contains(t, response.GetPartialSuccess().GetErrorMessage(), "histogram bounds")
+
+		// the valid data points of the export are saved
+		_, accepted, err := metricsService.GetMetric(entity.GaugeType, "accepted.gauge", labels)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, *accepted)
+	})
+
+	t.Run("double sum", func(t *testing.T) {
+		body := func(total float64) []byte {
+			return []byte(fmt.Sprintf(`{"resourceMetrics":[{"resource":{"attributes":[
+				{"key":"service.name","value":{"stringValue":"checkout"}},
+				{"key":"service.instance.id","value":{"stringValue":"pod-1"}}]},
+				"scopeMetrics":[{"metrics":[{"name":"process.cpu.time","sum":{"aggregationTemporality":2,
+				"isMonotonic":true,"dataPoints":[{"asDouble":%g}]}}]}]}]}`, total))
+		}
+
+		cpuTime := func(t *testing.T, total float64) int64 {
+			t.Helper()
+
+			status, _, _ := post(t, "application/json", body(total))
+			require.Equal(t, http.StatusOK, status)
+
+			cpu, _, err := metricsService.GetMetric(entity.CounterType, "process.cpu.time", labels)
+			require.NoError(t, err)
+			return *cpu
+		}
+
+		// the double sum is saved as the counter, the cumulative totals are rounded,
+		// so the rounding errors don't add up
+		assert.Equal(t, int64(0), cpuTime(t, 0.25))
+		assert.Equal(t, int64(1), cpuTime(t, 0.75))
+		assert.Equal(t, int64(3), cpuTime(t, 2.6))
+
+		_, _, err := metricsService.GetMetric(entity.GaugeType, "process.cpu.time", labels)
+		assert.Error(t, err)
+	})
+
+	t.Run("double sum out of range", func(t *testing.T) {
+		body := []byte(`{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"huge.sum",
+			"sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asDouble":1e300}]}}]}]}]}`)
+
+		status, _, resBody := post(t, "application/json", body)
+		require.Equal(t, http.StatusOK, status)
+		assert.Contains(t, string(resBody), `"rejectedDataPoints":"1"`)
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		status, contentType, resBody := post(t, "text/plain", []byte("orders 1"))
+		require.Equal(t, http.StatusUnsupportedMediaType, status)
+		assert.Equal(t, "application/x-protobuf", contentType)
+
+		var response spb.Status
+		require.NoError(t, proto.Unmarshal(resBody, &response))
+		assert.Equal(t, int32(codes.InvalidArgument), response.Code)
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		status, _, _ := post(t, "application/json", []byte(`{"resourceMetrics":`))
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
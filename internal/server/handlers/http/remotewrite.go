@@ -0,0 +1,177 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/golang/snappy"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/pkg/api/prompb"
+)
+
+const (
+	// maxPushBodySize limits the body of the requests pushed by Prometheus and OpenTelemetry.
+	maxPushBodySize = 32 << 20
+	metricNameLabel = "__name__"
+	// staleNaN is the value Prometheus writes to mark the series as stale.
+	staleNaN = 0x7ff0000000000002
+)
+
+// remoteWrite receives the samples pushed by Prometheus with the remote write protocol,
+// the body is a snappy-compressed protobuf WriteRequest.
+//
+// The last sample of each series is saved. A series is a counter if the metadata says so or,
+// without metadata, if its name ends with "_total", otherwise it's a gauge. Counters are
+// cumulative in Prometheus, so they are saved in the cumulative mode with the value rounded
+// to an integer. Stale markers and other non-finite samples are skipped.
+func (h *metricsHandler) remoteWrite(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "snappy" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		render.JSON(w, r, render.M{"message": fmt.Sprintf("unsupported content encoding %q", encoding)})
+		return
+	}
+
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPushBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": "can't read body"})
+		return
+	}
+
+	// the decoded length is declared in the payload, so it's checked before the buffer is allocated
+	decodedLen, err := snappy.DecodedLen(compressed)
+	if err == nil && decodedLen > maxPushBodySize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		render.JSON(w, r, render.M{"message": "decompressed body is too large"})
+		return
+	}
+
+	var body []byte
+	if err == nil {
+		body, err = snappy.Decode(nil, compressed)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": "can't decompress"})
+		return
+	}
+
+	var request prompb.WriteRequest
+	if err = proto.Unmarshal(body, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": "can't parse request body"})
+		return
+	}
+
+	batch, err := remoteWriteMetrics(&request, RequestSource(r))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
+
+	_, err = h.metricsService.UpsertTypeMetrics(batch)
+
+	var batchErr *entity.BatchError
+	if errors.As(err, &batchErr) {
+		h.log.Info("remote write batch rejected", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": batchErr.Error()})
+		return
+	}
+	if err != nil {
+		h.log.Info("can't apply remote write batch", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.log.Info("remote write samples saved", zap.Int("series", len(batch)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remoteWriteMetrics converts the last sample of each series to a metric.
+func remoteWriteMetrics(request *prompb.WriteRequest, source string) ([]*entity.Metric, error) {
+	counters := make(map[string]bool, len(request.Metadata))
+	for _, metadata := range request.Metadata {
+		counters[metadata.MetricFamilyName] = metadata.Type == prompb.MetricMetadata_COUNTER
+	}
+
+	metrics := make([]*entity.Metric, 0, len(request.Timeseries))
+	for i, ts := range request.Timeseries {
+		var name string
+		labels := make(map[string]string, len(ts.Labels))
+		for _, label := range ts.Labels {
+			if label.Name == metricNameLabel {
+				name = label.Value
+				continue
+			}
+			labels[label.Name] = label.Value
+		}
+		if name == "" {
+			return nil, fmt.Errorf("series %d has no %s label", i, metricNameLabel)
+		}
+
+		sample := lastSample(ts.Samples)
+		if sample == nil {
+			continue
+		}
+
+		counter, ok := counters[name]
+		if !ok {
+			counter, ok = counters[strings.TrimSuffix(name, "_total")]
+		}
+		if !ok {
+			counter = strings.HasSuffix(name, "_total")
+		}
+
+		metric := &entity.Metric{
+			Labels: labels,
+			ID:     name,
+			MType:  entity.GaugeType,
+		}
+		if counter {
+			delta, ok := counterDelta(sample.Value)
+			if !ok {
+				return nil, fmt.Errorf("series %d: counter value %g is out of range", i, sample.Value)
+			}
+			metric.MType = entity.CounterType
+			metric.Delta = &delta
+			metric.Mode = entity.CounterModeCumulative
+			metric.Source = source
+		} else {
+			value := sample.Value
+			metric.Value = &value
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+// lastSample returns the finite sample with the latest timestamp, stale markers are skipped.
+func lastSample(samples []*prompb.Sample) *prompb.Sample {
+	var last *prompb.Sample
+	for _, sample := range samples {
+		if math.Float64bits(sample.Value) == staleNaN ||
+			math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		if last == nil || sample.Timestamp >= last.Timestamp {
+			last = sample
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/pkg/api/prompb"
+)
+
+func TestRemoteWriteHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	write := func(t *testing.T, body []byte) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/write", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	encode := func(t *testing.T, request *prompb.WriteRequest) []byte {
+		t.Helper()
+
+		body, err := proto.Marshal(request)
+		require.NoError(t, err)
+
+		return snappy.Encode(nil, body)
+	}
+
+	instance := map[string]string{"instance": "localhost:9090", "job": "prometheus"}
+
+	t.Run("recorded payload", func(t *testing.T) {
+		body, err := os.ReadFile("testdata/remote_write.snappy")
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNoContent, write(t, body))
+
+		_, up, err := metricsService.GetMetric(entity.GaugeType, "up", instance)
+		require.NoError(t, err)
+		assert.Equal(t, 1.0, *up)
+
+		// the stale marker is skipped, the previous sample is saved
+		_, goroutines, err := metricsService.GetMetric(entity.GaugeType, "go_goroutines", instance)
+		require.NoError(t, err)
+		assert.Equal(t, 37.0, *goroutines)
+
+		// the counter type comes from the _total suffix, the last sample wins
+		requests, _, err := metricsService.GetMetric(entity.CounterType, "prometheus_http_requests_total",
+			map[string]string{"code": "200", "handler": "/metrics", "instance": "localhost:9090", "job": "prometheus"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), *requests)
+
+		// the counter type comes from the metadata, the value is rounded
+		cpu, _, err := metricsService.GetMetric(entity.CounterType, "process_cpu_seconds", instance)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *cpu)
+	})
+
+	t.Run("cumulative counter", func(t *testing.T) {
+		body, err := os.ReadFile("testdata/remote_write.snappy")
+		require.NoError(t, err)
+
+		// the same totals are pushed again, the counter doesn't grow
+		assert.Equal(t, http.StatusNoContent, write(t, body))
+
+		requests, _, err := metricsService.GetMetric(entity.CounterType, "prometheus_http_requests_total",
+			map[string]string{"code": "200", "handler": "/metrics", "instance": "localhost:9090", "job": "prometheus"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), *requests)
+	})
+
+	t.Run("fractional counter", func(t *testing.T) {
+		series := func(total float64) *prompb.WriteRequest {
+			return &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "rpc_seconds_total"}},
+				Samples: []*prompb.Sample{{Value: total, Timestamp: 1700000000000}},
+			}}}
+		}
+
+		seconds := func(t *testing.T, total float64) int64 {
+			t.Helper()
+
+			assert.Equal(t, http.StatusNoContent, write(t, encode(t, series(total))))
+
+			counter, _, err := metricsService.GetMetric(entity.CounterType, "rpc_seconds_total", nil)
+			require.NoError(t, err)
+			return *counter
+		}
+
+		// the totals are rounded, so the rounding errors don't add up
+		assert.Equal(t, int64(0), seconds(t, 0.25))
+		assert.Equal(t, int64(1), seconds(t, 0.75))
+		assert.Equal(t, int64(2), seconds(t, 1.6))
+	})
+
+	t.Run("counter out of range", func(t *testing.T) {
+		request := &prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "huge_total"}},
+			Samples: []*prompb.Sample{{Value: 1e300, Timestamp: 1700000000000}},
+		}}}
+
+		assert.Equal(t, http.StatusBadRequest, write(t, encode(t, request)))
+	})
+
+	t.Run("decoded body is too large", func(t *testing.T) {
+		// the snappy block starts with the varint of the decoded length
+		body := binary.AppendUvarint(nil, maxPushBodySize+1)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, write(t, body))
+	})
+
+	t.Run("series without name", func(t *testing.T) {
+		body := encode(t, &prompb.WriteRequest{
+			Timeseries: []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "job", Value: "prometheus"}},
+				Samples: []*prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+			}},
+		})
+
+		assert.Equal(t, http.StatusBadRequest, write(t, body))
+	})
+
+	t.Run("incorrect label name rejects the whole request", func(t *testing.T) {
+		body := encode(t, &prompb.WriteRequest{
+			Timeseries: []*prompb.TimeSeries{
+				{
+					Labels:  []*prompb.Label{{Name: "__name__", Value: "rejected_gauge"}},
+					Samples: []*prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+				},
+				{
+					Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}, {Name: "bad-label", Value: "x"}},
+					Samples: []*prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+				},
+			},
+		})
+
+		assert.Equal(t, http.StatusBadRequest, write(t, body))
+
+		_, _, err := metricsService.GetMetric(entity.GaugeType, "rejected_gauge", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("not snappy body", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, write(t, []byte("up 1")))
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/write", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "zstd")
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	})
+}
@@ -3,9 +3,11 @@ package http
 import (
 	"net/http"
 
+	"github.com/go-chi/render"
 	"go.uber.org/zap"
 
 	"github.com/ivas1ly/uwu-metrics/internal/lib/postgres"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
 )
 
 // PingDB handler for checking the database connection status.
@@ -29,3 +31,22 @@ func PingDB(db *postgres.DB, log *zap.Logger) http.HandlerFunc {
 		}
 	}
 }
+
+// ActiveKeysRes is the response with the IDs of the keys used to decrypt the payloads.
+type ActiveKeysRes struct {
+	KeyIDs []string `json:"key_ids"`
+}
+
+// ActiveKeys returns the IDs of the private keys loaded by the server, so the agent
+// keys can be rolled after the server has the new key. The list is empty if
+// the payloads aren't encrypted.
+func ActiveKeys(keys *rsakeys.Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := ActiveKeysRes{KeyIDs: []string{}}
+		if keyring := keys.Get(); keyring != nil {
+			res.KeyIDs = keyring.IDs()
+		}
+
+		render.JSON(w, r, res)
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// watchKeepAlive is the interval of the comments that keep the idle stream open
+// behind proxies.
+const watchKeepAlive = 15 * time.Second
+
+// watch streams the metric updates as Server-Sent Events, each "metric" event has
+// the metric in the format of /value/ with the current stored value.
+//
+// Optional query parameters filter the metrics: type, prefix and regex of the metric name.
+// A client that doesn't keep up with the updates gets the "error" event and the stream is closed.
+func (h *metricsHandler) watch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ctx := r.Context()
+
+	updates, err := h.metricsService.Watch(ctx, entity.MetricFilter{
+		MType:      query.Get("type"),
+		NamePrefix: query.Get("prefix"),
+		NameRegexp: query.Get("regex"),
+	})
+	if errors.Is(err, entity.ErrIncorrectFilter) {
+		h.log.Info(entity.ErrIncorrectFilter.Error(), zap.Error(err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, render.M{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log.Info("can't watch metrics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// the stream lives longer than the server write timeout
+	if err = rc.SetWriteDeadline(time.Time{}); err != nil {
+		h.log.Info("can't disable write deadline", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		h.log.Info("can't stream events", zap.Error(err))
+		return
+	}
+
+	h.log.Info("watcher connected", zap.String("source", RequestSource(r)))
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case metric, ok := <-updates:
+			if !ok {
+				if ctx.Err() == nil {
+					h.log.Info("watcher dropped, it's too slow", zap.String("source", RequestSource(r)))
+					_ = writeEvent(w, "error", render.M{"message": "watcher fell behind the updates"})
+					_ = rc.Flush()
+				}
+				return
+			}
+
+			err = writeEvent(w, "metric", MetricReqRes{
+				Delta:     metric.Delta,
+				Value:     metric.Value,
+				Histogram: newHistogramReqRes(metric.Histogram),
+				Labels:    metric.Labels,
+				ID:        metric.ID,
+				MType:     metric.MType,
+			})
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			h.log.Info("can't stream events", zap.Error(err))
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, buf)
+
+	return err
+}
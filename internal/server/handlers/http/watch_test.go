@@ -0,0 +1,76 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+)
+
+func TestWatchHandler(t *testing.T) {
+	logger := zap.Must(zap.NewDevelopment())
+	router := chi.NewRouter()
+	metricsService := service.NewMetricsService(NewTestStorage())
+
+	NewRoutes(router, metricsService, logger)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	t.Run("metric events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/watch?type=gauge&prefix=CPU", nil)
+		require.NoError(t, err)
+
+		res, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+		labels := map[string]string{"cpu": "0"}
+		require.NoError(t, metricsService.UpsertMetric(entity.CounterType, "CPUcount", "1", nil))
+		require.NoError(t, metricsService.UpsertMetric(entity.GaugeType, "Alloc", "10", nil))
+		require.NoError(t, metricsService.UpsertMetric(entity.GaugeType, "CPUutilization", "12.5", labels))
+
+		reader := bufio.NewReader(res.Body)
+
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "event: metric\n", event)
+
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		var metric MetricReqRes
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &metric))
+		assert.Equal(t, "CPUutilization", metric.ID)
+		assert.Equal(t, entity.GaugeType, metric.MType)
+		assert.Equal(t, labels, metric.Labels)
+		require.NotNil(t, metric.Value)
+		assert.Equal(t, 12.5, *metric.Value)
+	})
+
+	t.Run("incorrect filter", func(t *testing.T) {
+		res, err := ts.Client().Get(ts.URL + "/watch?regex=(")
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,89 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// StatsD metric types.
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+	typeTimer   = "ms"
+)
+
+// minSampleRate limits the scale of the sampled values, a sample counts at most 1/minSampleRate times.
+const minSampleRate = 1e-6
+
+var errIncorrectLine = errors.New("incorrect StatsD line")
+
+// sample is a single parsed StatsD line.
+type sample struct {
+	name  string
+	mType string
+	value float64
+	// rate is the sample rate in [minSampleRate, 1], the counter and timer values are scaled by 1/rate.
+	rate float64
+	// relative is set for the gauges with an explicit sign, e.g. "+5" or "-5",
+	// the value is added to the current gauge value.
+	relative bool
+}
+
+// parseLine parses the line in the `name:value|type[|@rate]` format.
+func parseLine(line string) (sample, error) {
+	s := sample{rate: 1}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return s, fmt.Errorf("%w: no metric name in %q", errIncorrectLine, line)
+	}
+	s.name = name
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 || len(fields) > 3 {
+		return s, fmt.Errorf("%w: want value|type[|@rate] in %q", errIncorrectLine, line)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return s, fmt.Errorf("%w: incorrect value in %q", errIncorrectLine, line)
+	}
+	s.value = value
+
+	s.mType = fields[1]
+	switch s.mType {
+	case typeCounter, typeTimer:
+	case typeGauge:
+		s.relative = strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-")
+	default:
+		return s, fmt.Errorf("%w: unknown type %q in %q", errIncorrectLine, s.mType, line)
+	}
+
+	if len(fields) == 3 {
+		rate, found := strings.CutPrefix(fields[2], "@")
+		if !found {
+			return s, fmt.Errorf("%w: incorrect sample rate in %q", errIncorrectLine, line)
+		}
+		s.rate, err = strconv.ParseFloat(rate, 64)
+		if err != nil || math.IsNaN(s.rate) || s.rate < minSampleRate || s.rate > 1 {
+			return s, fmt.Errorf("%w: sample rate must be in [%g, 1] in %q", errIncorrectLine, minSampleRate, line)
+		}
+	}
+
+	// the counters are saved as integers, so the scaled value must fit
+	if s.mType == typeCounter && !inCounterRange(s.value/s.rate) {
+		return s, fmt.Errorf("%w: counter value is out of range in %q", errIncorrectLine, line)
+	}
+
+	return s, nil
+}
+
+// inCounterRange reports whether the value rounded to an integer fits the int64 counter.
+func inCounterRange(value float64) bool {
+	rounded := math.Round(value)
+
+	return rounded >= math.MinInt64 && rounded < math.MaxInt64
+}
@@ -0,0 +1,125 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    sample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "requests:3|c",
+			want: sample{name: "requests", mType: typeCounter, value: 3, rate: 1},
+		},
+		{
+			name: "counter with sample rate",
+			line: "requests:1|c|@0.1",
+			want: sample{name: "requests", mType: typeCounter, value: 1, rate: 0.1},
+		},
+		{
+			name: "gauge",
+			line: "queue.size:42.5|g",
+			want: sample{name: "queue.size", mType: typeGauge, value: 42.5, rate: 1},
+		},
+		{
+			name: "relative gauge increment",
+			line: "queue.size:+5|g",
+			want: sample{name: "queue.size", mType: typeGauge, value: 5, rate: 1, relative: true},
+		},
+		{
+			name: "relative gauge decrement",
+			line: "queue.size:-5|g",
+			want: sample{name: "queue.size", mType: typeGauge, value: -5, rate: 1, relative: true},
+		},
+		{
+			name: "timer",
+			line: "db.query:320|ms|@0.5",
+			want: sample{name: "db.query", mType: typeTimer, value: 320, rate: 0.5},
+		},
+		{
+			name:    "no name",
+			line:    ":1|c",
+			wantErr: true,
+		},
+		{
+			name:    "no type",
+			line:    "requests:1",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			line:    "requests:1|s",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect value",
+			line:    "requests:uwu|c",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect sample rate",
+			line:    "requests:1|c|@2",
+			wantErr: true,
+		},
+		{
+			name:    "too low sample rate",
+			line:    "db.query:1|ms|@0.0000000001",
+			wantErr: true,
+		},
+		{
+			name:    "NaN value",
+			line:    "queue.size:NaN|g",
+			wantErr: true,
+		},
+		{
+			name:    "infinite value",
+			line:    "requests:+Inf|c",
+			wantErr: true,
+		},
+		{
+			name:    "NaN sample rate",
+			line:    "requests:1|c|@NaN",
+			wantErr: true,
+		},
+		{
+			name:    "counter out of range",
+			line:    "requests:1e19|c",
+			wantErr: true,
+		},
+		{
+			name:    "counter out of range after sampling",
+			line:    "requests:1e13|c|@0.000001",
+			wantErr: true,
+		},
+		{
+			name: "large gauge",
+			line: "queue.size:1e19|g",
+			want: sample{name: "queue.size", mType: typeGauge, value: 1e19, rate: 1},
+		},
+		{
+			name:    "sample rate without @",
+			line:    "requests:1|c|0.5",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseLine(test.line)
+			if test.wantErr {
+				assert.ErrorIs(t, err, errIncorrectLine)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
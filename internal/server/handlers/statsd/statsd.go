@@ -0,0 +1,328 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/writesync"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent"
+)
+
+// maxPacketSize is the maximum size of a UDP datagram.
+const maxPacketSize = 65535
+
+// msPerSecond converts the timer values to seconds, the unit of the histogram buckets.
+const msPerSecond = 1000
+
+type MetricsService interface {
+	UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error)
+}
+
+// Server receives the StatsD metrics over UDP and saves them once per flush interval.
+//
+// Counters are summed up and saved as counters. Gauges keep the last value, a gauge with
+// an explicit sign is added to the current value. Timers are converted from milliseconds
+// to seconds and saved as histogram observations. The counter and timer samples are scaled
+// by the sample rate, e.g. a timer sent with @0.1 is observed once with the weight of 10.
+type Server struct {
+	metricsService MetricsService
+	log            *zap.Logger
+	conn           net.PacketConn
+	policy         *checkip.Policy
+	storage        persistent.Storage
+	done           chan struct{}
+	flushed        chan struct{}
+	counters       map[string]float64
+	gauges         map[string]gauge
+	timers         map[string][]observation
+	addr           string
+	flushInterval  time.Duration
+	mu             sync.Mutex
+	closed         bool
+}
+
+type gauge struct {
+	value    float64
+	relative bool
+}
+
+// observation is a timer value in seconds, the weight is the number of times it's counted.
+type observation struct {
+	value  float64
+	weight uint64
+}
+
+// Option configures the StatsD server.
+type Option func(s *Server)
+
+// WithIPPolicy sets the policy of the client addresses, the packets from the addresses
+// that aren't allowed are dropped.
+func WithIPPolicy(policy *checkip.Policy) Option {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithWriteSync sets the persistent storage that is saved after each flush.
+func WithWriteSync(storage persistent.Storage) Option {
+	return func(s *Server) {
+		s.storage = storage
+	}
+}
+
+// NewServer creates a new StatsD server that listens on the UDP address.
+func NewServer(addr string, flushInterval time.Duration, metricsService MetricsService, log *zap.Logger,
+	opts ...Option) *Server {
+	s := &Server{
+		metricsService: metricsService,
+		log:            log.With(zap.String("server", "StatsD")),
+		done:           make(chan struct{}),
+		flushed:        make(chan struct{}),
+		counters:       make(map[string]float64),
+		gauges:         make(map[string]gauge),
+		timers:         make(map[string][]observation),
+		addr:           addr,
+		flushInterval:  flushInterval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ListenAndServe listens on the UDP address and serves the packets until Shutdown is called,
+// after Shutdown it returns nil.
+func (s *Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(conn)
+}
+
+// Serve reads the packets from the connection until Shutdown is called.
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	go s.flushLoop()
+
+	s.log.Info("StatsD server started", zap.String("addr", conn.LocalAddr().String()))
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+
+		if s.policy != nil && !s.policy.PeerAllowed(addr) {
+			s.log.Warn("ip address is not allowed", zap.Stringer("addr", addr))
+			continue
+		}
+
+		s.handlePacket(string(buf[:n]))
+	}
+}
+
+// Shutdown stops reading the packets and saves the aggregated samples.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	close(s.done)
+	err := conn.Close()
+
+	select {
+	case <-s.flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// handlePacket aggregates all lines of the packet, the incorrect lines are skipped.
+func (s *Server) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parsed, err := parseLine(line)
+		if err != nil {
+			s.log.Info("can't parse StatsD line", zap.Error(err))
+			continue
+		}
+
+		s.add(parsed)
+	}
+}
+
+func (s *Server) add(sample sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch sample.mType {
+	case typeCounter:
+		s.counters[sample.name] += sample.value / sample.rate
+	case typeGauge:
+		current, ok := s.gauges[sample.name]
+		if sample.relative && ok {
+			current.value += sample.value
+		} else {
+			current = gauge{value: sample.value, relative: sample.relative}
+		}
+		s.gauges[sample.name] = current
+	case typeTimer:
+		s.timers[sample.name] = append(s.timers[sample.name], observation{
+			value:  sample.value / msPerSecond,
+			weight: uint64(math.Round(1 / sample.rate)),
+		})
+	}
+}
+
+func (s *Server) flushLoop() {
+	defer close(s.flushed)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			s.flush()
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// flush saves the samples aggregated since the last flush as a single batch,
+// the rejected metrics are skipped and the rest of the batch is saved.
+func (s *Server) flush() {
+	s.mu.Lock()
+	counters, gauges, timers := s.counters, s.gauges, s.timers
+	s.counters = make(map[string]float64)
+	s.gauges = make(map[string]gauge)
+	s.timers = make(map[string][]observation)
+	s.mu.Unlock()
+
+	batch := make([]*entity.Metric, 0, len(counters)+len(gauges)+len(timers))
+
+	for _, name := range sortedKeys(counters) {
+		// the sum of the samples in range can overflow the counter
+		if !inCounterRange(counters[name]) {
+			s.log.Info("StatsD counter is out of range, skipped", zap.String("name", name),
+				zap.Float64("value", counters[name]))
+			continue
+		}
+		delta := int64(math.Round(counters[name]))
+		batch = append(batch, &entity.Metric{Delta: &delta, ID: name, MType: entity.CounterType})
+	}
+
+	for _, name := range sortedKeys(gauges) {
+		value := gauges[name].value
+		metric := &entity.Metric{Value: &value, ID: name, MType: entity.GaugeType}
+		if gauges[name].relative {
+			// the value is added to the current one within the transaction
+			metric.Mode = entity.GaugeModeRelative
+		}
+		batch = append(batch, metric)
+	}
+
+	for _, name := range sortedKeys(timers) {
+		for _, observation := range timers[name] {
+			value := observation.value
+			batch = append(batch, &entity.Metric{Value: &value, ID: name, MType: entity.HistogramType,
+				Weight: observation.weight})
+		}
+	}
+
+	// the rejected metrics are excluded from the batch and the rest of it is saved again,
+	// each attempt rejects at least one metric
+	for len(batch) > 0 {
+		_, err := s.metricsService.UpsertTypeMetrics(batch)
+
+		var batchErr *entity.BatchError
+		if errors.As(err, &batchErr) {
+			s.log.Info("StatsD samples rejected", zap.Error(err))
+
+			rejected := make(map[int]struct{}, len(batchErr.Items))
+			for _, item := range batchErr.Items {
+				rejected[item.Index] = struct{}{}
+			}
+
+			n := 0
+			for i := range batch {
+				if _, ok := rejected[i]; !ok {
+					batch[n] = batch[i]
+					n++
+				}
+			}
+			batch = batch[:n]
+			continue
+		}
+		if err != nil {
+			s.log.Info("can't save StatsD samples", zap.Error(err))
+			return
+		}
+
+		s.log.Info("StatsD samples saved", zap.Int("metrics", len(batch)))
+		if s.storage != nil {
+			writesync.Save(context.Background(), s.storage, s.log)
+		}
+		return
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
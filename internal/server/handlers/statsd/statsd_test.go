@@ -0,0 +1,132 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+)
+
+func TestServer(t *testing.T) {
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+
+	value := 10.0
+	_, err := metricsService.UpsertTypeMetrics([]*entity.Metric{
+		{Value: &value, ID: "queue.size", MType: entity.GaugeType},
+	})
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	require.NoError(t, err)
+
+	// the flush interval is long enough, so all samples are saved by Shutdown
+	server := NewServer("", time.Hour, metricsService, zap.NewNop())
+
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, packet := range []string{
+		"requests:3|c\nrequests:1|c|@0.5",
+		"queue.size:+5|g\nqueue.size:-2|g",
+		"temperature:-3|g",
+		"temperature:21.5|g\ntemperature:+1|g",
+		"db.query:250|ms|@0.5\nuwu\ndb.query:2000|ms",
+		// the rejected metric doesn't drop the other samples of the interval
+		"bad{name:1|c",
+		// the sum of the samples overflows the counter, it's skipped
+		"huge:9e18|c\nhuge:9e18|c",
+		"rare.query:1000|ms|@0.000001",
+	} {
+		_, err = client.Write([]byte(packet))
+		require.NoError(t, err)
+	}
+
+	// wait until the packets are read
+	require.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		return len(server.timers["rare.query"]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, server.Shutdown(ctx))
+	require.NoError(t, <-served)
+
+	requests, _, err := metricsService.GetMetric(entity.CounterType, "requests", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *requests)
+
+	_, _, err = metricsService.GetMetric(entity.CounterType, "huge", nil)
+	assert.Error(t, err)
+
+	// the relative gauges are added to the stored value
+	_, queueSize, err := metricsService.GetMetric(entity.GaugeType, "queue.size", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 13.0, *queueSize)
+
+	// the relative gauge is added to the value set in the same interval
+	_, temperature, err := metricsService.GetMetric(entity.GaugeType, "temperature", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 22.5, *temperature)
+
+	histogram, err := metricsService.GetHistogram("db.query", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), histogram.Count)
+	assert.InDelta(t, 2.5, histogram.Sum, 1e-9)
+
+	// the sampled observation is saved once with its weight
+	rare, err := metricsService.GetHistogram("rare.query", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000000), rare.Count)
+}
+
+func TestServerIPPolicy(t *testing.T) {
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+
+	conn, err := net.ListenPacket("udp", "localhost:0")
+	require.NoError(t, err)
+
+	server := NewServer("", time.Hour, metricsService, zap.NewNop(), WithIPPolicy(checkip.DenyAll()))
+
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("requests:1|c"))
+	require.NoError(t, err)
+
+	// the packet is dropped, so the counter can't be awaited
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, server.Shutdown(ctx))
+	require.NoError(t, <-served)
+
+	_, _, err = metricsService.GetMetric(entity.CounterType, "requests", nil)
+	assert.Error(t, err)
+}
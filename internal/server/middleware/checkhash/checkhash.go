@@ -2,21 +2,31 @@ package checkhash
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
 
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
 )
 
 // New constructs a new SHA256 hash check middleware.
-func New(log *zap.Logger, key []byte) func(next http.Handler) http.Handler {
+//
+// The hash in the HashSHA256 header covers the method, the request URI, the X-Signature-Timestamp
+// (Unix time in seconds) and X-Signature-Nonce headers and the body. The request with a stale
+// timestamp or a used nonce is rejected, so a captured request can't be replayed. The hashes
+// of the body only, sent by the old agents, are accepted in the compatibility mode. The nonces
+// are shared with the gRPC interceptors, so a request can't be replayed over the other server.
+// The requests without the hash are passed as they are, see Require.
+func New(log *zap.Logger, key []byte, compat bool, nonces *nonce.Storage) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		l := log.With(zap.String("middleware", "check hash"))
 
-		l.Info("added check hash middleware")
+		l.Info("added check hash middleware", zap.Bool("compatibility mode", compat))
 
 		checkHashFn := func(w http.ResponseWriter, r *http.Request) {
 			if len(key) == 0 {
@@ -43,7 +53,23 @@ func New(log *zap.Logger, key []byte) func(next http.Handler) http.Handler {
 				return
 			}
 
-			sign, err := hash.Hash(buf, key)
+			timestamp := r.Header.Get("X-Signature-Timestamp")
+			requestNonce := r.Header.Get("X-Signature-Nonce")
+			legacy := timestamp == "" && requestNonce == ""
+
+			var sign string
+			switch {
+			case legacy && !compat:
+				l.Info("hash of the body only isn't accepted, the timestamp and the nonce are required")
+
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, render.M{"message": "request signature must have timestamp and nonce"})
+				return
+			case legacy:
+				sign, err = hash.Hash(buf, key)
+			default:
+				sign, err = hash.RequestHash(r.Method, r.URL.RequestURI(), timestamp, requestNonce, buf, key)
+			}
 			if err != nil {
 				l.Info("can't get hash sign")
 
@@ -53,7 +79,7 @@ func New(log *zap.Logger, key []byte) func(next http.Handler) http.Handler {
 			}
 			l.Info("hash", zap.String("value", sign))
 
-			if sign != hashHeader {
+			if !hmac.Equal([]byte(sign), []byte(hashHeader)) {
 				l.Info("computed hash doesn't match the one provided in the HashSHA256 header")
 
 				w.WriteHeader(http.StatusBadRequest)
@@ -61,6 +87,17 @@ func New(log *zap.Logger, key []byte) func(next http.Handler) http.Handler {
 				return
 			}
 
+			if !legacy {
+				if err = nonces.Check(timestamp, requestNonce, time.Now()); err != nil {
+					l.Info("replayed or stale request", zap.Error(err),
+						zap.String("timestamp", timestamp), zap.String("nonce", requestNonce))
+
+					w.WriteHeader(http.StatusUnauthorized)
+					render.JSON(w, r, render.M{"message": err.Error()})
+					return
+				}
+			}
+
 			l.Info("hash check OK", zap.String("header", hashHeader), zap.String("sign", sign))
 
 			reader := io.NopCloser(bytes.NewBuffer(buf))
@@ -72,3 +109,28 @@ func New(log *zap.Logger, key []byte) func(next http.Handler) http.Handler {
 		return http.HandlerFunc(checkHashFn)
 	}
 }
+
+// Require constructs a middleware that rejects the requests without the HashSHA256 header,
+// the hash itself is checked by the New middleware. It's applied to the agent writes only,
+// the clients that push the metrics, e.g. the OTLP and remote write ones, don't sign the requests.
+func Require(log *zap.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		l := log.With(zap.String("middleware", "require hash"))
+
+		l.Info("added require hash middleware")
+
+		requireHashFn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("HashSHA256") == "" {
+				l.Info("hash header is empty, the request is rejected")
+
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, render.M{"message": "request hash is required"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(requireHashFn)
+	}
+}
@@ -0,0 +1,201 @@
+package checkhash
+
+import (
+	"context"
+	"crypto/hmac"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+)
+
+const (
+	// metadataKey is the request metadata with the hash, if the message has no hash field.
+	metadataKey = "hashsha256"
+	// timestampKey is the request metadata with the signature timestamp, Unix time in seconds.
+	timestampKey = "x-signature-timestamp"
+	// nonceKey is the request metadata with the signature nonce.
+	nonceKey = "x-signature-nonce"
+)
+
+// hashGetter is implemented by the request messages with the hash field.
+type hashGetter interface {
+	GetHash() string
+}
+
+// NewInterceptor constructs an interceptor to check the SHA256 hash of the request.
+//
+// The hash is taken from the hash field of the message or from the hashsha256 metadata, it covers
+// the full method name, the x-signature-timestamp and x-signature-nonce metadata and the marshalled
+// message, like the hash of the HTTP request. The request without the hash, with a stale timestamp
+// or a used nonce is rejected. The hashes of the message only, sent by the old agents, are accepted
+// in the compatibility mode.
+func NewInterceptor(log *zap.Logger, key []byte, compat bool, nonces *nonce.Storage) grpc.UnaryServerInterceptor {
+	l := log.With(zap.String("unary interceptor", "check hash"))
+
+	l.Info("added check hash unary interceptor", zap.Bool("compatibility mode", compat))
+
+	checkHashFn := func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		sig := newSignature(ctx, info.FullMethod)
+
+		if err := sig.check(l, req, key, compat); err != nil {
+			return nil, err
+		}
+		if err := sig.checkNonce(l, nonces); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+
+	return checkHashFn
+}
+
+// NewStreamInterceptor constructs a stream interceptor to check the SHA256 hash of each received message.
+// The timestamp and the nonce are set once for the stream, they are checked with the first message.
+func NewStreamInterceptor(log *zap.Logger, key []byte, compat bool,
+	nonces *nonce.Storage) grpc.StreamServerInterceptor {
+	l := log.With(zap.String("stream interceptor", "check hash"))
+
+	l.Info("added check hash stream interceptor", zap.Bool("compatibility mode", compat))
+
+	checkHashFn := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &hashStream{
+			ServerStream: ss,
+			log:          l,
+			nonces:       nonces,
+			sig:          newSignature(ss.Context(), info.FullMethod),
+			key:          key,
+			compat:       compat,
+		})
+	}
+
+	return checkHashFn
+}
+
+type hashStream struct {
+	grpc.ServerStream
+	log          *zap.Logger
+	nonces       *nonce.Storage
+	sig          signature
+	key          []byte
+	compat       bool
+	nonceChecked bool
+}
+
+func (s *hashStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if err := s.sig.check(s.log, m, s.key, s.compat); err != nil {
+		return err
+	}
+
+	// the nonce is checked after the first hash, so the requests without the key can't use the nonces
+	if !s.nonceChecked {
+		if err := s.sig.checkNonce(s.log, s.nonces); err != nil {
+			return err
+		}
+		s.nonceChecked = true
+	}
+
+	return nil
+}
+
+// signature is the signed data of the call from its metadata.
+type signature struct {
+	fullMethod   string
+	timestamp    string
+	nonce        string
+	metadataHash string
+}
+
+func newSignature(ctx context.Context, fullMethod string) signature {
+	return signature{
+		fullMethod:   fullMethod,
+		timestamp:    metadataValue(ctx, timestampKey),
+		nonce:        metadataValue(ctx, nonceKey),
+		metadataHash: metadataValue(ctx, metadataKey),
+	}
+}
+
+// legacy reports whether the hash is of the message only.
+func (sig signature) legacy() bool {
+	return sig.timestamp == "" && sig.nonce == ""
+}
+
+func (sig signature) check(l *zap.Logger, req any, key []byte, compat bool) error {
+	msg, ok := req.(proto.Message)
+	if !ok || len(key) == 0 {
+		return nil
+	}
+
+	requestHash := sig.metadataHash
+	if hg, hashed := req.(hashGetter); hashed && hg.GetHash() != "" {
+		requestHash = hg.GetHash()
+	}
+	if requestHash == "" {
+		l.Info("hash is empty, the request is rejected")
+		return status.Error(codes.Unauthenticated, "request hash is required")
+	}
+
+	var (
+		sign string
+		err  error
+	)
+	switch {
+	case sig.legacy() && !compat:
+		l.Info("hash of the message only isn't accepted, the timestamp and the nonce are required")
+		return status.Error(codes.Unauthenticated, "request signature must have timestamp and nonce")
+	case sig.legacy():
+		sign, err = hash.MessageHash(msg, key)
+	default:
+		sign, err = hash.CallHash(sig.fullMethod, sig.timestamp, sig.nonce, msg, key)
+	}
+	if err != nil {
+		l.Info("can't get hash sign", zap.Error(err))
+		return status.Error(codes.Internal, "can't check hash")
+	}
+
+	if !hmac.Equal([]byte(sign), []byte(requestHash)) {
+		l.Info("computed hash doesn't match the one provided in the request")
+		return status.Error(codes.Unauthenticated, "can't check hash")
+	}
+
+	l.Info("hash check OK", zap.String("sign", sign))
+
+	return nil
+}
+
+func (sig signature) checkNonce(l *zap.Logger, nonces *nonce.Storage) error {
+	if sig.legacy() {
+		return nil
+	}
+
+	if err := nonces.Check(sig.timestamp, sig.nonce, time.Now()); err != nil {
+		l.Info("replayed or stale request", zap.Error(err),
+			zap.String("timestamp", sig.timestamp), zap.String("nonce", sig.nonce))
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return nil
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+
+	return ""
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -14,9 +15,16 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/ivas1ly/uwu-metrics/internal/lib/logger"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
 )
 
 const (
@@ -89,7 +97,8 @@ func TestCheckHash(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Use(New(log, test.key))
+			// the hashes of the body only are sent by the old agents
+			r.Use(New(log, test.key, true, nonce.NewStorage(time.Minute)))
 			r.Post("/", func(w http.ResponseWriter, _ *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			})
@@ -105,6 +114,189 @@ func TestCheckHash(t *testing.T) {
 	}
 }
 
+func TestCheckHashReplay(t *testing.T) {
+	log := logger.New(defaultLogLevel, zap.NewDevelopmentConfig())
+	key := []byte("some key")
+
+	r := chi.NewRouter()
+	r.Use(New(log, key, false, nonce.NewStorage(time.Minute)))
+	r.Post("/updates/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/value/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	send := func(t *testing.T, path, sign, timestamp, nonce string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(testBody))
+		require.NoError(t, err)
+		req.Header.Set("HashSHA256", sign)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature-Nonce", nonce)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	signed := func(t *testing.T, path string, at time.Time, nonce string) (string, string) {
+		t.Helper()
+
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		sign, err := hash.RequestHash(http.MethodPost, path, timestamp, nonce, []byte(testBody), key)
+		require.NoError(t, err)
+
+		return sign, timestamp
+	}
+
+	t.Run("fresh request is accepted once", func(t *testing.T) {
+		sign, timestamp := signed(t, "/updates/", time.Now(), "first")
+		assert.Equal(t, http.StatusOK, send(t, "/updates/", sign, timestamp, "first"))
+		assert.Equal(t, http.StatusUnauthorized, send(t, "/updates/", sign, timestamp, "first"))
+	})
+
+	t.Run("stale request", func(t *testing.T) {
+		sign, timestamp := signed(t, "/updates/", time.Now().Add(-time.Hour), "stale")
+		assert.Equal(t, http.StatusUnauthorized, send(t, "/updates/", sign, timestamp, "stale"))
+
+		sign, timestamp = signed(t, "/updates/", time.Now().Add(time.Hour), "future")
+		assert.Equal(t, http.StatusUnauthorized, send(t, "/updates/", sign, timestamp, "future"))
+	})
+
+	t.Run("signature of another path or nonce", func(t *testing.T) {
+		sign, timestamp := signed(t, "/update/", time.Now(), "path")
+		assert.Equal(t, http.StatusBadRequest, send(t, "/updates/", sign, timestamp, "path"))
+
+		sign, timestamp = signed(t, "/updates/", time.Now(), "nonce")
+		assert.Equal(t, http.StatusBadRequest, send(t, "/updates/", sign, timestamp, "other nonce"))
+	})
+
+	t.Run("unsigned request is passed", func(t *testing.T) {
+		resp, _ := testRequest(t, ts, http.MethodGet, "/value/", "", nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, http.StatusOK, send(t, "/updates/", "", "", ""))
+	})
+
+	t.Run("body hash is rejected without compatibility mode", func(t *testing.T) {
+		sign, err := hash.Hash([]byte(testBody), key)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, send(t, "/updates/", sign, "", ""))
+	})
+}
+
+func TestRequire(t *testing.T) {
+	log := logger.New(defaultLogLevel, zap.NewDevelopmentConfig())
+
+	r := chi.NewRouter()
+	r.Use(Require(log))
+	r.Post("/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	t.Run("without hash header", func(t *testing.T) {
+		resp, respBody := testRequest(t, ts, http.MethodPost, "/", "", strings.NewReader(testBody))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, `{"message":"request hash is required"}`, strings.TrimSpace(respBody))
+	})
+
+	t.Run("with hash header", func(t *testing.T) {
+		resp, _ := testRequest(t, ts, http.MethodPost, "/", "hash", strings.NewReader(testBody))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestCheckHashInterceptor(t *testing.T) {
+	key := []byte("some key")
+	nonces := nonce.NewStorage(time.Minute)
+	interceptor := NewInterceptor(zap.NewNop(), key, false, nonces)
+	info := &grpc.UnaryServerInfo{FullMethod: pb.MetricsService_Updates_FullMethodName}
+
+	handler := func(_ context.Context, _ any) (any, error) {
+		return &emptypb.Empty{}, nil
+	}
+
+	call := func(t *testing.T, fullMethod, timestamp, requestNonce string) error {
+		t.Helper()
+
+		req := &pb.MetricsRequest{IdempotencyKey: "report"}
+		if fullMethod != "" {
+			sign, err := hash.CallHash(fullMethod, timestamp, requestNonce, req, key)
+			require.NoError(t, err)
+			req.Hash = sign
+		}
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			timestampKey, timestamp,
+			nonceKey, requestNonce,
+		))
+		_, err := interceptor(ctx, req, info, handler)
+
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	t.Run("signed call is accepted once", func(t *testing.T) {
+		require.NoError(t, call(t, info.FullMethod, timestamp, "first"))
+		assert.Equal(t, codes.Unauthenticated, status.Code(call(t, info.FullMethod, timestamp, "first")))
+	})
+
+	t.Run("hash of another method", func(t *testing.T) {
+		err := call(t, pb.MetricsService_Update_FullMethodName, timestamp, "method")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("stale call", func(t *testing.T) {
+		stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		assert.Equal(t, codes.Unauthenticated, status.Code(call(t, info.FullMethod, stale, "stale")))
+	})
+
+	t.Run("unsigned call", func(t *testing.T) {
+		assert.Equal(t, codes.Unauthenticated, status.Code(call(t, "", timestamp, "unsigned")))
+	})
+
+	t.Run("nonce used by the HTTP request", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Use(New(zap.NewNop(), key, false, nonces))
+		r.Post("/updates/", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+
+		sign, err := hash.RequestHash(http.MethodPost, "/updates/", timestamp, "shared", []byte(testBody), key)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/updates/", strings.NewReader(testBody))
+		require.NoError(t, err)
+		req.Header.Set("HashSHA256", sign)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature-Nonce", "shared")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, codes.Unauthenticated, status.Code(call(t, info.FullMethod, timestamp, "shared")))
+	})
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, header string,
 	body io.Reader) (*http.Response, string) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTestClientTimeout)
@@ -1,6 +1,7 @@
 package checkip
 
 import (
+	"context"
 	"net"
 	"net/http"
 
@@ -8,37 +9,46 @@ import (
 	"go.uber.org/zap"
 )
 
-// New constructs a new middleware to check if an IP address is in a trusted subnet.
-func New(log *zap.Logger, trustedSubnet *net.IPNet) func(next http.Handler) http.Handler {
+type clientIPKey struct{}
+
+// RequestIP returns the client address allowed by the policy, it's nil if the address isn't checked.
+func RequestIP(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	return ip
+}
+
+// New constructs a new middleware to check if the client IP address is allowed by the policy.
+// The address is taken from the remote address of the connection or the forwarding headers,
+// according to the policy mode. The allowed address is added to the request context.
+func New(log *zap.Logger, policy *Policy) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		l := log.With(zap.String("middleware", "check ip address"))
 
-		l.Info("added check ip address middleware")
+		l.Info("added check ip address middleware", zap.String("mode", string(policy.Mode)))
 
-		checkHashFn := func(w http.ResponseWriter, r *http.Request) {
-			realIP := r.Header.Get("X-Real-IP")
-			l.Info("IP address", zap.String("X-Real-IP", realIP))
+		checkIPFn := func(w http.ResponseWriter, r *http.Request) {
+			requestIP := policy.ClientIP(r.RemoteAddr, r.Header.Get("X-Real-IP"), r.Header.Values("X-Forwarded-For"))
+			if requestIP == nil {
+				l.Warn("can't get client ip address", zap.String("remote addr", r.RemoteAddr))
 
-			requestIP := net.ParseIP(realIP)
-			if net.ParseIP(realIP) == nil {
-				l.Info("X-Real-IP header is empty or invalid, skip check")
-				next.ServeHTTP(w, r)
+				w.WriteHeader(http.StatusForbidden)
+				render.JSON(w, r, render.M{"message": "can't get client ip address"})
 				return
 			}
 
-			if !trustedSubnet.Contains(requestIP) {
-				l.Warn("ip address is not in trusted subnet")
+			if !policy.Allowed(requestIP) {
+				l.Warn("ip address is not allowed", zap.String("ip", requestIP.String()))
 
 				w.WriteHeader(http.StatusForbidden)
-				render.JSON(w, r, render.M{"message": "can't check hash"})
+				render.JSON(w, r, render.M{"message": "ip address is not allowed"})
 				return
 			}
 
-			l.Info("ip address check OK", zap.String("X-Real-IP", realIP))
+			l.Info("ip address check OK", zap.String("ip", requestIP.String()))
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, requestIP)))
 		}
 
-		return http.HandlerFunc(checkHashFn)
+		return http.HandlerFunc(checkIPFn)
 	}
 }
@@ -0,0 +1,108 @@
+package checkip
+
+import (
+	"context"
+	"net"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The request metadata with the client IP address, the same as the X-Real-IP and X-Forwarded-For headers.
+const (
+	realIPKey       = "x-real-ip"
+	forwardedForKey = "x-forwarded-for"
+)
+
+// NewInterceptor constructs an interceptor to check if the client IP address is allowed by the policy.
+// The address is taken from the peer address of the connection or the x-real-ip and x-forwarded-for
+// metadata, according to the policy mode. The allowed address is added to the request context.
+func NewInterceptor(log *zap.Logger, policy *Policy) grpc.UnaryServerInterceptor {
+	l := log.With(zap.String("unary interceptor", "check ip address"))
+
+	l.Info("added check ip address unary interceptor")
+
+	checkIPFn := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		requestIP, err := checkIP(ctx, l, policy)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(context.WithValue(ctx, clientIPKey{}, requestIP), req)
+	}
+
+	return checkIPFn
+}
+
+// NewStreamInterceptor constructs a stream interceptor to check if the client IP address
+// is allowed by the policy, the address is checked once when the stream is opened.
+func NewStreamInterceptor(log *zap.Logger, policy *Policy) grpc.StreamServerInterceptor {
+	l := log.With(zap.String("stream interceptor", "check ip address"))
+
+	l.Info("added check ip address stream interceptor")
+
+	checkIPFn := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		requestIP, err := checkIP(ss.Context(), l, policy)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &ipStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ss.Context(), clientIPKey{}, requestIP),
+		})
+	}
+
+	return checkIPFn
+}
+
+// ipStream is the server stream with the client address in its context.
+type ipStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *ipStream) Context() context.Context {
+	return s.ctx
+}
+
+func checkIP(ctx context.Context, l *zap.Logger, policy *Policy) (net.IP, error) {
+	requestIP := clientIP(ctx, policy)
+	if requestIP == nil {
+		l.Warn("can't get client ip address")
+		return nil, status.Error(codes.PermissionDenied, "can't get client ip address")
+	}
+
+	if !policy.Allowed(requestIP) {
+		l.Warn("ip address is not allowed", zap.String("ip", requestIP.String()))
+		return nil, status.Error(codes.PermissionDenied, "ip address is not allowed")
+	}
+
+	l.Info("ip address check OK", zap.String("ip", requestIP.String()))
+
+	return requestIP, nil
+}
+
+// clientIP returns the client address from the peer address and the metadata.
+func clientIP(ctx context.Context, policy *Policy) net.IP {
+	var peerAddr, realIP string
+	var forwardedFor []string
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(realIPKey); len(values) > 0 {
+			realIP = values[0]
+		}
+		forwardedFor = md.Get(forwardedForKey)
+	}
+
+	return policy.ClientIP(peerAddr, realIP, forwardedFor)
+}
@@ -0,0 +1,67 @@
+package checkip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCheckIP(t *testing.T) {
+	policy, err := ParsePolicy(string(ModePeer), "127.0.0.0/8", "127.0.0.66/32", "")
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(New(zap.NewNop(), policy))
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		statusCode int
+	}{
+		{
+			name:       "allowed peer",
+			remoteAddr: "127.0.0.1:4242",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "X-Real-IP can't bypass the check",
+			remoteAddr: "192.168.1.1:4242",
+			realIP:     "127.0.0.1",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "denied peer",
+			remoteAddr: "127.0.0.66:4242",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "no client address",
+			remoteAddr: "@",
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package checkip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Mode sets where the client address is taken from.
+type Mode string
+
+const (
+	// ModePeer uses the peer address of the connection. The forwarding headers are used only
+	// if the peer is a trusted proxy.
+	ModePeer Mode = "peer"
+	// ModeHeader uses the X-Real-IP header set by the agents. Any client can set the header,
+	// so it's only for the agents that can't connect directly and aren't behind a trusted proxy.
+	ModeHeader Mode = "header"
+)
+
+var (
+	errUnknownMode   = errors.New("unknown client ip mode")
+	errIncorrectCIDR = errors.New("incorrect CIDR")
+)
+
+// Policy decides if a client address is allowed.
+//
+// The address matching a denied subnet is rejected. If the allowed subnets are set, the address
+// must match one of them, otherwise all addresses that aren't denied are allowed. The request
+// without a valid client address is always rejected.
+type Policy struct {
+	Mode           Mode
+	Allow          []*net.IPNet
+	Deny           []*net.IPNet
+	TrustedProxies []*net.IPNet
+}
+
+// ParsePolicy parses the comma-separated IPv4 and IPv6 CIDRs of the allowed and denied subnets
+// and the trusted proxies, the empty mode is ModePeer.
+func ParsePolicy(mode, allow, deny, trustedProxies string) (*Policy, error) {
+	p := &Policy{Mode: Mode(mode)}
+
+	switch p.Mode {
+	case "":
+		p.Mode = ModePeer
+	case ModePeer, ModeHeader:
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownMode, mode)
+	}
+
+	var err error
+	if p.Allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if p.Deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	if p.TrustedProxies, err = parseCIDRs(trustedProxies); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// DenyAll returns the policy that rejects all requests, e.g. if the configured policy can't be parsed.
+func DenyAll() *Policy {
+	deny, _ := parseCIDRs("0.0.0.0/0,::/0")
+
+	return &Policy{Mode: ModePeer, Deny: deny}
+}
+
+// Allowed reports whether the client address is allowed.
+func (p *Policy) Allowed(ip net.IP) bool {
+	if ip == nil || contains(p.Deny, ip) {
+		return false
+	}
+
+	return len(p.Allow) == 0 || contains(p.Allow, ip)
+}
+
+// PeerAllowed reports whether the peer address is allowed. It's for the protocols without
+// the forwarding headers, e.g. StatsD and Graphite, so the peer is the client in any mode.
+func (p *Policy) PeerAllowed(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+
+	return p.Allowed(parseHost(addr.String()))
+}
+
+// ClientIP returns the client address of the request from the peer address and the values
+// of the X-Real-IP and X-Forwarded-For headers, it's nil if the address can't be determined.
+//
+// The X-Forwarded-For addresses are read from the right, the trusted proxies are skipped and
+// the first other address is the client. If all of them are trusted proxies, the leftmost one
+// is the client. If the headers aren't set, the request is from the proxy itself.
+func (p *Policy) ClientIP(peerAddr, realIP string, forwardedFor []string) net.IP {
+	if p.Mode == ModeHeader {
+		return net.ParseIP(strings.TrimSpace(realIP))
+	}
+
+	peerIP := parseHost(peerAddr)
+	if peerIP == nil || !contains(p.TrustedProxies, peerIP) {
+		return peerIP
+	}
+
+	var hops []string
+	for _, header := range forwardedFor {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	if len(hops) > 0 {
+		var client net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			client = net.ParseIP(strings.TrimSpace(hops[i]))
+			if client == nil {
+				return nil
+			}
+			if !contains(p.TrustedProxies, client) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP != "" {
+		return net.ParseIP(strings.TrimSpace(realIP))
+	}
+
+	return peerIP
+}
+
+func contains(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHost parses the IP address of the host:port address.
+func parseHost(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
+
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", errIncorrectCIDR, cidr, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
@@ -0,0 +1,167 @@
+package checkip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("", "192.168.0.0/16, fd00::/8", "192.168.66.0/24", "10.0.0.1/32")
+	require.NoError(t, err)
+	assert.Equal(t, ModePeer, p.Mode)
+	assert.Len(t, p.Allow, 2)
+	assert.Len(t, p.Deny, 1)
+	assert.Len(t, p.TrustedProxies, 1)
+
+	_, err = ParsePolicy("forwarded", "", "", "")
+	assert.ErrorIs(t, err, errUnknownMode)
+
+	_, err = ParsePolicy(string(ModeHeader), "192.168.0.0", "", "")
+	assert.ErrorIs(t, err, errIncorrectCIDR)
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	p, err := ParsePolicy("", "192.168.0.0/16,fd00::/8", "192.168.66.0/24,fd00:bad::/32", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "192.168.1.1", want: true},
+		{ip: "192.168.66.6", want: false},
+		{ip: "10.0.0.1", want: false},
+		{ip: "fd00::1", want: true},
+		{ip: "fd00:bad::1", want: false},
+		{ip: "2001:db8::1", want: false},
+		{ip: "::ffff:192.168.1.1", want: true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.Allowed(net.ParseIP(tt.ip)), tt.ip)
+	}
+	assert.False(t, p.Allowed(nil))
+
+	denyOnly, err := ParsePolicy("", "", "192.168.66.0/24", "")
+	require.NoError(t, err)
+	assert.True(t, denyOnly.Allowed(net.ParseIP("10.0.0.1")))
+	assert.False(t, denyOnly.Allowed(net.ParseIP("192.168.66.6")))
+
+	assert.False(t, DenyAll().Allowed(net.ParseIP("127.0.0.1")))
+	assert.False(t, DenyAll().Allowed(net.ParseIP("::1")))
+
+	// the peer is the client even in the header mode
+	header, err := ParsePolicy(string(ModeHeader), "192.168.0.0/16", "", "")
+	require.NoError(t, err)
+	assert.True(t, header.PeerAllowed(&net.UDPAddr{IP: net.ParseIP("192.168.1.1"), Port: 8125}))
+	assert.False(t, header.PeerAllowed(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 2003}))
+	assert.False(t, header.PeerAllowed(nil))
+}
+
+func TestPolicyClientIP(t *testing.T) {
+	peer, err := ParsePolicy(string(ModePeer), "", "", "10.0.0.0/24,fd00::1/128")
+	require.NoError(t, err)
+	header, err := ParsePolicy(string(ModeHeader), "", "", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		policy       *Policy
+		name         string
+		peerAddr     string
+		realIP       string
+		want         string
+		forwardedFor []string
+	}{
+		{
+			name:     "peer address",
+			policy:   peer,
+			peerAddr: "192.168.1.1:4242",
+			realIP:   "192.168.66.6",
+			want:     "192.168.1.1",
+		},
+		{
+			name:     "IPv6 peer address",
+			policy:   peer,
+			peerAddr: "[2001:db8::1]:4242",
+			want:     "2001:db8::1",
+		},
+		{
+			name:         "forwarding headers of an untrusted peer are ignored",
+			policy:       peer,
+			peerAddr:     "192.168.1.1:4242",
+			forwardedFor: []string{"192.168.66.6"},
+			want:         "192.168.1.1",
+		},
+		{
+			name:     "X-Real-IP of a trusted proxy",
+			policy:   peer,
+			peerAddr: "10.0.0.1:4242",
+			realIP:   "192.168.1.1",
+			want:     "192.168.1.1",
+		},
+		{
+			name:         "X-Forwarded-For of trusted proxies",
+			policy:       peer,
+			peerAddr:     "[fd00::1]:4242",
+			realIP:       "192.168.66.6",
+			forwardedFor: []string{"192.168.66.6, 192.168.1.1", "10.0.0.2"},
+			want:         "192.168.1.1",
+		},
+		{
+			name:         "X-Forwarded-For of trusted proxies only",
+			policy:       peer,
+			peerAddr:     "10.0.0.1:4242",
+			forwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			want:         "10.0.0.3",
+		},
+		{
+			name:         "incorrect X-Forwarded-For",
+			policy:       peer,
+			peerAddr:     "10.0.0.1:4242",
+			forwardedFor: []string{"192.168.1.1, unknown"},
+		},
+		{
+			name:     "request from the proxy itself",
+			policy:   peer,
+			peerAddr: "10.0.0.1:4242",
+			want:     "10.0.0.1",
+		},
+		{
+			name:   "no peer address",
+			policy: peer,
+			realIP: "192.168.1.1",
+		},
+		{
+			name:     "X-Real-IP in header mode",
+			policy:   header,
+			peerAddr: "192.168.66.6:4242",
+			realIP:   "192.168.1.1",
+			want:     "192.168.1.1",
+		},
+		{
+			name:     "no X-Real-IP in header mode",
+			policy:   header,
+			peerAddr: "192.168.1.1:4242",
+		},
+		{
+			name:     "incorrect X-Real-IP in header mode",
+			policy:   header,
+			peerAddr: "192.168.1.1:4242",
+			realIP:   "localhost",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := tt.policy.ClientIP(tt.peerAddr, tt.realIP, tt.forwardedFor)
+			if tt.want == "" {
+				assert.Nil(t, ip)
+				return
+			}
+			assert.Equal(t, tt.want, ip.String())
+		})
+	}
+}
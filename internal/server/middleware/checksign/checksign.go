@@ -0,0 +1,114 @@
+package checksign
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
+)
+
+type agentIDKey struct{}
+
+// AgentID returns the ID of the agent that signed the request, it's empty for the unsigned requests.
+func AgentID(ctx context.Context) string {
+	agentID, _ := ctx.Value(agentIDKey{}).(string)
+	return agentID
+}
+
+// New constructs a new agent signature check middleware.
+//
+// The agent sends its ID in the X-Agent-ID header and the Ed25519 signature of the method,
+// the request URI, the X-Signature-Timestamp and X-Signature-Nonce headers and the body
+// in the X-Agent-Signature header. The signature is checked with the agent public key from
+// the registry, the unknown and revoked agents are rejected, as well as the stale timestamps
+// and the used nonces. The ID of the agent is added to the request context.
+//
+// The requests without the X-Agent-ID header are passed as they are, unless the signature is
+// required, then only the GET and HEAD requests are passed. The nonces are shared with the gRPC
+// interceptors, so a request can't be replayed over the other server.
+func New(log *zap.Logger, registry *agentkeys.Registry, required bool,
+	nonces *nonce.Storage) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		l := log.With(zap.String("middleware", "check agent signature"))
+
+		l.Info("added check agent signature middleware", zap.Bool("required", required))
+
+		checkSignFn := func(w http.ResponseWriter, r *http.Request) {
+			agentID := r.Header.Get("X-Agent-ID")
+			if agentID == "" {
+				if required && r.Method != http.MethodGet && r.Method != http.MethodHead {
+					l.Info("request isn't signed by an agent")
+
+					w.WriteHeader(http.StatusUnauthorized)
+					render.JSON(w, r, render.M{"message": "agent signature is required"})
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			publicKey, err := registry.Lookup(agentID)
+			if err != nil {
+				l.Info("agent isn't allowed", zap.String("agent", agentID), zap.Error(err))
+
+				code := http.StatusUnauthorized
+				if errors.Is(err, agentkeys.ErrRevokedAgent) {
+					code = http.StatusForbidden
+				}
+
+				w.WriteHeader(code)
+				render.JSON(w, r, render.M{"message": err.Error()})
+				return
+			}
+
+			buf, err := io.ReadAll(r.Body)
+			if err != nil {
+				l.Info("can't read body")
+
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, render.M{"message": "can't read body"})
+				return
+			}
+
+			timestamp := r.Header.Get("X-Signature-Timestamp")
+			requestNonce := r.Header.Get("X-Signature-Nonce")
+
+			if !signkeys.Verify(publicKey, r.Method, r.URL.RequestURI(), timestamp, requestNonce, buf,
+				r.Header.Get("X-Agent-Signature")) {
+				l.Info("agent signature doesn't match the request", zap.String("agent", agentID))
+
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, render.M{"message": "incorrect agent signature"})
+				return
+			}
+
+			// the nonces are namespaced by the agent, so an agent can't block the nonces of the others
+			if err = nonces.Check(timestamp, agentID+"\n"+requestNonce, time.Now()); err != nil {
+				l.Info("replayed or stale request", zap.String("agent", agentID), zap.Error(err),
+					zap.String("timestamp", timestamp), zap.String("nonce", requestNonce))
+
+				w.WriteHeader(http.StatusUnauthorized)
+				render.JSON(w, r, render.M{"message": err.Error()})
+				return
+			}
+
+			l.Info("agent signature check OK", zap.String("agent", agentID))
+
+			r.Body = io.NopCloser(bytes.NewBuffer(buf))
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), agentIDKey{}, agentID)))
+		}
+
+		return http.HandlerFunc(checkSignFn)
+	}
+}
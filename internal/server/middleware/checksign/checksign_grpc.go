@@ -0,0 +1,236 @@
+package checksign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
+)
+
+// The request metadata with the agent signature, the same as the HTTP headers. The signature
+// is taken from the metadata only if the message has no signature field.
+const (
+	agentIDMetadata   = "x-agent-id"
+	signatureMetadata = "x-agent-signature"
+	timestampMetadata = "x-signature-timestamp"
+	nonceMetadata     = "x-signature-nonce"
+)
+
+// signatureGetter is implemented by the request messages with the signature field.
+type signatureGetter interface {
+	GetSignature() string
+}
+
+// NewInterceptor constructs an interceptor to check the agent signature of the request.
+//
+// The agent sends its ID in the x-agent-id metadata and the Ed25519 signature in the signature field
+// of the message or in the x-agent-signature metadata. A gRPC call is a POST request to the full method
+// name, so the signature covers the full method name, the x-signature-timestamp and x-signature-nonce
+// metadata and the marshalled message without its hash and signature fields, like the signature
+// of the HTTP request. The ID of the agent is added to the request context.
+//
+// The requests without the x-agent-id metadata are passed as they are, unless the signature is required.
+func NewInterceptor(log *zap.Logger, registry *agentkeys.Registry, required bool,
+	nonces *nonce.Storage) grpc.UnaryServerInterceptor {
+	l := log.With(zap.String("unary interceptor", "check agent signature"))
+
+	l.Info("added check agent signature unary interceptor", zap.Bool("required", required))
+
+	checkSignFn := func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		sig := newSignature(ctx, info.FullMethod)
+		if sig.agentID == "" {
+			if required {
+				l.Info("request isn't signed by an agent")
+				return nil, status.Error(codes.Unauthenticated, "agent signature is required")
+			}
+			return handler(ctx, req)
+		}
+
+		publicKey, err := lookup(l, registry, sig.agentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = sig.verify(l, publicKey, req); err != nil {
+			return nil, err
+		}
+		if err = sig.checkNonce(l, nonces); err != nil {
+			return nil, err
+		}
+
+		return handler(context.WithValue(ctx, agentIDKey{}, sig.agentID), req)
+	}
+
+	return checkSignFn
+}
+
+// NewStreamInterceptor constructs a stream interceptor to check the agent signature of each received
+// message. The agent, the timestamp and the nonce are set once for the stream, the agent is checked
+// when the stream is opened and the nonce is checked with the first message.
+func NewStreamInterceptor(log *zap.Logger, registry *agentkeys.Registry, required bool,
+	nonces *nonce.Storage) grpc.StreamServerInterceptor {
+	l := log.With(zap.String("stream interceptor", "check agent signature"))
+
+	l.Info("added check agent signature stream interceptor", zap.Bool("required", required))
+
+	checkSignFn := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		sig := newSignature(ss.Context(), info.FullMethod)
+		if sig.agentID == "" {
+			if required {
+				l.Info("stream isn't signed by an agent")
+				return status.Error(codes.Unauthenticated, "agent signature is required")
+			}
+			return handler(srv, ss)
+		}
+
+		publicKey, err := lookup(l, registry, sig.agentID)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &signStream{
+			ServerStream: ss,
+			ctx:          context.WithValue(ss.Context(), agentIDKey{}, sig.agentID),
+			log:          l,
+			nonces:       nonces,
+			sig:          sig,
+			publicKey:    publicKey,
+		})
+	}
+
+	return checkSignFn
+}
+
+// signStream is the server stream signed by the agent, with the agent ID in its context.
+type signStream struct {
+	grpc.ServerStream
+	ctx          context.Context
+	log          *zap.Logger
+	nonces       *nonce.Storage
+	sig          signature
+	publicKey    ed25519.PublicKey
+	nonceChecked bool
+}
+
+func (s *signStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *signStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if err := s.sig.verify(s.log, s.publicKey, m); err != nil {
+		return err
+	}
+
+	// the nonce is checked after the first signature, so the requests without the key can't use the nonces
+	if !s.nonceChecked {
+		if err := s.sig.checkNonce(s.log, s.nonces); err != nil {
+			return err
+		}
+		s.nonceChecked = true
+	}
+
+	return nil
+}
+
+// signature is the agent signature of the call from its metadata.
+type signature struct {
+	agentID        string
+	fullMethod     string
+	timestamp      string
+	nonce          string
+	agentSignature string
+}
+
+func newSignature(ctx context.Context, fullMethod string) signature {
+	sig := signature{fullMethod: fullMethod}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		sig.agentID = firstValue(md, agentIDMetadata)
+		sig.timestamp = firstValue(md, timestampMetadata)
+		sig.nonce = firstValue(md, nonceMetadata)
+		sig.agentSignature = firstValue(md, signatureMetadata)
+	}
+
+	return sig
+}
+
+func (sig signature) verify(l *zap.Logger, publicKey ed25519.PublicKey, req any) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	body, err := hash.MessageBody(msg)
+	if err != nil {
+		l.Info("can't marshal message", zap.Error(err))
+		return status.Error(codes.Internal, "can't check agent signature")
+	}
+
+	agentSignature := sig.agentSignature
+	if sg, signed := req.(signatureGetter); signed && sg.GetSignature() != "" {
+		agentSignature = sg.GetSignature()
+	}
+
+	if !signkeys.Verify(publicKey, http.MethodPost, sig.fullMethod, sig.timestamp, sig.nonce, body,
+		agentSignature) {
+		l.Info("agent signature doesn't match the request", zap.String("agent", sig.agentID))
+		return status.Error(codes.Unauthenticated, "incorrect agent signature")
+	}
+
+	l.Info("agent signature check OK", zap.String("agent", sig.agentID))
+
+	return nil
+}
+
+// checkNonce checks the nonce namespaced by the agent, so an agent can't block the nonces of the others.
+func (sig signature) checkNonce(l *zap.Logger, nonces *nonce.Storage) error {
+	if err := nonces.Check(sig.timestamp, sig.agentID+"\n"+sig.nonce, time.Now()); err != nil {
+		l.Info("replayed or stale request", zap.String("agent", sig.agentID), zap.Error(err),
+			zap.String("timestamp", sig.timestamp), zap.String("nonce", sig.nonce))
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return nil
+}
+
+func lookup(l *zap.Logger, registry *agentkeys.Registry, agentID string) (ed25519.PublicKey, error) {
+	publicKey, err := registry.Lookup(agentID)
+	if err != nil {
+		l.Info("agent isn't allowed", zap.String("agent", agentID), zap.Error(err))
+
+		code := codes.Unauthenticated
+		if errors.Is(err, agentkeys.ErrRevokedAgent) {
+			code = codes.PermissionDenied
+		}
+
+		return nil, status.Error(code, err.Error())
+	}
+
+	return publicKey, nil
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,195 @@
+package checksign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/ivas1ly/uwu-metrics/internal/lib/logger"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+)
+
+const (
+	defaultLogLevel = "info"
+	testBody        = "Somebody once told me the world is gonna roll me"
+)
+
+func TestCheckSign(t *testing.T) {
+	log := logger.New(defaultLogLevel, zap.NewDevelopmentConfig())
+
+	webPublic, webPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	dbPublic, dbPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	registryPath := filepath.Join(t.TempDir(), "agents.json")
+	buf, err := json.Marshal(map[string][]agentkeys.Agent{"agents": {
+		{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(webPublic)},
+		{ID: "db-1", PublicKey: base64.StdEncoding.EncodeToString(dbPublic), Revoked: true},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(registryPath, buf, 0o600))
+
+	registry, err := agentkeys.NewRegistry(registryPath)
+	require.NoError(t, err)
+
+	newServer := func(required bool) *httptest.Server {
+		r := chi.NewRouter()
+		r.Use(New(log, registry, required, nonce.NewStorage(time.Minute)))
+		r.Post("/updates/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Agent", AgentID(r.Context()))
+			w.WriteHeader(http.StatusOK)
+		})
+
+		return httptest.NewServer(r)
+	}
+
+	send := func(t *testing.T, ts *httptest.Server, agentID string, key ed25519.PrivateKey,
+		signedPath, nonce string) *http.Response {
+		t.Helper()
+
+		req, errReq := http.NewRequest(http.MethodPost, ts.URL+"/updates/", strings.NewReader(testBody))
+		require.NoError(t, errReq)
+
+		if agentID != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set("X-Agent-ID", agentID)
+			req.Header.Set("X-Agent-Signature",
+				signkeys.Sign(key, http.MethodPost, signedPath, timestamp, nonce, []byte(testBody)))
+			req.Header.Set("X-Signature-Timestamp", timestamp)
+			req.Header.Set("X-Signature-Nonce", nonce)
+		}
+
+		resp, errDo := ts.Client().Do(req)
+		require.NoError(t, errDo)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	ts := newServer(false)
+	defer ts.Close()
+
+	t.Run("signed request identifies the agent", func(t *testing.T) {
+		resp := send(t, ts, "web-1", webPrivate, "/updates/", "first")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "web-1", resp.Header.Get("X-Agent"))
+
+		resp = send(t, ts, "web-1", webPrivate, "/updates/", "first")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("rejected signatures", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, send(t, ts, "web-1", webPrivate, "/update/", "path").StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, send(t, ts, "web-1", dbPrivate, "/updates/", "key").StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, send(t, ts, "web-2", webPrivate, "/updates/", "unknown").StatusCode)
+		assert.Equal(t, http.StatusForbidden, send(t, ts, "db-1", dbPrivate, "/updates/", "revoked").StatusCode)
+	})
+
+	t.Run("unsigned request", func(t *testing.T) {
+		resp := send(t, ts, "", nil, "", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("X-Agent"))
+
+		required := newServer(true)
+		defer required.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, send(t, required, "", nil, "", "").StatusCode)
+		assert.Equal(t, http.StatusOK, send(t, required, "web-1", webPrivate, "/updates/", "required").StatusCode)
+	})
+}
+
+func TestCheckSignInterceptor(t *testing.T) {
+	webPublic, webPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	dbPublic, dbPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	registryPath := filepath.Join(t.TempDir(), "agents.json")
+	buf, err := json.Marshal(map[string][]agentkeys.Agent{"agents": {
+		{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(webPublic)},
+		{ID: "db-1", PublicKey: base64.StdEncoding.EncodeToString(dbPublic), Revoked: true},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(registryPath, buf, 0o600))
+
+	registry, err := agentkeys.NewRegistry(registryPath)
+	require.NoError(t, err)
+
+	interceptor := NewInterceptor(zap.NewNop(), registry, true, nonce.NewStorage(time.Minute))
+	info := &grpc.UnaryServerInfo{FullMethod: pb.MetricsService_Updates_FullMethodName}
+
+	var agentID string
+	handler := func(ctx context.Context, _ any) (any, error) {
+		agentID = AgentID(ctx)
+		return &emptypb.Empty{}, nil
+	}
+
+	call := func(t *testing.T, agent string, key ed25519.PrivateKey, fullMethod, requestNonce string) error {
+		t.Helper()
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req := &pb.MetricsRequest{IdempotencyKey: "report", Hash: "hash isn't signed"}
+
+		md := metadata.Pairs(timestampMetadata, timestamp, nonceMetadata, requestNonce)
+		if agent != "" {
+			body, errBody := hash.MessageBody(req)
+			require.NoError(t, errBody)
+			req.Signature = signkeys.Sign(key, http.MethodPost, fullMethod, timestamp, requestNonce, body)
+			md.Set(agentIDMetadata, agent)
+		}
+
+		agentID = ""
+		_, errCall := interceptor(metadata.NewIncomingContext(context.Background(), md), req, info, handler)
+
+		return errCall
+	}
+
+	t.Run("signed call identifies the agent", func(t *testing.T) {
+		require.NoError(t, call(t, "web-1", webPrivate, info.FullMethod, "first"))
+		assert.Equal(t, "web-1", agentID)
+
+		err = call(t, "web-1", webPrivate, info.FullMethod, "first")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("rejected signatures", func(t *testing.T) {
+		err = call(t, "web-1", webPrivate, pb.MetricsService_Update_FullMethodName, "method")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		err = call(t, "web-1", dbPrivate, info.FullMethod, "key")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		err = call(t, "web-2", webPrivate, info.FullMethod, "unknown")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		err = call(t, "db-1", dbPrivate, info.FullMethod, "revoked")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		assert.Empty(t, agentID)
+	})
+
+	t.Run("unsigned call", func(t *testing.T) {
+		assert.Equal(t, codes.Unauthenticated, status.Code(call(t, "", nil, "", "unsigned")))
+	})
+}
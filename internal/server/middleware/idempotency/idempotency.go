@@ -0,0 +1,95 @@
+package idempotency
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/dedup"
+)
+
+// Header is the request header with the idempotency key of the batch.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set in the response to a request that was already applied.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// storedResponse is the response of the applied request, it's sent to the replays.
+type storedResponse struct {
+	contentType string
+	body        []byte
+	statusCode  int
+}
+
+// New constructs middleware to apply the POST requests with the same idempotency key only once.
+// The keys are scoped by the path and the request source, so the clients can't replay or block
+// the requests of each other. The middleware is meant for the write endpoints only.
+//
+// A replay of the applied request gets the status code, the Content-Type and the body of the first
+// response, a replay of the request that is still being applied gets 409 Conflict.
+// A request is remembered only if it succeeded, so the failed ones can be retried.
+func New(log *zap.Logger, storage dedup.Storage, source func(r *http.Request) string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		l := log.With(zap.String("middleware", "idempotency"))
+
+		l.Info("added idempotency middleware", zap.Duration("window", storage.Window()))
+
+		idempotencyFn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = source(r) + " " + r.URL.Path + " " + key
+
+			state, response := storage.Begin(key)
+			switch state {
+			case dedup.StateDone:
+				l.Info("request already applied, skip", zap.String("key", key))
+
+				replayed, ok := response.(storedResponse)
+				if !ok {
+					replayed = storedResponse{statusCode: http.StatusOK}
+				}
+				if replayed.contentType != "" {
+					w.Header().Set("Content-Type", replayed.contentType)
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(replayed.statusCode)
+				if _, err := w.Write(replayed.body); err != nil {
+					l.Info("can't write replayed response", zap.Error(err))
+				}
+				return
+			case dedup.StatePending:
+				l.Info("request with the same key is in progress", zap.String("key", key))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, render.M{"message": "request with the same idempotency key is in progress"})
+				return
+			}
+
+			// the body is copied, so it can be replayed
+			var body bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&body)
+
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() >= http.StatusOK && ww.Status() < http.StatusMultipleChoices {
+				storage.Done(key, storedResponse{
+					contentType: ww.Header().Get("Content-Type"),
+					body:        body.Bytes(),
+					statusCode:  ww.Status(),
+				})
+			} else {
+				storage.Cancel(key)
+			}
+		}
+
+		return http.HandlerFunc(idempotencyFn)
+	}
+}
@@ -0,0 +1,79 @@
+package idempotency
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/dedup"
+)
+
+// metadataKey is the request metadata with the idempotency key of the messages without the key field.
+const metadataKey = "idempotency-key"
+
+// keyGetter is implemented by the request messages with the idempotency_key field.
+type keyGetter interface {
+	GetIdempotencyKey() string
+}
+
+// NewInterceptor constructs an interceptor to apply the requests with the same idempotency key only once.
+// A replay of the applied request gets the response of the first one. The keys are scoped by the method
+// and the request source, the interceptor is meant for the write methods only.
+func NewInterceptor(log *zap.Logger, storage dedup.Storage,
+	source func(ctx context.Context) string) grpc.UnaryServerInterceptor {
+	l := log.With(zap.String("unary interceptor", "idempotency"))
+
+	l.Info("added idempotency unary interceptor", zap.Duration("window", storage.Window()))
+
+	idempotencyFn := func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		key := requestKey(ctx, req)
+		if key == "" {
+			return handler(ctx, req)
+		}
+		key = source(ctx) + " " + info.FullMethod + " " + key
+
+		state, response := storage.Begin(key)
+		switch state {
+		case dedup.StateDone:
+			l.Info("request already applied, skip", zap.String("key", key))
+			return response, nil
+		case dedup.StatePending:
+			l.Info("request with the same key is in progress", zap.String("key", key))
+			return nil, status.Error(codes.Aborted, "request with the same idempotency key is in progress")
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			storage.Cancel(key)
+			return resp, err
+		}
+
+		storage.Done(key, resp)
+
+		return resp, nil
+	}
+
+	return idempotencyFn
+}
+
+// requestKey returns the idempotency key of the request message. The metadata key is used only by
+// the messages without the key field, e.g. the StreamUpdates batches share the stream metadata,
+// so each batch is keyed by its own message.
+func requestKey(ctx context.Context, req any) string {
+	if kg, ok := req.(keyGetter); ok {
+		return kg.GetIdempotencyKey()
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(metadataKey); len(values) > 0 {
+			return values[0]
+		}
+	}
+
+	return ""
+}
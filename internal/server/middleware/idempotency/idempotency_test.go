@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ivas1ly/uwu-metrics/internal/lib/logger"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/dedup"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+)
+
+const (
+	defaultLogLevel          = "info"
+	defaultTestClientTimeout = 3 * time.Second
+)
+
+func TestIdempotency(t *testing.T) {
+	log := logger.New(defaultLogLevel, zap.NewDevelopmentConfig()).
+		With(zap.String("app", "test"))
+
+	applied := 0
+	fail := false
+
+	source := func(r *http.Request) string {
+		return r.Header.Get("X-Agent-ID")
+	}
+
+	r := chi.NewRouter()
+	r.Use(New(log, dedup.NewDedupStorage(time.Minute), source))
+	r.Post("/updates/", func(w http.ResponseWriter, _ *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		applied++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"applied":` + strconv.Itoa(applied) + `}`))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	t.Run("replay is not applied", func(t *testing.T) {
+		applied = 0
+
+		resp := testRequest(t, ts, "agent-1", "first")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(ReplayedHeader))
+
+		resp = testRequest(t, ts, "agent-1", "first")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "true", resp.Header.Get(ReplayedHeader))
+
+		// the replay gets the response of the applied request
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"applied":1}`, string(body))
+
+		assert.Equal(t, 1, applied)
+	})
+
+	t.Run("failed request can be retried", func(t *testing.T) {
+		applied = 0
+
+		fail = true
+		resp := testRequest(t, ts, "agent-1", "second")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		fail = false
+		resp = testRequest(t, ts, "agent-1", "second")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(ReplayedHeader))
+
+		assert.Equal(t, 1, applied)
+	})
+
+	t.Run("keys are scoped by source", func(t *testing.T) {
+		applied = 0
+
+		resp := testRequest(t, ts, "agent-1", "third")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = testRequest(t, ts, "agent-2", "third")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(ReplayedHeader))
+
+		assert.Equal(t, 2, applied)
+	})
+
+	t.Run("without key", func(t *testing.T) {
+		applied = 0
+
+		for i := 0; i < 2; i++ {
+			resp := testRequest(t, ts, "agent-1", "")
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		assert.Equal(t, 2, applied)
+	})
+}
+
+func testRequest(t *testing.T, ts *httptest.Server, source, key string) *http.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTestClientTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/updates/", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("X-Agent-ID", source)
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func TestRequestKey(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(metadataKey, "stream-key"))
+
+	// the batches of a stream share the stream metadata, so the message key is the only one
+	assert.Equal(t, "batch-key", requestKey(ctx, &pb.MetricsRequest{IdempotencyKey: "batch-key"}))
+	assert.Empty(t, requestKey(ctx, &pb.MetricsRequest{}))
+
+	// the messages without the key field use the metadata
+	assert.Equal(t, "stream-key", requestKey(ctx, &pb.Metric{}))
+	assert.Empty(t, requestKey(context.Background(), &pb.Metric{}))
+}
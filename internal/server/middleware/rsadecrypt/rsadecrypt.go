@@ -2,24 +2,26 @@ package rsadecrypt
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
 	"io"
 	"net/http"
 
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
 )
 
-// New constructs middleware to decrypt body with RSA private key.
-func New(log *zap.Logger, key *rsa.PrivateKey) func(next http.Handler) http.Handler {
+// New constructs middleware to decrypt body with RSA private keys of the keyring,
+// the body is an envelope with the AES-GCM data key wrapped with one of the public keys.
+func New(log *zap.Logger, keys *rsakeys.Keyring) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		l := log.With(zap.String("middleware", "rsa decrypt"))
 
 		l.Info("added rsa decrypt middleware")
 
 		setHashFn := func(w http.ResponseWriter, r *http.Request) {
-			if key == nil {
+			keyring := keys.Get()
+			if keyring == nil {
 				l.Info("rsa private key is empty, skip body decryption")
 				next.ServeHTTP(w, r)
 				return
@@ -34,11 +36,17 @@ func New(log *zap.Logger, key *rsa.PrivateKey) func(next http.Handler) http.Hand
 				return
 			}
 
-			decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, key, buf)
+			if len(buf) == 0 {
+				// the requests without the body, e.g. GET, aren't encrypted
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decrypted, err := keyring.Open(buf)
 			if err != nil {
-				l.Info("can't get decrypt body")
+				l.Info("can't get decrypt body", zap.Error(err))
 
-				w.WriteHeader(http.StatusInternalServerError)
+				w.WriteHeader(http.StatusBadRequest)
 				render.JSON(w, r, render.M{"message": "can't get decrypt body"})
 				return
 			}
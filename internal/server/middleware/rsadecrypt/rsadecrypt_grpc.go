@@ -0,0 +1,95 @@
+package rsadecrypt
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
+)
+
+// encryptedGetter is implemented by the request messages with the encrypted field.
+type encryptedGetter interface {
+	GetEncrypted() []byte
+}
+
+// NewInterceptor constructs an interceptor to decrypt the requests with RSA private keys of the keyring.
+// The encrypted field of the message is the envelope, it's decrypted and unmarshalled in place of the message,
+// the requests without the field are passed as they are.
+func NewInterceptor(log *zap.Logger, keys *rsakeys.Keyring) grpc.UnaryServerInterceptor {
+	l := log.With(zap.String("unary interceptor", "rsa decrypt"))
+
+	l.Info("added rsa decrypt unary interceptor")
+
+	decryptFn := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		if err := decrypt(l, req, keys); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+
+	return decryptFn
+}
+
+// NewStreamInterceptor constructs a stream interceptor to decrypt each received message
+// with RSA private keys of the keyring.
+func NewStreamInterceptor(log *zap.Logger, keys *rsakeys.Keyring) grpc.StreamServerInterceptor {
+	l := log.With(zap.String("stream interceptor", "rsa decrypt"))
+
+	l.Info("added rsa decrypt stream interceptor")
+
+	decryptFn := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &decryptStream{ServerStream: ss, log: l, keys: keys})
+	}
+
+	return decryptFn
+}
+
+type decryptStream struct {
+	grpc.ServerStream
+	log  *zap.Logger
+	keys *rsakeys.Keyring
+}
+
+func (s *decryptStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return decrypt(s.log, m, s.keys)
+}
+
+func decrypt(l *zap.Logger, req any, keys *rsakeys.Keyring) error {
+	eg, ok := req.(encryptedGetter)
+	if !ok || len(eg.GetEncrypted()) == 0 {
+		return nil
+	}
+
+	keyring := keys.Get()
+	msg, ok := req.(proto.Message)
+	if !ok || keyring == nil {
+		l.Info("rsa private key is empty, can't decrypt request")
+		return status.Error(codes.InvalidArgument, "can't decrypt request")
+	}
+
+	decrypted, err := keyring.Open(eg.GetEncrypted())
+	if err != nil {
+		l.Info("can't decrypt request", zap.Error(err))
+		return status.Error(codes.InvalidArgument, "can't decrypt request")
+	}
+
+	proto.Reset(msg)
+	if err = proto.Unmarshal(decrypted, msg); err != nil {
+		l.Info("can't unmarshal decrypted request", zap.Error(err))
+		return status.Error(codes.InvalidArgument, "can't decrypt request")
+	}
+	l.Info("request decrypted")
+
+	return nil
+}
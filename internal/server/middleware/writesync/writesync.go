@@ -1,8 +1,8 @@
 package writesync
 
 import (
+	"context"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -28,27 +28,27 @@ func New(storage persistent.Storage, log *zap.Logger) func(next http.Handler) ht
 
 			next.ServeHTTP(ww, r)
 
-			header := ww.Header().Get("Content-Type")
-			//nolint:whitespace //necessary leading newline
-			if ww.Status() == http.StatusOK &&
-				r.Method == http.MethodPost &&
-				strings.Contains(header, "text/plain") ||
-				strings.Contains(header, "application/json") {
-
-				for _, interval := range retryIntervals {
-					err := storage.Save(r.Context())
-					if err != nil {
-						l.Info("can't save metrics, trying to save metrics again", zap.Error(err),
-							zap.Duration("with interval", interval))
-						time.Sleep(interval)
-					} else {
-						l.Info("all metrics saved successfully")
-						break
-					}
-				}
+			// any successful POST request may change the metrics, whatever the response encoding is
+			if r.Method == http.MethodPost && ww.Status() >= http.StatusOK && ww.Status() < http.StatusMultipleChoices {
+				Save(r.Context(), storage, l)
 			}
 		}
 
 		return http.HandlerFunc(syncFn)
 	}
 }
+
+// Save writes the metrics to the persistent storage, the failed writes are retried after the retry intervals.
+func Save(ctx context.Context, storage persistent.Storage, l *zap.Logger) {
+	for _, interval := range retryIntervals {
+		err := storage.Save(ctx)
+		if err != nil {
+			l.Info("can't save metrics, trying to save metrics again", zap.Error(err),
+				zap.Duration("with interval", interval))
+			time.Sleep(interval)
+		} else {
+			l.Info("all metrics saved successfully")
+			break
+		}
+	}
+}
@@ -2,7 +2,6 @@ package writesync
 
 import (
 	"context"
-	"time"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent"
 	"go.uber.org/zap"
@@ -21,17 +20,7 @@ func NewInterceptor(storage persistent.Storage, log *zap.Logger) grpc.UnaryServe
 		resp, err := handler(ctx, req)
 
 		if status.Code(err) == codes.OK {
-			for _, interval := range retryIntervals {
-				errSave := storage.Save(ctx)
-				if errSave != nil {
-					l.Info("can't save metrics, trying to save metrics again", zap.Error(errSave),
-						zap.Duration("with interval", interval))
-					time.Sleep(interval)
-				} else {
-					l.Info("all metrics saved successfully")
-					break
-				}
-			}
+			Save(ctx, storage, l)
 		}
 
 		return resp, err
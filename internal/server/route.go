@@ -1,13 +1,17 @@
 package server
 
 import (
-	"crypto/rsa"
-	"net"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
 	// Install the gzip compressor
@@ -21,90 +25,285 @@ import (
 	handlers "github.com/ivas1ly/uwu-metrics/internal/server/handlers/http"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkhash"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checkip"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/checksign"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/decompress"
+	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/idempotency"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/reqlogger"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/rsadecrypt"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/sethash"
 	"github.com/ivas1ly/uwu-metrics/internal/server/middleware/writesync"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/agentkeys"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/dedup"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent"
 	"github.com/ivas1ly/uwu-metrics/internal/utils/rsakeys"
 	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+	pbv2 "github.com/ivas1ly/uwu-metrics/pkg/api/metrics/v2"
 )
 
-const unaryInterceptorsCap = 5
+const (
+	unaryInterceptorsCap = 5
+	// maxClockSkew is the maximum difference between the signature timestamp and the server time.
+	maxClockSkew = 5 * time.Minute
+)
 
 type MetricsService interface {
-	UpsertMetric(mType, mName, mValue string) error
-	GetMetric(mType, mName string) (*int64, *float64, error)
+	UpsertMetric(mType, mName, mValue string, labels map[string]string) error
+	GetMetric(mType, mName string, labels map[string]string) (*int64, *float64, error)
 	GetAllMetrics() entity.Metrics
 	UpsertTypeMetric(metric *entity.Metric) (*entity.Metric, error)
+	UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error)
+	GetHistory(mType, mName string, labels map[string]string, from, to time.Time,
+		step time.Duration) ([]entity.HistoryPoint, error)
+	GetHistogram(mName string, labels map[string]string) (*entity.Histogram, error)
+	ListMetrics(filter entity.ListFilter) (*entity.MetricsPage, error)
+	Watch(ctx context.Context, filter entity.MetricFilter) (<-chan *entity.Metric, error)
 }
 
 // NewRouter creates a new HTTP router and adds common middlewares for all handlers.
+// The nonces of the signed requests are shared with the gRPC server.
 func NewRouter(metricsService MetricsService, persistentStorage persistent.Storage,
-	db *postgres.DB, cfg Config, log *zap.Logger) *chi.Mux {
+	db *postgres.DB, nonces *nonce.Storage, cfg Config, log *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
 
-	_, trustedSubnet, err := net.ParseCIDR(cfg.TrustedSubnet)
-	if err != nil {
-		log.Warn("can't parse trusted subnet CIDR")
-	}
-
-	if trustedSubnet != nil {
-		router.Use(checkip.New(log, trustedSubnet))
+	if policy := parseIPPolicy(cfg, log); policy != nil {
+		router.Use(checkip.New(log, policy))
 	}
 
 	router.Use(middleware.Compress(defaultCompressLevel))
 	router.Use(decompress.New(log))
 
-	var privateKey *rsa.PrivateKey
+	var keyring *rsakeys.Keyring
 	if cfg.PrivateKeyPath != "" {
-		privateKey, err = rsakeys.PrivateKey(cfg.PrivateKeyPath)
-		if err != nil {
-			log.Warn("can't get private key from file", zap.Error(err))
-		}
-		log.Info("private key successfully loaded")
-		router.Use(rsadecrypt.New(log, privateKey))
+		keyring = loadKeyring(cfg, log)
+		router.Use(agentOnly(rsadecrypt.New(log, keyring)))
 	}
 
 	router.Use(reqlogger.New(log))
 	if cfg.HashKey != "" {
-		router.Use(checkhash.New(log, []byte(cfg.HashKey)))
+		router.Use(agentWritesOnly(checkhash.Require(log)))
+		router.Use(checkhash.New(log, []byte(cfg.HashKey), cfg.HashCompat, nonces))
 		router.Use(sethash.New(log, []byte(cfg.HashKey)))
 	}
 
+	if cfg.AgentKeysPath != "" {
+		router.Use(checksign.New(log, loadAgentKeys(cfg, log), cfg.AgentSignRequired, nonces))
+	}
+
+	// the write sync and the idempotency are applied only to the endpoints that change the metrics
+	var writeMiddlewares []func(http.Handler) http.Handler
 	if cfg.StoreInterval == 0 {
 		log.Info("all data will be saved synchronously", zap.Int("store interval", cfg.StoreInterval))
-		router.Use(writesync.New(persistentStorage, log))
+		writeMiddlewares = append(writeMiddlewares, writesync.New(persistentStorage, log))
+	}
+	if cfg.IdempotencyWindow > 0 {
+		idempotencyStorage := dedup.NewDedupStorage(cfg.IdempotencyWindow)
+		writeMiddlewares = append(writeMiddlewares, idempotency.New(log, idempotencyStorage, handlers.RequestSource))
+	}
+
+	opts := []handlers.Option{handlers.WithWriteMiddlewares(writeMiddlewares...)}
+	if err := handlers.ValidateInfluxRules(cfg.InfluxRules); err != nil {
+		log.Warn("can't use line protocol rules, all integer fields are saved as gauges", zap.Error(err))
+	} else {
+		opts = append(opts, handlers.WithInfluxRules(cfg.InfluxRules))
 	}
 
-	handlers.NewRoutes(router, metricsService, log)
+	handlers.NewRoutes(router, metricsService, log, opts...)
 
 	router.Get("/ping", handlers.PingDB(db, log))
+	router.Get("/keys", handlers.ActiveKeys(keyring))
 
 	return router
 }
 
+// NewgRPCServer creates a new gRPC server with the interceptors, the server uses TLS
+// if the TLS config is set. The nonces of the signed requests are shared with the HTTP server.
 func NewgRPCServer(metricsService MetricsService, persistentStorage persistent.Storage,
-	cfg Config, log *zap.Logger) *grpc.Server {
+	nonces *nonce.Storage, cfg Config, tlsConfig *tls.Config, log *zap.Logger) *grpc.Server {
+	// the security interceptors run before the others, the StreamUpdates batches are received
+	// through the stream interceptors, so they run only the others
+	var (
+		securityInterceptors []grpc.UnaryServerInterceptor
+		streamInterceptors   []grpc.StreamServerInterceptor
+	)
+
+	if policy := parseIPPolicy(cfg, log); policy != nil {
+		securityInterceptors = append(securityInterceptors, checkip.NewInterceptor(log, policy))
+		streamInterceptors = append(streamInterceptors, checkip.NewStreamInterceptor(log, policy))
+	}
+
+	if cfg.PrivateKeyPath != "" {
+		keyring := loadKeyring(cfg, log)
+		securityInterceptors = append(securityInterceptors, rsadecrypt.NewInterceptor(log, keyring))
+		streamInterceptors = append(streamInterceptors, rsadecrypt.NewStreamInterceptor(log, keyring))
+	}
+
+	// the hash is required for the write methods only, like for the HTTP agent writes
+	if cfg.HashKey != "" {
+		securityInterceptors = append(securityInterceptors,
+			writeOnly(checkhash.NewInterceptor(log, []byte(cfg.HashKey), cfg.HashCompat, nonces)))
+		streamInterceptors = append(streamInterceptors,
+			writeOnlyStream(checkhash.NewStreamInterceptor(log, []byte(cfg.HashKey), cfg.HashCompat, nonces)))
+	}
+
+	// the agent signature is required for the write methods only, like for the HTTP requests
+	if cfg.AgentKeysPath != "" {
+		registry := loadAgentKeys(cfg, log)
+		securityInterceptors = append(securityInterceptors,
+			writeOnly(checksign.NewInterceptor(log, registry, cfg.AgentSignRequired, nonces)))
+		streamInterceptors = append(streamInterceptors,
+			writeOnlyStream(checksign.NewStreamInterceptor(log, registry, cfg.AgentSignRequired, nonces)))
+	}
+
 	unaryInterceptors := make([]grpc.UnaryServerInterceptor, 0, unaryInterceptorsCap)
 	unaryInterceptors = append(unaryInterceptors,
 		reqlogger.NewInterceptor(log),
 	)
 
+	if cfg.IdempotencyWindow > 0 {
+		idempotencyStorage := dedup.NewDedupStorage(cfg.IdempotencyWindow)
+		unaryInterceptors = append(unaryInterceptors,
+			writeOnly(idempotency.NewInterceptor(log, idempotencyStorage, gRPCHandlers.RequestSource)))
+	}
+
 	if cfg.StoreInterval == 0 {
 		log.Info("all data will be saved synchronously", zap.Int("store interval", cfg.StoreInterval))
-		unaryInterceptors = append(unaryInterceptors, writesync.NewInterceptor(persistentStorage, log))
+		unaryInterceptors = append(unaryInterceptors, writeOnly(writesync.NewInterceptor(persistentStorage, log)))
+	}
+
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
 	}
 
 	server := grpc.NewServer(
-		grpc.Creds(insecure.NewCredentials()),
-		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.Creds(creds),
+		grpc.ChainUnaryInterceptor(append(securityInterceptors, unaryInterceptors...)...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	)
 
 	reflection.Register(server)
 
-	pb.RegisterMetricsServiceServer(server, gRPCHandlers.NewRoutes(metricsService, log))
+	pb.RegisterMetricsServiceServer(server, gRPCHandlers.NewRoutes(metricsService, log,
+		gRPCHandlers.WithBatchInterceptors(unaryInterceptors...)))
+	pbv2.RegisterMetricsServiceServer(server, gRPCHandlers.NewRoutesV2(metricsService, log))
 
 	return server
 }
+
+// agentRoutes are the path prefixes of the JSON API of the agent.
+var agentRoutes = []string{"/update/", "/updates/", "/value/"}
+
+// agentWriteRoutes are the path prefixes of the JSON API of the agent that change the metrics.
+var agentWriteRoutes = []string{"/update/", "/updates/"}
+
+// agentOnly applies the middleware only to the agent routes, the other requests, e.g. the OTLP
+// and remote write ones, are passed as they are.
+func agentOnly(middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return routesOnly(agentRoutes, middleware)
+}
+
+// agentWritesOnly applies the middleware only to the agent routes that change the metrics.
+func agentWritesOnly(middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return routesOnly(agentWriteRoutes, middleware)
+}
+
+func routesOnly(prefixes []string, middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := middleware(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					wrapped.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeMethods are the RPCs that change the metrics.
+var writeMethods = map[string]struct{}{
+	pb.MetricsService_Update_FullMethodName:        {},
+	pb.MetricsService_Updates_FullMethodName:       {},
+	pb.MetricsService_StreamUpdates_FullMethodName: {},
+	pbv2.MetricsService_Updates_FullMethodName:     {},
+}
+
+// writeOnly applies the interceptor only to the write methods, the other requests are passed as they are.
+func writeOnly(interceptor grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := writeMethods[info.FullMethod]; !ok {
+			return handler(ctx, req)
+		}
+
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+// writeOnlyStream applies the stream interceptor only to the write methods, e.g. the Watch streams
+// are passed as they are.
+func writeOnlyStream(interceptor grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := writeMethods[info.FullMethod]; !ok {
+			return handler(srv, ss)
+		}
+
+		return interceptor(srv, ss, info, handler)
+	}
+}
+
+// parseIPPolicy returns the client address policy or nil, if the trusted and denied subnets aren't set.
+// If the policy can't be parsed, all requests are rejected.
+func parseIPPolicy(cfg Config, log *zap.Logger) *checkip.Policy {
+	if cfg.TrustedSubnet == "" && cfg.DeniedSubnets == "" {
+		return nil
+	}
+
+	policy, err := checkip.ParsePolicy(cfg.ClientIPMode, cfg.TrustedSubnet, cfg.DeniedSubnets, cfg.TrustedProxies)
+	if err != nil {
+		log.Error("can't parse client address policy, all requests are rejected", zap.Error(err))
+		return checkip.DenyAll()
+	}
+
+	return policy
+}
+
+// loadKeyring returns the keyring with the private keys or nil, if they can't be loaded.
+// The keys are loaded again when the files or directories are modified.
+func loadKeyring(cfg Config, log *zap.Logger) *rsakeys.Keyring {
+	keyring, err := rsakeys.NewKeyring(cfg.PrivateKeyPath)
+	if err != nil {
+		log.Warn("can't get private keys from files", zap.Error(err))
+		return nil
+	}
+
+	keyring.OnReloadError(func(err error) {
+		log.Error("can't reload private keys, the previous keys are used", zap.Error(err))
+	})
+
+	log.Info("private keys successfully loaded", zap.Strings("key IDs", keyring.Get().IDs()))
+
+	return keyring
+}
+
+// loadAgentKeys returns the registry of the agent public keys or nil, if it can't be loaded.
+// Without the registry all signed requests are rejected.
+func loadAgentKeys(cfg Config, log *zap.Logger) *agentkeys.Registry {
+	registry, err := agentkeys.NewRegistry(cfg.AgentKeysPath)
+	if err != nil {
+		log.Error("can't load agent keys, the signed requests are rejected", zap.Error(err))
+		return nil
+	}
+
+	registry.OnReloadError(func(err error) {
+		log.Error("can't reload agent keys, the previous keys are used", zap.Error(err))
+	})
+
+	log.Info("agent keys successfully loaded", zap.Int("agents", registry.Len()))
+
+	return registry
+}
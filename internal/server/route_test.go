@@ -1,18 +1,38 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	handlers "github.com/ivas1ly/uwu-metrics/internal/server/handlers/http"
 	"github.com/ivas1ly/uwu-metrics/internal/server/service"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/envelope"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+	pb "github.com/ivas1ly/uwu-metrics/pkg/api/metrics"
+	pbv2 "github.com/ivas1ly/uwu-metrics/pkg/api/metrics/v2"
 )
 
 const (
@@ -25,7 +45,7 @@ func TestRoute(t *testing.T) {
 	metricsService := service.NewMetricsService(ms)
 	cfg := NewConfig()
 
-	router := NewRouter(metricsService, nil, nil, cfg, log)
+	router := NewRouter(metricsService, nil, nil, nonce.NewStorage(maxClockSkew), cfg, log)
 
 	ts := httptest.NewServer(router)
 	defer ts.Close()
@@ -43,6 +63,186 @@ func TestRoute(t *testing.T) {
 	})
 }
 
+func TestRouteLineProtocol(t *testing.T) {
+	log := zap.Must(zap.NewDevelopment())
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+
+	cfg := NewConfig()
+	cfg.HashKey = "uwu"
+	cfg.TrustedSubnet = "192.168.0.0/16"
+	// the test server is the proxy that sets X-Real-IP
+	cfg.TrustedProxies = "127.0.0.0/8"
+	cfg.InfluxRules = []handlers.InfluxRule{{Match: "net_bytes_*", Type: entity.CounterType}}
+
+	router := NewRouter(metricsService, nil, nil, nonce.NewStorage(maxClockSkew), cfg, log)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	body := []byte("net,host=server01 bytes_recv=1000i 1700000000000000000\n")
+
+	write := func(t *testing.T, realIP, sign, timestamp string) int {
+		t.Helper()
+
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		_, err := zw.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/write", &compressed)
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("X-Real-IP", realIP)
+		req.Header.Set("HashSHA256", sign)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature-Nonce", "nonce-"+realIP)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sign, err := hash.RequestHash(http.MethodPost, "/write", timestamp, "nonce-192.168.1.1", body, []byte(cfg.HashKey))
+	require.NoError(t, err)
+
+	t.Run("untrusted subnet", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, write(t, "10.0.0.1", sign, timestamp))
+	})
+
+	t.Run("incorrect hash", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, write(t, "192.168.1.1", "uwu", timestamp))
+	})
+
+	t.Run("gzip body with correct hash", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, write(t, "192.168.1.1", sign, timestamp))
+
+		received, _, err := metricsService.GetMetric(entity.CounterType, "net_bytes_recv",
+			map[string]string{"host": "server01"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000), *received)
+	})
+
+	t.Run("unsigned write", func(t *testing.T) {
+		// the line protocol clients don't sign the requests, the hash is required for the agent writes only
+		assert.Equal(t, http.StatusNoContent, write(t, "192.168.1.1", "", ""))
+	})
+
+	agentRequest := func(t *testing.T, path string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path,
+			strings.NewReader(`{"id":"PollCount","type":"counter","delta":1}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Real-IP", "192.168.1.1")
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("unsigned agent write", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, agentRequest(t, "/update/"))
+	})
+
+	t.Run("unsigned value request", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, agentRequest(t, "/value/"))
+	})
+}
+
+func TestRouteEncryptedPayloads(t *testing.T) {
+	log := zap.Must(zap.NewDevelopment())
+	metricsService := service.NewMetricsService(memory.NewMemStorage())
+
+	dir := t.TempDir()
+	keys := make([]*rsa.PrivateKey, 0, 2)
+	for _, name := range []string{"old.pem", "new.pem"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keys = append(keys, key)
+
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600))
+	}
+
+	cfg := NewConfig()
+	cfg.PrivateKeyPath = dir
+
+	router := NewRouter(metricsService, nil, nil, nonce.NewStorage(maxClockSkew), cfg, log)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	t.Run("active keys", func(t *testing.T) {
+		resp := testRequest(t, ts, http.MethodGet, "/keys")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var res handlers.ActiveKeysRes
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.ElementsMatch(t, []string{envelope.KeyID(&keys[0].PublicKey), envelope.KeyID(&keys[1].PublicKey)},
+			res.KeyIDs)
+	})
+
+	t.Run("payloads of both keys", func(t *testing.T) {
+		for i, key := range keys {
+			body, err := envelope.Seal(&key.PublicKey, []byte(`[{"id":"PollCount","type":"counter","delta":1}]`))
+			require.NoError(t, err)
+
+			resp, err := ts.Client().Post(ts.URL+"/updates/", "application/json", bytes.NewReader(body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			delta, _, err := metricsService.GetMetric(entity.CounterType, "PollCount", nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(i+1), *delta)
+		}
+	})
+
+	t.Run("added key is loaded without restart", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "next.pem"), pem.EncodeToMemory(block), 0600))
+		// the directory modification time is changed, even if the file system has a coarse resolution
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(dir, later, later))
+
+		body, err := envelope.Seal(&key.PublicKey, []byte(`[{"id":"Rotated","type":"counter","delta":1}]`))
+		require.NoError(t, err)
+
+		// the keys are checked at most once per reload.CheckInterval
+		assert.Eventually(t, func() bool {
+			resp, errPost := ts.Client().Post(ts.URL+"/updates/", "application/json", bytes.NewReader(body))
+			if errPost != nil {
+				return false
+			}
+			resp.Body.Close()
+
+			return resp.StatusCode == http.StatusOK
+		}, 3*reload.CheckInterval, 50*time.Millisecond)
+	})
+
+	t.Run("other routes aren't decrypted", func(t *testing.T) {
+		resp, err := ts.Client().Post(ts.URL+"/write", "text/plain", strings.NewReader("cpu usage=1.5"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		_, usage, err := metricsService.GetMetric(entity.GaugeType, "cpu_usage", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1.5, *usage)
+	})
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string) *http.Response {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTestClientTimeout)
 	defer cancel()
@@ -55,3 +255,30 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string) *http.R
 
 	return resp
 }
+
+func TestWriteOnly(t *testing.T) {
+	var intercepted []string
+	interceptor := writeOnly(func(ctx context.Context, req any, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (any, error) {
+		intercepted = append(intercepted, info.FullMethod)
+		return handler(ctx, req)
+	})
+
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	for _, method := range []string{
+		pb.MetricsService_Update_FullMethodName,
+		pb.MetricsService_Value_FullMethodName,
+		pb.MetricsService_List_FullMethodName,
+		pb.MetricsService_StreamUpdates_FullMethodName,
+		pbv2.MetricsService_Updates_FullMethodName,
+	} {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		pb.MetricsService_Update_FullMethodName,
+		pb.MetricsService_StreamUpdates_FullMethodName,
+		pbv2.MetricsService_Updates_FullMethodName,
+	}, intercepted)
+}
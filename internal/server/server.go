@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -19,13 +20,25 @@ import (
 	"github.com/ivas1ly/uwu-metrics/internal/lib/logger"
 	"github.com/ivas1ly/uwu-metrics/internal/lib/postgres"
 	"github.com/ivas1ly/uwu-metrics/internal/migrate"
+	"github.com/ivas1ly/uwu-metrics/internal/server/handlers/graphite"
+	"github.com/ivas1ly/uwu-metrics/internal/server/handlers/statsd"
 	"github.com/ivas1ly/uwu-metrics/internal/server/service"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/history"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/nonce"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent/database"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/persistent/file"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/tlsconfig"
 )
 
+// listener is a server of an additional ingestion protocol, it's started and gracefully stopped
+// along with the HTTP and gRPC servers.
+type listener interface {
+	ListenAndServe() error
+	Shutdown(ctx context.Context) error
+}
+
 // Run starts the metrics server with the specified configuration.
 func Run(cfg Config) {
 	log := logger.New(defaultLogLevel, logger.NewDefaultLoggerConfig()).
@@ -54,10 +67,33 @@ func Run(cfg Config) {
 		log.Info("can't restore metrics from persistent storage", zap.Error(err))
 	}
 
-	metricsService := service.NewMetricsService(memStorage)
+	opts := []service.Option{service.WithHistogramBuckets(cfg.HistogramBuckets)}
+	if cfg.HistoryRetention > 0 {
+		log.Info("metrics history enabled", zap.Duration("retention", cfg.HistoryRetention),
+			zap.Duration("resolution", cfg.HistoryResolution))
+		opts = append(opts, service.WithHistory(history.NewHistoryStorage(cfg.HistoryRetention, cfg.HistoryResolution)))
+	}
+
+	metricsService := service.NewMetricsService(memStorage, opts...)
+
+	var tlsConfig *tls.Config
+	if cfg.TLSCertPath != "" {
+		tlsConfig, err = tlsconfig.Server(cfg.TLSCertPath, cfg.TLSKeyPath, cfg.TLSClientCAPath)
+		if err != nil {
+			log.Error("can't load TLS certificate, the servers aren't started", zap.Error(err))
+			return
+		}
+		log.Info("TLS enabled", zap.Bool("client certificates", cfg.TLSClientCAPath != ""))
+	}
+
+	// the HTTP and gRPC servers share the nonces, so a signed request can't be replayed over the other one
+	nonces := nonce.NewStorage(maxClockSkew)
 
-	router := NewRouter(metricsService, persistentStorage, db, cfg, log.With(zap.String("server", "HTTP")))
-	grpc := NewgRPCServer(metricsService, persistentStorage, cfg, log.With(zap.String("server", "gRPC")))
+	router := NewRouter(metricsService, persistentStorage, db, nonces, cfg, log.With(zap.String("server", "HTTP")))
+	grpc := NewgRPCServer(metricsService, persistentStorage, nonces, cfg, tlsConfig,
+		log.With(zap.String("server", "gRPC")))
+
+	listeners := newListeners(cfg, metricsService, persistentStorage, log)
 
 	if cfg.FileStoragePath != "" && cfg.StoreInterval > 0 {
 		log.Info("all data will be saved asynchronously", zap.Int("store interval", cfg.StoreInterval))
@@ -68,7 +104,8 @@ func Run(cfg Config) {
 	notifyCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
 
-	if err := runServer(notifyCtx, cfg.Endpoint, cfg.GRPCEndpoint, router, grpc, log); err != nil {
+	if err := runServer(notifyCtx, cfg.Endpoint, cfg.GRPCEndpoint, tlsConfig, router, grpc, log,
+		listeners...); err != nil {
 		log.Info("HTTP server", zap.Error(err))
 	}
 
@@ -82,8 +119,47 @@ func Run(cfg Config) {
 	}
 }
 
-func runServer(ctx context.Context, endpoint, gRPCEndpoint string, router *chi.Mux,
-	gRPCServer *grpc.Server, log *zap.Logger) error {
+// newListeners creates the servers of the enabled additional ingestion protocols, they share
+// the client address policy and the write sync with the HTTP and gRPC servers.
+func newListeners(cfg Config, metricsService *service.MetricsService, persistentStorage persistent.Storage,
+	log *zap.Logger) []listener {
+	var listeners []listener
+	if cfg.StatsDEndpoint != "" {
+		var statsdOpts []statsd.Option
+		if policy := parseIPPolicy(cfg, log); policy != nil {
+			statsdOpts = append(statsdOpts, statsd.WithIPPolicy(policy))
+		}
+		if cfg.StoreInterval == 0 {
+			statsdOpts = append(statsdOpts, statsd.WithWriteSync(persistentStorage))
+		}
+		listeners = append(listeners, statsd.NewServer(cfg.StatsDEndpoint, cfg.StatsDFlushInterval, metricsService,
+			log, statsdOpts...))
+	}
+	if cfg.GraphiteEndpoint != "" {
+		mapper, errMapper := graphite.NewMapper(cfg.GraphiteMappings)
+		if errMapper != nil {
+			log.Info("can't create Graphite mapping rules, Graphite server isn't started", zap.Error(errMapper))
+		} else {
+			var graphiteOpts []graphite.Option
+			if policy := parseIPPolicy(cfg, log); policy != nil {
+				graphiteOpts = append(graphiteOpts, graphite.WithIPPolicy(policy))
+			}
+			if cfg.StoreInterval == 0 {
+				graphiteOpts = append(graphiteOpts, graphite.WithWriteSync(persistentStorage))
+			}
+			listeners = append(listeners, graphite.NewServer(cfg.GraphiteEndpoint, mapper, metricsService, log,
+				graphiteOpts...))
+		}
+	}
+
+	return listeners
+}
+
+func runServer(ctx context.Context, endpoint, gRPCEndpoint string, tlsConfig *tls.Config, router *chi.Mux,
+	gRPCServer *grpc.Server, log *zap.Logger, listeners ...listener) error {
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	server := &http.Server{
 		Addr:              endpoint,
 		Handler:           router,
@@ -91,7 +167,13 @@ func runServer(ctx context.Context, endpoint, gRPCEndpoint string, router *chi.M
 		ReadHeaderTimeout: defaultReadHeaderTimeout,
 		WriteTimeout:      defaultWriteTimeout,
 		IdleTimeout:       defaultIdleTimeout,
+		TLSConfig:         tlsConfig,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
+	// Shutdown waits for the active requests, so the event streams are canceled when it starts
+	server.RegisterOnShutdown(cancelBase)
 
 	listen, err := net.Listen("tcp", gRPCEndpoint)
 	if err != nil {
@@ -105,6 +187,14 @@ func runServer(ctx context.Context, endpoint, gRPCEndpoint string, router *chi.M
 		}
 	}()
 
+	for _, l := range listeners {
+		go func(l listener) {
+			if err := l.ListenAndServe(); err != nil {
+				log.Error("listener ListenAndServe", zap.Error(err))
+			}
+		}(l)
+	}
+
 	go func() {
 		log.Info("start pprof server")
 		//nolint:gosec // use the default configuration for pprof
@@ -114,7 +204,14 @@ func runServer(ctx context.Context, endpoint, gRPCEndpoint string, router *chi.M
 	}()
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if tlsConfig != nil {
+			// the certificate is taken from the TLS config
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("HTTP server ListenAndServe", zap.Error(err))
 		}
 	}()
@@ -138,6 +235,14 @@ func runServer(ctx context.Context, endpoint, gRPCEndpoint string, router *chi.M
 		}
 	}()
 
+	for _, l := range listeners {
+		go func(l listener) {
+			if err := l.Shutdown(shutdownCtx); err != nil {
+				log.Info("listener shutdown", zap.Error(err))
+			}
+		}(l)
+	}
+
 	// block until timeout exceeded
 	<-shutdownCtx.Done()
 
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// cumulativeTTL is how long the last total of a source is kept after its last report.
+const cumulativeTTL = time.Hour
+
+// cumulativeTotals keeps the last reported running total of each series per source,
+// so cumulative reports can be converted to increments.
+//
+// The totals are kept in memory only. The totals of the sources that haven't reported
+// for cumulativeTTL are dropped, so the sources that are gone aren't kept forever.
+//
+// The series created after the server start are fresh, all sources that have reported them
+// are known, so the first report of another source is its full increment. The series restored
+// after the restart and the series with an expired total of a source aren't fresh.
+type cumulativeTotals[T any] struct {
+	now       func() time.Time
+	last      map[string]sourceTotal[T]
+	fresh     map[string]struct{}
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type sourceTotal[T any] struct {
+	seenAt time.Time
+	total  T
+	key    string
+}
+
+func newCumulativeTotals[T any]() *cumulativeTotals[T] {
+	return &cumulativeTotals[T]{
+		now:   time.Now,
+		last:  make(map[string]sourceTotal[T]),
+		fresh: make(map[string]struct{}),
+	}
+}
+
+// totalsOverlay keeps the totals reported in a batch until the batch is applied,
+// so a batch that isn't applied doesn't move the baselines of the next reports.
+type totalsOverlay[T any] struct {
+	now     time.Time
+	totals  *cumulativeTotals[T]
+	pending map[string]sourceTotal[T]
+	created map[string]struct{}
+	expired map[string]struct{}
+}
+
+// begin locks the totals until the overlay is committed or discarded, so the concurrent
+// batches compute their increments one after another.
+func (ct *cumulativeTotals[T]) begin() *totalsOverlay[T] {
+	ct.mu.Lock()
+
+	return &totalsOverlay[T]{
+		now:     ct.now(),
+		totals:  ct,
+		pending: make(map[string]sourceTotal[T]),
+		created: make(map[string]struct{}),
+		expired: make(map[string]struct{}),
+	}
+}
+
+// swap saves the total of the source to the overlay and returns the last one,
+// it returns false if the source hasn't reported the series or its total has expired.
+func (o *totalsOverlay[T]) swap(source, key string, total T) (T, bool) {
+	id := source + "/" + key
+
+	last, ok := o.pending[id]
+	if !ok {
+		last, ok = o.totals.last[id]
+		if ok && o.now.Sub(last.seenAt) > cumulativeTTL {
+			// the increments of the source before its next report can be already counted
+			o.expired[key] = struct{}{}
+			ok = false
+		}
+	}
+	o.pending[id] = sourceTotal[T]{total: total, key: key}
+
+	return last.total, ok
+}
+
+// create marks the series created by the batch as fresh.
+func (o *totalsOverlay[T]) create(key string) {
+	o.created[key] = struct{}{}
+}
+
+// restored reports whether the series can have the increments of the sources that aren't known,
+// i.e. it isn't fresh. It's called after swap, so the expired total of the source is taken into account.
+func (o *totalsOverlay[T]) restored(key string) bool {
+	if _, ok := o.expired[key]; ok {
+		return true
+	}
+	if _, ok := o.created[key]; ok {
+		return false
+	}
+	_, fresh := o.totals.fresh[key]
+
+	return !fresh
+}
+
+// commit saves the totals of the applied batch and unlocks the totals.
+func (o *totalsOverlay[T]) commit() {
+	defer o.totals.mu.Unlock()
+
+	o.totals.sweep(o.now)
+	for id, total := range o.pending {
+		total.seenAt = o.now
+		o.totals.last[id] = total
+	}
+	for key := range o.created {
+		o.totals.fresh[key] = struct{}{}
+	}
+	for key := range o.expired {
+		delete(o.totals.fresh, key)
+	}
+}
+
+// discard drops the totals of the batch that isn't applied and unlocks the totals.
+func (o *totalsOverlay[T]) discard() {
+	o.totals.mu.Unlock()
+}
+
+// sweep drops the expired totals, at most once per cumulativeTTL.
+func (ct *cumulativeTotals[T]) sweep(now time.Time) {
+	if now.Sub(ct.lastSweep) < cumulativeTTL {
+		return
+	}
+
+	for id, last := range ct.last {
+		if now.Sub(last.seenAt) > cumulativeTTL {
+			delete(ct.last, id)
+			delete(ct.fresh, last.key)
+		}
+	}
+	ct.lastSweep = now
+}
+
+// counterIncrement returns the difference between the running total and the last total
+// reported by the source.
+//
+// The first report of a source is a full increment, since the source counts from zero. If the counter
+// is restored, e.g. after the server restart or the last total of a source has expired, the increments
+// of the source before the report can be already counted, so the report is only the baseline for
+// the next ones. A total less than the last one means that the source was restarted and its counter
+// was reset, so the total itself is the increment.
+func counterIncrement(last, total int64, reported, restored bool) int64 {
+	switch {
+	case !reported && restored:
+		return 0
+	case !reported || total < last:
+		return total
+	}
+
+	return total - last
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
+)
+
+func TestCounterModes(t *testing.T) {
+	storage := memory.NewMemStorage()
+	s := NewMetricsService(storage)
+
+	update := func(t *testing.T, s *MetricsService, source, mode string, delta int64) int64 {
+		t.Helper()
+
+		upserted, err := s.UpsertTypeMetric(&entity.Metric{
+			Delta:  &delta,
+			ID:     "PollCount",
+			MType:  entity.CounterType,
+			Mode:   mode,
+			Source: source,
+		})
+		require.NoError(t, err)
+
+		return *upserted.Delta
+	}
+
+	t.Run("delta", func(t *testing.T) {
+		assert.Equal(t, int64(3), update(t, s, "web-1", entity.CounterModeDelta, 3))
+		assert.Equal(t, int64(5), update(t, s, "web-1", "", 2))
+	})
+
+	t.Run("cumulative", func(t *testing.T) {
+		cumulative := NewMetricsService(memory.NewMemStorage())
+
+		// the report that creates the counter is a full increment
+		assert.Equal(t, int64(5), update(t, cumulative, "web-1", entity.CounterModeCumulative, 5))
+		assert.Equal(t, int64(8), update(t, cumulative, "web-1", entity.CounterModeCumulative, 8))
+		assert.Equal(t, int64(8), update(t, cumulative, "web-1", entity.CounterModeCumulative, 8))
+
+		// the agent was restarted and counts from zero
+		assert.Equal(t, int64(10), update(t, cumulative, "web-1", entity.CounterModeCumulative, 2))
+		assert.Equal(t, int64(11), update(t, cumulative, "web-1", entity.CounterModeCumulative, 3))
+
+		assert.Equal(t, int64(16), update(t, cumulative, "web-1", entity.CounterModeCumulative, 8))
+	})
+
+	t.Run("second source joins the counter", func(t *testing.T) {
+		joined := NewMetricsService(memory.NewMemStorage())
+
+		assert.Equal(t, int64(5), update(t, joined, "web-1", entity.CounterModeCumulative, 5))
+
+		// the new source counts from zero, its first total is a full increment
+		assert.Equal(t, int64(105), update(t, joined, "web-2", entity.CounterModeCumulative, 100))
+		assert.Equal(t, int64(109), update(t, joined, "web-2", entity.CounterModeCumulative, 104))
+		assert.Equal(t, int64(110), update(t, joined, "web-1", entity.CounterModeCumulative, 6))
+
+		// the counter created by a delta is fresh too
+		deltaFirst := NewMetricsService(memory.NewMemStorage())
+		assert.Equal(t, int64(3), update(t, deltaFirst, "web-1", entity.CounterModeDelta, 3))
+		assert.Equal(t, int64(8), update(t, deltaFirst, "web-2", entity.CounterModeCumulative, 5))
+	})
+
+	t.Run("server restart", func(t *testing.T) {
+		update(t, s, "web-1", entity.CounterModeCumulative, 40)
+		before := update(t, s, "web-1", entity.CounterModeCumulative, 50)
+
+		// the restarted server has the restored counter, but not the last totals of the sources
+		restarted := NewMetricsService(storage)
+		assert.Equal(t, before, update(t, restarted, "web-1", entity.CounterModeCumulative, 60))
+		assert.Equal(t, before+5, update(t, restarted, "web-1", entity.CounterModeCumulative, 65))
+	})
+
+	t.Run("expired total", func(t *testing.T) {
+		expiring := NewMetricsService(memory.NewMemStorage())
+		now := time.Now()
+		expiring.cumulative.now = func() time.Time { return now }
+
+		assert.Equal(t, int64(7), update(t, expiring, "web-1", entity.CounterModeCumulative, 7))
+		now = now.Add(cumulativeTTL / 2)
+		assert.Equal(t, int64(8), update(t, expiring, "web-2", entity.CounterModeCumulative, 1))
+
+		// the expired total is dropped, the next report is the baseline again
+		now = now.Add(cumulativeTTL)
+		assert.Equal(t, int64(8), update(t, expiring, "web-1", entity.CounterModeCumulative, 100))
+		assert.Equal(t, int64(10), update(t, expiring, "web-1", entity.CounterModeCumulative, 102))
+		assert.Len(t, expiring.cumulative.last, 2)
+
+		// the counter isn't fresh after a total has expired, the first total of a source is the baseline
+		assert.Equal(t, int64(10), update(t, expiring, "web-3", entity.CounterModeCumulative, 50))
+
+		now = now.Add(cumulativeTTL + time.Minute)
+		update(t, expiring, "web-1", entity.CounterModeCumulative, 103)
+		assert.Len(t, expiring.cumulative.last, 1)
+	})
+}
+
+func TestGaugeModes(t *testing.T) {
+	s := NewMetricsService(memory.NewMemStorage())
+
+	update := func(mode string, value float64) (*entity.Metric, error) {
+		return s.UpsertTypeMetric(&entity.Metric{Value: &value, ID: "QueueSize", MType: entity.GaugeType, Mode: mode})
+	}
+
+	upserted, err := update("", 10)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, *upserted.Value)
+
+	upserted, err = update(entity.GaugeModeRelative, -3)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, *upserted.Value)
+
+	// the counter modes aren't gauge modes
+	_, err = update(entity.CounterModeCumulative, 1)
+	assert.ErrorIs(t, err, entity.ErrIncorrectMetricValue)
+}
+
+// recordingHistory records the counter values in the order they are saved.
+type recordingHistory struct {
+	values []int64
+	mu     sync.Mutex
+}
+
+func (h *recordingHistory) Record(_, _ string, point entity.HistoryPoint) {
+	// the other batches get the chance to be recorded first if they aren't serialized
+	time.Sleep(time.Millisecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.values = append(h.values, *point.Delta)
+}
+
+func (h *recordingHistory) Range(_, _ string, _, _ time.Time, _ time.Duration) ([]entity.HistoryPoint, error) {
+	return nil, nil
+}
+
+func (h *recordingHistory) Retention() time.Duration {
+	return time.Hour
+}
+
+func TestHistoryOrder(t *testing.T) {
+	history := &recordingHistory{}
+	s := NewMetricsService(memory.NewMemStorage(), WithHistory(history))
+
+	const batches = 100
+
+	var wg sync.WaitGroup
+	for i := 0; i < batches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			delta := int64(1)
+			_, err := s.UpsertTypeMetric(&entity.Metric{Delta: &delta, ID: "PollCount", MType: entity.CounterType})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// the concurrent batches are recorded in the order they are applied
+	require.Len(t, history.values, batches)
+	for i, value := range history.values {
+		assert.Equal(t, int64(i+1), value)
+	}
+}
+
+// failingStorage fails the transactions after they are applied, like a failed commit.
+type failingStorage struct {
+	MetricsRepository
+	fail bool
+}
+
+func (fs *failingStorage) Transaction(fn func(tx memory.Tx) error) error {
+	if !fs.fail {
+		return fs.MetricsRepository.Transaction(fn)
+	}
+
+	return fs.MetricsRepository.Transaction(func(tx memory.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return errors.New("commit failed")
+	})
+}
+
+func TestCumulativeRollback(t *testing.T) {
+	storage := &failingStorage{MetricsRepository: memory.NewMemStorage()}
+	s := NewMetricsService(storage)
+
+	update := func(total int64) error {
+		_, err := s.UpsertTypeMetrics([]*entity.Metric{{
+			Delta:  &total,
+			ID:     "PollCount",
+			MType:  entity.CounterType,
+			Mode:   entity.CounterModeCumulative,
+			Source: "web-1",
+		}})
+		return err
+	}
+
+	require.NoError(t, update(5))
+
+	storage.fail = true
+	require.Error(t, update(8))
+
+	// the total of the failed batch isn't the baseline, so its increment isn't lost
+	storage.fail = false
+	require.NoError(t, update(9))
+
+	delta, _, err := s.GetMetric(entity.CounterType, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), *delta)
+}
+
+func TestCumulativeHistogram(t *testing.T) {
+	storage := memory.NewMemStorage()
+	s := NewMetricsService(storage)
+
+	update := func(t *testing.T, s *MetricsService, counts []uint64) uint64 {
+		t.Helper()
+
+		var count uint64
+		for _, c := range counts {
+			count += c
+		}
+
+		upserted, err := s.UpsertTypeMetric(&entity.Metric{
+			Histogram: &entity.Histogram{Bounds: []float64{1}, Counts: counts, Count: count},
+			ID:        "latency",
+			MType:     entity.HistogramType,
+			Mode:      entity.CounterModeCumulative,
+			Source:    "web-1",
+		})
+		require.NoError(t, err)
+
+		return upserted.Histogram.Count
+	}
+
+	assert.Equal(t, uint64(3), update(t, s, []uint64{1, 2}))
+	assert.Equal(t, uint64(5), update(t, s, []uint64{2, 3}))
+	// reset
+	assert.Equal(t, uint64(6), update(t, s, []uint64{1, 0}))
+
+	restarted := NewMetricsService(storage)
+	assert.Equal(t, uint64(6), update(t, restarted, []uint64{4, 4}))
+	assert.Equal(t, uint64(7), update(t, restarted, []uint64{5, 4}))
+}
+
+// panicStorage panics in the transaction, as a bug in the storage would.
+type panicStorage struct {
+	memory.Storage
+	panics bool
+}
+
+func (ps *panicStorage) Transaction(fn func(tx memory.Tx) error) error {
+	if ps.panics {
+		panic("transaction failed")
+	}
+
+	return ps.Storage.Transaction(fn)
+}
+
+func TestCumulativeTotalsReleasedOnPanic(t *testing.T) {
+	storage := &panicStorage{Storage: memory.NewMemStorage(), panics: true}
+	s := NewMetricsService(storage)
+
+	delta := int64(5)
+	metric := &entity.Metric{
+		Delta:  &delta,
+		ID:     "PollCount",
+		MType:  entity.CounterType,
+		Mode:   entity.CounterModeCumulative,
+		Source: "web-1",
+	}
+
+	assert.Panics(t, func() {
+		_, _ = s.UpsertTypeMetric(metric)
+	})
+
+	storage.panics = false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := s.UpsertTypeMetric(metric)
+		assert.NoError(t, err)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the totals are still locked after the panic")
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// metricFilter is the checked entity.MetricFilter with the compiled name regexp.
+type metricFilter struct {
+	nameRegexp *regexp.Regexp
+	mType      string
+	namePrefix string
+}
+
+func newMetricFilter(filter entity.MetricFilter) (*metricFilter, error) {
+	switch filter.MType {
+	case "", entity.CounterType, entity.GaugeType, entity.HistogramType:
+	default:
+		return nil, fmt.Errorf("%w: %w %q", entity.ErrIncorrectFilter, entity.ErrUnknownMetricType, filter.MType)
+	}
+
+	f := &metricFilter{
+		mType:      filter.MType,
+		namePrefix: filter.NamePrefix,
+	}
+
+	if filter.NameRegexp != "" {
+		var err error
+		f.nameRegexp, err = regexp.Compile(filter.NameRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: name regexp: %w", entity.ErrIncorrectFilter, err)
+		}
+	}
+
+	return f, nil
+}
+
+// match reports whether the metric of the type with the name without labels passes the filter.
+func (f *metricFilter) match(mType, name string) bool {
+	if f.mType != "" && f.mType != mType {
+		return false
+	}
+
+	return strings.HasPrefix(name, f.namePrefix) && (f.nameRegexp == nil || f.nameRegexp.MatchString(name))
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// histogramIncrement returns the difference between the running total and the last total
+// reported by the source.
+//
+// As with the counters, the first report of a source is a full increment unless the histogram
+// is restored, then it's only the baseline. A bucket count less than the last one
+// or changed bounds mean that the source was reset, so the total itself is the increment.
+func histogramIncrement(last, total entity.Histogram, reported, restored bool) entity.Histogram {
+	switch {
+	case !reported && restored:
+		return entity.NewHistogram(total.Bounds)
+	case !reported || !last.SameBounds(total):
+		return total.Clone()
+	}
+
+	increment := entity.NewHistogram(total.Bounds)
+	for i, count := range total.Counts {
+		if count < last.Counts[i] {
+			return total.Clone()
+		}
+		increment.Counts[i] = count - last.Counts[i]
+	}
+	increment.Sum = total.Sum - last.Sum
+	increment.Count = total.Count - last.Count
+
+	return increment
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listItem is a metric of the list with its sort keys.
+type listItem struct {
+	metric *entity.Metric
+	name   string
+	key    string
+}
+
+// listCursor is the position after the last metric of the page, the cursor
+// can be used only with the same sort order.
+type listCursor struct {
+	Sort  string `json:"s"`
+	MType string `json:"t"`
+	Key   string `json:"k"`
+}
+
+// ListMetrics returns a page of the metrics matching the filter.
+//
+// The metrics are sorted by name or by type, the ties are broken by the labels and the type,
+// so the order is stable and the cursor keeps its position when the metrics are added
+// or removed between the pages.
+func (s *MetricsService) ListMetrics(filter entity.ListFilter) (*entity.MetricsPage, error) {
+	selector, err := newMetricFilter(filter.MetricFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = entity.SortByName
+	}
+	field, desc := strings.CutPrefix(filter.Sort, "-")
+	if field != entity.SortByName && field != entity.SortByType {
+		return nil, fmt.Errorf("%w: unknown sort order %q", entity.ErrIncorrectFilter, filter.Sort)
+	}
+
+	limit := filter.Limit
+	switch {
+	case limit < 0:
+		return nil, fmt.Errorf("%w: negative limit", entity.ErrIncorrectFilter)
+	case limit == 0:
+		limit = defaultListLimit
+	case limit > maxListLimit:
+		limit = maxListLimit
+	}
+
+	var after *listItem
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil || cursor.Sort != filter.Sort {
+			return nil, fmt.Errorf("%w: incorrect cursor", entity.ErrIncorrectFilter)
+		}
+		name, _ := entity.ParseSeriesKey(cursor.Key)
+		after = &listItem{metric: &entity.Metric{MType: cursor.MType}, name: name, key: cursor.Key}
+	}
+
+	var items []*listItem
+	add := func(mType, key string, fill func(metric *entity.Metric)) {
+		name, labels := entity.ParseSeriesKey(key)
+		if !selector.match(mType, name) {
+			return
+		}
+
+		metric := &entity.Metric{Labels: labels, ID: name, MType: mType}
+		fill(metric)
+		items = append(items, &listItem{metric: metric, name: name, key: key})
+	}
+
+	metrics := s.metricsRepository.GetMetrics()
+	for key, delta := range metrics.Counter {
+		delta := delta
+		add(entity.CounterType, key, func(metric *entity.Metric) {
+			metric.Delta = &delta
+		})
+	}
+	for key, value := range metrics.Gauge {
+		value := value
+		add(entity.GaugeType, key, func(metric *entity.Metric) {
+			metric.Value = &value
+		})
+	}
+	for key, histogram := range metrics.Histogram {
+		histogram := histogram
+		add(entity.HistogramType, key, func(metric *entity.Metric) {
+			metric.Histogram = &histogram
+		})
+	}
+
+	less := func(a, b *listItem) bool {
+		c := compareItems(a, b, field)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(items), func(i int) bool {
+			return less(after, items[i])
+		})
+	}
+	end := min(start+limit, len(items))
+
+	page := &entity.MetricsPage{
+		Metrics: make([]*entity.Metric, 0, end-start),
+	}
+	for _, item := range items[start:end] {
+		page.Metrics = append(page.Metrics, item.metric)
+	}
+	if end < len(items) {
+		page.NextCursor = encodeCursor(listCursor{
+			Sort:  filter.Sort,
+			MType: items[end-1].metric.MType,
+			Key:   items[end-1].key,
+		})
+	}
+
+	return page, nil
+}
+
+func compareItems(a, b *listItem, field string) int {
+	if field == entity.SortByType {
+		if c := cmp.Compare(a.metric.MType, b.metric.MType); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(a.name, b.name); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.key, b.key); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(a.metric.MType, b.metric.MType)
+}
+
+func encodeCursor(cursor listCursor) string {
+	// the cursor contains only strings, so it can't fail
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (listCursor, error) {
+	var cursor listCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+
+	return cursor, nil
+}
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
 )
 
 type MetricsRepository interface {
@@ -13,50 +15,114 @@ type MetricsRepository interface {
 	UpdateGauge(name string, value float64)
 	GetCounter(name string) (int64, error)
 	GetGauge(name string) (float64, error)
+	UpdateHistogram(name string, value entity.Histogram) error
+	GetHistogram(name string) (entity.Histogram, error)
 	GetMetrics() entity.Metrics
+	Transaction(fn func(tx memory.Tx) error) error
+}
+
+type HistoryRepository interface {
+	Record(mType, mName string, point entity.HistoryPoint)
+	Range(mType, mName string, from, to time.Time, step time.Duration) ([]entity.HistoryPoint, error)
+	Retention() time.Duration
 }
 
 type MetricsService struct {
 	metricsRepository MetricsRepository
+	historyRepository HistoryRepository
+	cumulative        *cumulativeTotals[int64]
+	cumulativeHist    *cumulativeTotals[entity.Histogram]
+	watchers          *watchHub
+	histogramBuckets  []float64
+}
+
+// Option configures optional MetricsService dependencies.
+type Option func(s *MetricsService)
+
+// WithHistory enables recording of the metrics history to the passed repository.
+func WithHistory(historyRepository HistoryRepository) Option {
+	return func(s *MetricsService) {
+		s.historyRepository = historyRepository
+	}
+}
+
+// WithHistogramBuckets sets the bucket upper bounds used for single histogram observations.
+func WithHistogramBuckets(bounds []float64) Option {
+	return func(s *MetricsService) {
+		if len(bounds) > 0 {
+			s.histogramBuckets = bounds
+		}
+	}
 }
 
-func NewMetricsService(metricsRepository MetricsRepository) *MetricsService {
-	return &MetricsService{
+func NewMetricsService(metricsRepository MetricsRepository, opts ...Option) *MetricsService {
+	s := &MetricsService{
 		metricsRepository: metricsRepository,
+		cumulative:        newCumulativeTotals[int64](),
+		cumulativeHist:    newCumulativeTotals[entity.Histogram](),
+		watchers:          newWatchHub(),
+		histogramBuckets:  entity.DefaultHistogramBuckets,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
-func (s MetricsService) UpsertMetric(mType, mName, mValue string) error {
+// UpsertMetric updates the metric by its type, name and labels with the value from the string.
+func (s *MetricsService) UpsertMetric(mType, mName, mValue string, labels map[string]string) error {
+	metric := &entity.Metric{
+		Labels: labels,
+		ID:     mName,
+		MType:  mType,
+	}
+
 	switch mType {
 	case entity.GaugeType:
 		value, err := strconv.ParseFloat(mValue, 64)
 		if err != nil {
 			return fmt.Errorf("%w; %w; test", err, entity.ErrIncorrectMetricValue)
 		}
-		s.metricsRepository.UpdateGauge(mName, value)
+		metric.Value = &value
 	case entity.CounterType:
 		value, err := strconv.ParseInt(mValue, 10, 64)
 		if err != nil {
 			return fmt.Errorf("%w: %w", err, entity.ErrIncorrectMetricValue)
 		}
-		s.metricsRepository.UpdateCounter(mName, value)
+		metric.Delta = &value
+	case entity.HistogramType:
+		value, err := strconv.ParseFloat(mValue, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %w", err, entity.ErrIncorrectMetricValue)
+		}
+		metric.Value = &value
 	default:
 		return entity.ErrUnknownMetricType
 	}
 
-	return nil
+	_, err := s.UpsertTypeMetric(metric)
+
+	return err
 }
 
-func (s *MetricsService) GetMetric(mType, mName string) (*int64, *float64, error) {
+// GetMetric gets the metric value by its type, name and labels.
+func (s *MetricsService) GetMetric(mType, mName string, labels map[string]string) (*int64, *float64, error) {
+	if err := entity.ValidateSeries(mName, labels); err != nil {
+		return nil, nil, err
+	}
+	key := entity.SeriesKey(mName, labels)
+
 	switch mType {
 	case entity.CounterType:
-		delta, err := s.metricsRepository.GetCounter(mName)
+		delta, err := s.metricsRepository.GetCounter(key)
 		if err != nil {
 			return nil, nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
 		}
 		return &delta, nil, nil
 	case entity.GaugeType:
-		value, err := s.metricsRepository.GetGauge(mName)
+		value, err := s.metricsRepository.GetGauge(key)
 		if err != nil {
 			return nil, nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
 		}
@@ -70,38 +136,337 @@ func (s *MetricsService) GetAllMetrics() entity.Metrics {
 	return s.metricsRepository.GetMetrics()
 }
 
+// UpsertTypeMetric updates the metric by its type, name and labels. The updated metric
+// contains the current stored value.
+//
+// The counter delta and the histogram are applied according to the metric mode, in the cumulative
+// mode the increment is computed from the last total reported by the same source.
 func (s *MetricsService) UpsertTypeMetric(metric *entity.Metric) (*entity.Metric, error) {
+	upserted, err := s.UpsertTypeMetrics([]*entity.Metric{metric})
+
+	var batchErr *entity.BatchError
+	if errors.As(err, &batchErr) {
+		return nil, batchErr.Items[0].Err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return upserted[0], nil
+}
+
+// UpsertTypeMetrics updates the batch of metrics with all-or-nothing semantics.
+//
+// All metrics are validated before any change is made. If some of them are rejected,
+// the returned *entity.BatchError lists all of them and the storage isn't changed,
+// otherwise the whole batch is applied in a single transaction. The cumulative totals
+// of the batch are saved only if it's applied.
+func (s *MetricsService) UpsertTypeMetrics(metrics []*entity.Metric) ([]*entity.Metric, error) {
+	var upserted []*entity.Metric
+
+	totals := &batchTotals{
+		counters:   s.cumulative.begin(),
+		histograms: s.cumulativeHist.begin(),
+	}
+	// the totals are unlocked even if the transaction panics
+	defer totals.release()
+
+	err := s.metricsRepository.Transaction(func(tx memory.Tx) error {
+		keys, err := s.validate(tx, metrics)
+		if err != nil {
+			return err
+		}
+
+		upserted = make([]*entity.Metric, 0, len(metrics))
+		for i, metric := range metrics {
+			if err = s.apply(tx, keys[i], metric, totals); err != nil {
+				return err
+			}
+			upserted = append(upserted, metric)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the totals are still locked, so the watchers and the history get the applied batches
+	// in the order they are applied
+	s.watchers.publish(upserted)
+	for _, metric := range upserted {
+		if metric.MType != entity.HistogramType {
+			s.recordHistory(metric.MType, entity.SeriesKey(metric.ID, metric.Labels), metric.Delta, metric.Value)
+		}
+	}
+	totals.commit()
+
+	return upserted, nil
+}
+
+// validate checks all metrics of the batch against the storage state within the transaction
+// and returns their storage keys. Histograms are checked against the bounds of the earlier
+// batch metrics too, so applying the valid batch can't fail halfway.
+func (s *MetricsService) validate(tx memory.Tx, metrics []*entity.Metric) ([]string, error) {
+	keys := make([]string, len(metrics))
+	bounds := make(map[string]entity.Histogram)
+	batchErr := &entity.BatchError{}
+
+	for i, metric := range metrics {
+		err := entity.ValidateSeries(metric.ID, metric.Labels)
+		if err == nil {
+			keys[i] = entity.SeriesKey(metric.ID, metric.Labels)
+			err = s.validateMetric(tx, keys[i], metric, bounds)
+		}
+		if err != nil {
+			batchErr.Items = append(batchErr.Items, &entity.ItemError{
+				Err:   err,
+				ID:    metric.ID,
+				MType: metric.MType,
+				Index: i,
+			})
+		}
+	}
+
+	if len(batchErr.Items) > 0 {
+		return nil, batchErr
+	}
+
+	return keys, nil
+}
+
+// validateMetric checks that the metric can be applied, the bucket layout of the valid
+// histograms is saved to bounds.
+func (s *MetricsService) validateMetric(tx memory.Tx, key string, metric *entity.Metric,
+	bounds map[string]entity.Histogram) error {
 	switch metric.MType {
 	case entity.GaugeType:
 		if metric.Value == nil {
-			return nil, entity.ErrEmptyMetricValue
+			return entity.ErrEmptyMetricValue
+		}
+		if metric.Mode != "" && metric.Mode != entity.GaugeModeRelative {
+			return fmt.Errorf("%w: unknown gauge mode %q", entity.ErrIncorrectMetricValue, metric.Mode)
+		}
+	case entity.CounterType:
+		if metric.Delta == nil {
+			return entity.ErrEmptyMetricValue
+		}
+		if metric.Mode != "" && metric.Mode != entity.CounterModeDelta && metric.Mode != entity.CounterModeCumulative {
+			return fmt.Errorf("%w: unknown counter mode %q", entity.ErrIncorrectMetricValue, metric.Mode)
+		}
+	case entity.HistogramType:
+		if metric.Histogram == nil && metric.Value == nil {
+			return entity.ErrEmptyMetricValue
+		}
+		if metric.Mode != "" && metric.Mode != entity.CounterModeDelta && metric.Mode != entity.CounterModeCumulative {
+			return fmt.Errorf("%w: unknown histogram mode %q", entity.ErrIncorrectMetricValue, metric.Mode)
+		}
+		if metric.Mode == entity.CounterModeCumulative && metric.Histogram == nil {
+			return fmt.Errorf("%w: cumulative histogram must have bucket counts", entity.ErrIncorrectMetricValue)
+		}
+
+		layout, ok := bounds[key]
+		if !ok {
+			stored, err := tx.GetHistogram(key)
+			ok = err == nil
+			layout = stored
+		}
+
+		if metric.Histogram == nil {
+			if !ok {
+				bounds[key] = entity.NewHistogram(s.histogramBuckets)
+			}
+			return nil
 		}
-		s.metricsRepository.UpdateGauge(metric.ID, *metric.Value)
 
-		value, err := s.metricsRepository.GetGauge(metric.ID)
+		if err := metric.Histogram.Validate(); err != nil {
+			return err
+		}
+		if ok && !layout.SameBounds(*metric.Histogram) {
+			return fmt.Errorf("%w: histogram bounds %v don't match the stored bounds %v",
+				entity.ErrIncorrectMetricValue, metric.Histogram.Bounds, layout.Bounds)
+		}
+		if !ok {
+			bounds[key] = metric.Histogram.Clone()
+		}
+	default:
+		return entity.ErrUnknownMetricType
+	}
+
+	return nil
+}
+
+// batchTotals are the cumulative totals reported in the batch.
+type batchTotals struct {
+	counters   *totalsOverlay[int64]
+	histograms *totalsOverlay[entity.Histogram]
+	committed  bool
+}
+
+func (bt *batchTotals) commit() {
+	bt.histograms.commit()
+	bt.counters.commit()
+	bt.committed = true
+}
+
+// release discards the totals of the batch, unless they're committed.
+func (bt *batchTotals) release() {
+	if bt.committed {
+		return
+	}
+
+	bt.histograms.discard()
+	bt.counters.discard()
+}
+
+// apply updates the validated metric within the transaction and sets its current stored value.
+func (s *MetricsService) apply(tx memory.Tx, key string, metric *entity.Metric, totals *batchTotals) error {
+	switch metric.MType {
+	case entity.GaugeType:
+		update := *metric.Value
+		if metric.Mode == entity.GaugeModeRelative {
+			// the missing gauge starts from zero
+			current, _ := tx.GetGauge(key)
+			update += current
+		}
+		tx.UpdateGauge(key, update)
+
+		value, err := tx.GetGauge(key)
 		if err != nil {
-			return nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
+			return errors.Join(err, entity.ErrCanNotGetMetricValue)
 		}
 
 		metric.Value = &value
 		metric.Delta = nil
-
-		return metric, nil
 	case entity.CounterType:
-		if metric.Delta == nil {
-			return nil, entity.ErrEmptyMetricValue
+		increment := *metric.Delta
+		if _, errStored := tx.GetCounter(key); errStored != nil {
+			totals.counters.create(key)
+		}
+		if metric.Mode == entity.CounterModeCumulative {
+			last, reported := totals.counters.swap(metric.Source, key, increment)
+			increment = counterIncrement(last, increment, reported, totals.counters.restored(key))
 		}
-		s.metricsRepository.UpdateCounter(metric.ID, *metric.Delta)
+		tx.UpdateCounter(key, increment)
 
-		delta, err := s.metricsRepository.GetCounter(metric.ID)
+		delta, err := tx.GetCounter(key)
 		if err != nil {
-			return nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
+			return errors.Join(err, entity.ErrCanNotGetMetricValue)
 		}
 
 		metric.Delta = &delta
 		metric.Value = nil
+	case entity.HistogramType:
+		if _, errStored := tx.GetHistogram(key); errStored != nil {
+			totals.histograms.create(key)
+		}
+
+		var update entity.Histogram
+		switch {
+		case metric.Histogram != nil && metric.Mode == entity.CounterModeCumulative:
+			last, reported := totals.histograms.swap(metric.Source, key, metric.Histogram.Clone())
+			update = histogramIncrement(last, *metric.Histogram, reported, totals.histograms.restored(key))
+		case metric.Histogram != nil:
+			update = metric.Histogram.Clone()
+		default:
+			update = s.observation(tx, key, *metric.Value, metric.Weight)
+		}
+
+		if err := tx.UpdateHistogram(key, update); err != nil {
+			return err
+		}
+
+		histogram, err := tx.GetHistogram(key)
+		if err != nil {
+			return errors.Join(err, entity.ErrCanNotGetMetricValue)
+		}
+
+		metric.Histogram = &histogram
+		metric.Delta = nil
+		metric.Value = nil
+	}
+
+	return nil
+}
+
+// GetHistogram gets the metric of type histogram by its name and labels.
+func (s *MetricsService) GetHistogram(mName string, labels map[string]string) (*entity.Histogram, error) {
+	if err := entity.ValidateSeries(mName, labels); err != nil {
+		return nil, err
+	}
+
+	histogram, err := s.metricsRepository.GetHistogram(entity.SeriesKey(mName, labels))
+	if err != nil {
+		return nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
+	}
+
+	return &histogram, nil
+}
+
+// observation creates a histogram with the value observed weight times. The buckets of the stored
+// histogram are used if it exists, otherwise the configured buckets.
+func (s *MetricsService) observation(tx memory.Tx, key string, value float64, weight uint64) entity.Histogram {
+	bounds := s.histogramBuckets
+	if stored, err := tx.GetHistogram(key); err == nil {
+		bounds = stored.Bounds
+	}
+
+	if weight == 0 {
+		weight = 1
+	}
+
+	histogram := entity.NewHistogram(bounds)
+	histogram.ObserveN(value, weight)
+
+	return histogram
+}
+
+// GetHistory gets the metric values in the [from, to] interval with the specified step.
+// Zero from and to values default to the retention period ending now.
+func (s *MetricsService) GetHistory(mType, mName string, labels map[string]string, from, to time.Time,
+	step time.Duration) ([]entity.HistoryPoint, error) {
+	if s.historyRepository == nil {
+		return nil, entity.ErrHistoryDisabled
+	}
+
+	if err := entity.ValidateSeries(mName, labels); err != nil {
+		return nil, err
+	}
 
-		return metric, nil
+	if mType != entity.GaugeType && mType != entity.CounterType {
+		return nil, entity.ErrUnknownMetricType
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-s.historyRepository.Retention())
+	}
+	if to.Before(from) || step < 0 {
+		return nil, entity.ErrIncorrectTimeRange
 	}
-	return nil, entity.ErrUnknownMetricType
+
+	points, err := s.historyRepository.Range(mType, entity.SeriesKey(mName, labels), from, to, step)
+	if errors.Is(err, entity.ErrIncorrectTimeRange) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Join(err, entity.ErrCanNotGetMetricValue)
+	}
+
+	return points, nil
+}
+
+// recordHistory saves the current metric value to the history if it's enabled.
+func (s *MetricsService) recordHistory(mType, key string, delta *int64, value *float64) {
+	if s.historyRepository == nil {
+		return
+	}
+
+	s.historyRepository.Record(mType, key, entity.HistoryPoint{
+		Timestamp: time.Now(),
+		Delta:     delta,
+		Value:     value,
+	})
 }
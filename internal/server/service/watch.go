@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// watchBufferSize is the number of updates buffered for a watcher. A watcher that falls behind
+// by more updates is dropped, so a slow client can't block the ingestion.
+const watchBufferSize = 256
+
+type watcher struct {
+	filter  *metricFilter
+	updates chan *entity.Metric
+}
+
+// watchHub notifies the watchers about the applied metric updates.
+type watchHub struct {
+	watchers map[*watcher]struct{}
+	mu       sync.Mutex
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (h *watchHub) subscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.watchers[w] = struct{}{}
+}
+
+// unsubscribe removes the watcher and closes its channel, it's safe to call it
+// for the watcher that was already dropped.
+func (h *watchHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.updates)
+	}
+}
+
+// publish sends the metrics to the matching watchers without blocking,
+// the watchers with a full buffer are dropped.
+func (h *watchHub) publish(metrics []*entity.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.watchers) == 0 {
+		return
+	}
+
+	for _, metric := range metrics {
+		var update *entity.Metric
+
+		for w := range h.watchers {
+			if !w.filter.match(metric.MType, metric.ID) {
+				continue
+			}
+			if update == nil {
+				update = watchUpdate(metric)
+			}
+
+			select {
+			case w.updates <- update:
+			default:
+				delete(h.watchers, w)
+				close(w.updates)
+			}
+		}
+	}
+}
+
+// watchUpdate copies the current value of the applied metric, the watchers
+// share the copy, so they must not change it.
+func watchUpdate(metric *entity.Metric) *entity.Metric {
+	update := &entity.Metric{
+		Delta: metric.Delta,
+		Value: metric.Value,
+		ID:    metric.ID,
+		MType: metric.MType,
+	}
+	if len(metric.Labels) > 0 {
+		update.Labels = make(map[string]string, len(metric.Labels))
+		for name, value := range metric.Labels {
+			update.Labels[name] = value
+		}
+	}
+	if metric.Histogram != nil {
+		histogram := metric.Histogram.Clone()
+		update.Histogram = &histogram
+	}
+
+	return update
+}
+
+// Watch streams the metric updates matching the filter as they are applied, each update
+// has the current stored value. The channel is closed when the context is done or when
+// the watcher falls behind by more than watchBufferSize updates, in the latter case
+// ctx.Err() is nil.
+func (s *MetricsService) Watch(ctx context.Context, filter entity.MetricFilter) (<-chan *entity.Metric, error) {
+	selector, err := newMetricFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{
+		filter:  selector,
+		updates: make(chan *entity.Metric, watchBufferSize),
+	}
+	s.watchers.subscribe(w)
+
+	go func() {
+		<-ctx.Done()
+		s.watchers.unsubscribe(w)
+	}()
+
+	return w.updates, nil
+}
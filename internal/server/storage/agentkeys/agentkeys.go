@@ -0,0 +1,114 @@
+package agentkeys
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/signkeys"
+)
+
+var (
+	ErrUnknownAgent = errors.New("unknown agent")
+	ErrRevokedAgent = errors.New("agent is revoked")
+)
+
+// Agent is an entry of the registry file.
+type Agent struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"public_key"`
+	Revoked   bool   `json:"revoked"`
+}
+
+type registryFile struct {
+	Agents []Agent `json:"agents"`
+}
+
+type agentKey struct {
+	publicKey ed25519.PublicKey
+	revoked   bool
+}
+
+// Registry keeps the public keys of the agents from the JSON file
+//
+//	{"agents": [{"id": "web-1", "public_key": "MCowBQYDK2VwAyEA...", "revoked": false}]}
+//
+// The file is read again when it's modified, so an agent can be added or revoked
+// without a restart. If the modified file can't be loaded, the previous keys are used.
+type Registry struct {
+	keys *reload.Reloader[map[string]agentKey]
+}
+
+// NewRegistry loads the agent public keys from the file.
+func NewRegistry(filePath string) (*Registry, error) {
+	keys, err := reload.New(func() (map[string]agentKey, error) {
+		return load(filePath)
+	}, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registry{keys: keys}, nil
+}
+
+// OnReloadError sets the function that is called when the modified file can't be loaded,
+// the previous keys are used until the file is fixed.
+func (r *Registry) OnReloadError(fn func(error)) {
+	r.keys.OnError(fn)
+}
+
+// Lookup returns the public key of the agent, the nil registry doesn't know any agents.
+func (r *Registry) Lookup(agentID string) (ed25519.PublicKey, error) {
+	if r == nil {
+		return nil, ErrUnknownAgent
+	}
+
+	key, ok := r.keys.Get()[agentID]
+	switch {
+	case !ok:
+		return nil, ErrUnknownAgent
+	case key.revoked:
+		return nil, ErrRevokedAgent
+	}
+
+	return key.publicKey, nil
+}
+
+// Len returns the number of the agents in the registry, including the revoked ones.
+func (r *Registry) Len() int {
+	return len(r.keys.Get())
+}
+
+func load(filePath string) (map[string]agentKey, error) {
+	buf, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file registryFile
+	if err = json.Unmarshal(buf, &file); err != nil {
+		return nil, fmt.Errorf("can't parse agent keys file %s: %w", filePath, err)
+	}
+
+	keys := make(map[string]agentKey, len(file.Agents))
+	for i, agent := range file.Agents {
+		if agent.ID == "" {
+			return nil, fmt.Errorf("agent %d: ID is required", i)
+		}
+		if _, ok := keys[agent.ID]; ok {
+			return nil, fmt.Errorf("agent %q: duplicate ID", agent.ID)
+		}
+
+		publicKey, errParse := signkeys.ParsePublicKey(agent.PublicKey)
+		if errParse != nil {
+			return nil, fmt.Errorf("agent %q: %w", agent.ID, errParse)
+		}
+
+		keys[agent.ID] = agentKey{publicKey: publicKey, revoked: agent.Revoked}
+	}
+
+	return keys, nil
+}
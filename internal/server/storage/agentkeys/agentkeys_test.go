@@ -0,0 +1,107 @@
+package agentkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+)
+
+func TestRegistry(t *testing.T) {
+	web, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	db, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	filePath := filepath.Join(t.TempDir(), "agents.json")
+	write := func(t *testing.T, agents []Agent, modTime time.Time) {
+		t.Helper()
+
+		buf, errMarshal := json.Marshal(registryFile{Agents: agents})
+		require.NoError(t, errMarshal)
+		require.NoError(t, os.WriteFile(filePath, buf, 0o600))
+		require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+	}
+
+	now := time.Now()
+	write(t, []Agent{
+		{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(web)},
+		{ID: "db-1", PublicKey: base64.StdEncoding.EncodeToString(db)},
+	}, now)
+
+	registry, err := NewRegistry(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, registry.Len())
+
+	key, err := registry.Lookup("web-1")
+	require.NoError(t, err)
+	assert.True(t, web.Equal(key))
+
+	_, err = registry.Lookup("web-2")
+	assert.ErrorIs(t, err, ErrUnknownAgent)
+
+	t.Run("revoke without restart", func(t *testing.T) {
+		write(t, []Agent{
+			{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(web)},
+			{ID: "db-1", PublicKey: base64.StdEncoding.EncodeToString(db), Revoked: true},
+		}, now.Add(time.Second))
+
+		// the file is checked at most once per reload.CheckInterval
+		require.Eventually(t, func() bool {
+			_, errLookup := registry.Lookup("db-1")
+			return errors.Is(errLookup, ErrRevokedAgent)
+		}, 3*reload.CheckInterval, 10*time.Millisecond)
+
+		_, err = registry.Lookup("web-1")
+		assert.NoError(t, err)
+	})
+
+	t.Run("incorrect file keeps the previous keys", func(t *testing.T) {
+		var reloadErrors []error
+		registry.OnReloadError(func(err error) {
+			reloadErrors = append(reloadErrors, err)
+		})
+
+		write(t, []Agent{{ID: "web-1", PublicKey: "uwu"}}, now.Add(2*time.Second))
+
+		require.Eventually(t, func() bool {
+			_, errLookup := registry.Lookup("web-1")
+			return errLookup == nil && len(reloadErrors) > 0
+		}, 3*reload.CheckInterval, 10*time.Millisecond)
+
+		_, err = registry.Lookup("web-1")
+		assert.NoError(t, err)
+		_, err = registry.Lookup("db-1")
+		assert.ErrorIs(t, err, ErrRevokedAgent)
+
+		// the error is reported once for the modification, not on each lookup
+		require.Len(t, reloadErrors, 1)
+		assert.ErrorContains(t, reloadErrors[0], `agent "web-1"`)
+	})
+
+	t.Run("incorrect registry", func(t *testing.T) {
+		for _, agents := range [][]Agent{
+			{{ID: "", PublicKey: base64.StdEncoding.EncodeToString(web)}},
+			{{ID: "web-1", PublicKey: "uwu"}},
+			{
+				{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(web)},
+				{ID: "web-1", PublicKey: base64.StdEncoding.EncodeToString(db)},
+			},
+		} {
+			write(t, agents, now)
+
+			_, err = NewRegistry(filePath)
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// A construct to verify the implementation of an interface.
+var _ Storage = (*dedupStorage)(nil)
+
+// State is the state of an idempotency key.
+type State int
+
+const (
+	// StateNew means the key wasn't seen within the window, the request must be applied.
+	StateNew State = iota
+	// StatePending means a request with the key is being applied right now.
+	StatePending
+	// StateDone means a request with the key was already applied.
+	StateDone
+)
+
+// Storage is the interface that groups the idempotency keys storage methods.
+type Storage interface {
+	Begin(key string) (State, any)
+	Done(key string, response any)
+	Cancel(key string)
+	Window() time.Duration
+}
+
+type entry struct {
+	expiresAt time.Time
+	response  any
+	state     State
+}
+
+type expiration struct {
+	expiresAt time.Time
+	key       string
+}
+
+// dedupStorage keeps the idempotency keys of the applied requests within the window.
+//
+// The window is the same for all keys, so the expirations are kept in the order they were set
+// and the expired keys are dropped from the head of the queue.
+type dedupStorage struct {
+	now    func() time.Time
+	keys   map[string]entry
+	queue  []expiration
+	window time.Duration
+	mu     sync.Mutex
+}
+
+// NewDedupStorage creates a new in-memory storage for idempotency keys.
+func NewDedupStorage(window time.Duration) Storage {
+	return &dedupStorage{
+		now:    time.Now,
+		keys:   make(map[string]entry),
+		window: window,
+	}
+}
+
+// Begin returns the state of the key and the saved response if the key is done.
+// A new key becomes pending, the caller must either mark it done or cancel it.
+func (ds *dedupStorage) Begin(key string) (State, any) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	now := ds.now()
+	ds.expire(now)
+
+	if e, ok := ds.keys[key]; ok {
+		return e.state, e.response
+	}
+
+	ds.set(key, entry{state: StatePending, expiresAt: now.Add(ds.window)})
+
+	return StateNew, nil
+}
+
+// Done marks the key as applied, the replays of the request get the saved response.
+func (ds *dedupStorage) Done(key string, response any) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.set(key, entry{state: StateDone, response: response, expiresAt: ds.now().Add(ds.window)})
+}
+
+// Cancel forgets the pending key, so the request can be retried.
+func (ds *dedupStorage) Cancel(key string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if e, ok := ds.keys[key]; ok && e.state == StatePending {
+		delete(ds.keys, key)
+	}
+}
+
+// Window returns how long the keys are kept.
+func (ds *dedupStorage) Window() time.Duration {
+	return ds.window
+}
+
+func (ds *dedupStorage) set(key string, e entry) {
+	ds.keys[key] = e
+	ds.queue = append(ds.queue, expiration{key: key, expiresAt: e.expiresAt})
+}
+
+// expire drops the keys that expired before now.
+func (ds *dedupStorage) expire(now time.Time) {
+	expired := 0
+	for expired < len(ds.queue) && !ds.queue[expired].expiresAt.After(now) {
+		exp := ds.queue[expired]
+		// the key could have been set again later, so it has a newer expiration in the queue
+		if e, ok := ds.keys[exp.key]; ok && e.expiresAt.Equal(exp.expiresAt) {
+			delete(ds.keys, exp.key)
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		ds.queue = append(ds.queue[:0], ds.queue[expired:]...)
+	}
+}
@@ -0,0 +1,36 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupStorage(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	ds := NewDedupStorage(time.Minute).(*dedupStorage)
+	ds.now = func() time.Time { return now }
+
+	state, _ := ds.Begin("uwu")
+	assert.Equal(t, StateNew, state)
+
+	state, _ = ds.Begin("uwu")
+	assert.Equal(t, StatePending, state)
+
+	ds.Done("uwu", "response")
+	state, response := ds.Begin("uwu")
+	assert.Equal(t, StateDone, state)
+	assert.Equal(t, "response", response)
+
+	state, _ = ds.Begin("owo")
+	assert.Equal(t, StateNew, state)
+	ds.Cancel("owo")
+	state, _ = ds.Begin("owo")
+	assert.Equal(t, StateNew, state)
+
+	now = now.Add(time.Minute)
+	state, _ = ds.Begin("uwu")
+	assert.Equal(t, StateNew, state)
+	assert.Len(t, ds.keys, 1)
+}
@@ -0,0 +1,139 @@
+package history
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+// A construct to verify the implementation of an interface.
+var _ Storage = (*historyStorage)(nil)
+
+// Storage is the interface that groups the metrics history storage methods.
+type Storage interface {
+	Record(mType, mName string, point entity.HistoryPoint)
+	Range(mType, mName string, from, to time.Time, step time.Duration) ([]entity.HistoryPoint, error)
+	Retention() time.Duration
+	Resolution() time.Duration
+}
+
+// historyStorage keeps a bounded series of points for each metric.
+//
+// Points are aligned to the resolution, several updates within the same resolution interval
+// overwrite each other, so each series has at most retention/resolution points.
+type historyStorage struct {
+	series     map[string][]entity.HistoryPoint
+	retention  time.Duration
+	resolution time.Duration
+	maxPoints  int
+	mu         sync.RWMutex
+}
+
+// NewHistoryStorage creates a new in-memory storage for the metrics history.
+func NewHistoryStorage(retention, resolution time.Duration) Storage {
+	if resolution <= 0 {
+		resolution = time.Second
+	}
+	if retention < resolution {
+		retention = resolution
+	}
+
+	return &historyStorage{
+		series:     make(map[string][]entity.HistoryPoint),
+		retention:  retention,
+		resolution: resolution,
+		maxPoints:  int(retention / resolution),
+	}
+}
+
+// Record adds a point to the metric series.
+func (hs *historyStorage) Record(mType, mName string, point entity.HistoryPoint) {
+	point.Timestamp = point.Timestamp.Truncate(hs.resolution).UTC()
+	key := seriesKey(mType, mName)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	points := hs.series[key]
+
+	last := len(points) - 1
+	switch {
+	case last >= 0 && points[last].Timestamp.Equal(point.Timestamp):
+		points[last] = point
+	case last >= 0 && points[last].Timestamp.After(point.Timestamp):
+		// out of order point, the series already has a newer value
+		return
+	case len(points) == hs.maxPoints:
+		copy(points, points[1:])
+		points[last] = point
+	default:
+		points = append(points, point)
+	}
+
+	// drop points that are older than the retention period
+	expired := 0
+	for expired < len(points) && point.Timestamp.Sub(points[expired].Timestamp) >= hs.retention {
+		expired++
+	}
+	if expired > 0 {
+		points = append(points[:0], points[expired:]...)
+	}
+
+	hs.series[key] = points
+}
+
+// Range gets the metric points in the [from, to] interval.
+//
+// If the step is greater than the resolution, the points are downsampled:
+// the last point within each step interval is returned with the timestamp of the interval start.
+func (hs *historyStorage) Range(mType, mName string, from, to time.Time,
+	step time.Duration) ([]entity.HistoryPoint, error) {
+	if to.Before(from) {
+		return nil, entity.ErrIncorrectTimeRange
+	}
+	if step < hs.resolution {
+		step = hs.resolution
+	}
+
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	points, ok := hs.series[seriesKey(mType, mName)]
+	if !ok {
+		return nil, fmt.Errorf("history for %s metric %q doesn't exist", mType, mName)
+	}
+
+	result := make([]entity.HistoryPoint, 0, len(points))
+	for _, point := range points {
+		if point.Timestamp.Before(from) || point.Timestamp.After(to) {
+			continue
+		}
+
+		point.Timestamp = point.Timestamp.Truncate(step)
+
+		last := len(result) - 1
+		if last >= 0 && result[last].Timestamp.Equal(point.Timestamp) {
+			result[last] = point
+			continue
+		}
+		result = append(result, point)
+	}
+
+	return result, nil
+}
+
+// Retention returns how long the points are kept.
+func (hs *historyStorage) Retention() time.Duration {
+	return hs.retention
+}
+
+// Resolution returns the minimum interval between two points of a series.
+func (hs *historyStorage) Resolution() time.Duration {
+	return hs.resolution
+}
+
+func seriesKey(mType, mName string) string {
+	return mType + "/" + mName
+}
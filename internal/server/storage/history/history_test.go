@@ -0,0 +1,87 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
+)
+
+func TestHistoryStorage(t *testing.T) {
+	start := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	gauge := func(value float64, offset time.Duration) entity.HistoryPoint {
+		return entity.HistoryPoint{Timestamp: start.Add(offset), Value: &value}
+	}
+
+	t.Run("points within the same resolution interval are merged", func(t *testing.T) {
+		hs := NewHistoryStorage(time.Minute, 10*time.Second)
+
+		hs.Record(entity.GaugeType, "HeapAlloc", gauge(1, 0))
+		hs.Record(entity.GaugeType, "HeapAlloc", gauge(2, 5*time.Second))
+		hs.Record(entity.GaugeType, "HeapAlloc", gauge(3, 10*time.Second))
+
+		points, err := hs.Range(entity.GaugeType, "HeapAlloc", start, start.Add(time.Minute), 0)
+		require.NoError(t, err)
+		require.Len(t, points, 2)
+		assert.Equal(t, 2.0, *points[0].Value)
+		assert.Equal(t, start, points[0].Timestamp)
+		assert.Equal(t, 3.0, *points[1].Value)
+		assert.Equal(t, start.Add(10*time.Second), points[1].Timestamp)
+	})
+
+	t.Run("old points are dropped after the retention period", func(t *testing.T) {
+		hs := NewHistoryStorage(30*time.Second, 10*time.Second)
+
+		for i := 0; i < 10; i++ {
+			hs.Record(entity.GaugeType, "HeapAlloc", gauge(float64(i), time.Duration(i)*10*time.Second))
+		}
+
+		points, err := hs.Range(entity.GaugeType, "HeapAlloc", start, start.Add(time.Hour), 0)
+		require.NoError(t, err)
+		require.Len(t, points, 3)
+		assert.Equal(t, 7.0, *points[0].Value)
+		assert.Equal(t, 9.0, *points[2].Value)
+	})
+
+	t.Run("range with step and bounds", func(t *testing.T) {
+		hs := NewHistoryStorage(time.Hour, time.Second)
+
+		for i := 0; i < 60; i++ {
+			hs.Record(entity.GaugeType, "CPUutilization0", gauge(float64(i), time.Duration(i)*time.Second))
+		}
+
+		points, err := hs.Range(entity.GaugeType, "CPUutilization0", start.Add(10*time.Second),
+			start.Add(39*time.Second), 10*time.Second)
+		require.NoError(t, err)
+		require.Len(t, points, 3)
+		assert.Equal(t, 19.0, *points[0].Value)
+		assert.Equal(t, start.Add(10*time.Second), points[0].Timestamp)
+		assert.Equal(t, 39.0, *points[2].Value)
+	})
+
+	t.Run("out of order points are ignored", func(t *testing.T) {
+		hs := NewHistoryStorage(time.Hour, time.Second)
+
+		hs.Record(entity.GaugeType, "owo", gauge(2, 2*time.Second))
+		hs.Record(entity.GaugeType, "owo", gauge(1, time.Second))
+
+		points, err := hs.Range(entity.GaugeType, "owo", start, start.Add(time.Minute), 0)
+		require.NoError(t, err)
+		require.Len(t, points, 1)
+		assert.Equal(t, 2.0, *points[0].Value)
+	})
+
+	t.Run("unknown metric and incorrect range", func(t *testing.T) {
+		hs := NewHistoryStorage(time.Hour, time.Second)
+
+		_, err := hs.Range(entity.CounterType, "uwu", start, start.Add(time.Minute), 0)
+		assert.Error(t, err)
+
+		_, err = hs.Range(entity.CounterType, "uwu", start.Add(time.Minute), start, 0)
+		assert.ErrorIs(t, err, entity.ErrIncorrectTimeRange)
+	})
+}
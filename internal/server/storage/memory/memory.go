@@ -2,6 +2,7 @@ package memory
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
 )
@@ -15,46 +16,89 @@ type Storage interface {
 	UpdateGauge(name string, value float64)
 	GetCounter(name string) (int64, error)
 	GetGauge(name string) (float64, error)
+	UpdateHistogram(name string, value entity.Histogram) error
+	GetHistogram(name string) (entity.Histogram, error)
 	GetMetrics() entity.Metrics
 	SetMetrics(metrics entity.Metrics)
+	Transaction(fn func(tx Tx) error) error
 }
 
+// Tx is the interface of the storage view within a transaction.
+type Tx interface {
+	UpdateCounter(name string, value int64)
+	UpdateGauge(name string, value float64)
+	GetCounter(name string) (int64, error)
+	GetGauge(name string) (float64, error)
+	UpdateHistogram(name string, value entity.Histogram) error
+	GetHistogram(name string) (entity.Histogram, error)
+}
+
+// memStorage is safe for concurrent use. All reads that return maps hand out copies,
+// so callers can iterate or encode them without holding the lock.
 type memStorage struct {
-	gauge   map[string]float64
-	counter map[string]int64
+	gauge     map[string]float64
+	counter   map[string]int64
+	histogram map[string]entity.Histogram
+	mu        sync.RWMutex
 }
 
-// NewMemStorage creates a new temporary storage in-memory for gauges and counter metrics.
+// NewMemStorage creates a new temporary storage in-memory for gauge, counter and histogram metrics.
 func NewMemStorage() Storage {
 	return &memStorage{
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
+		gauge:     make(map[string]float64),
+		counter:   make(map[string]int64),
+		histogram: make(map[string]entity.Histogram),
 	}
 }
 
 // UpdateGauge adds a new metric of type gauge to the storage.
 func (ms *memStorage) UpdateGauge(name string, value float64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	ms.gauge[name] = value
 }
 
 // UpdateCounter adds a new metric of type counter to the storage.
 func (ms *memStorage) UpdateCounter(name string, value int64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
 	ms.counter[name] += value
 }
 
-// GetMetrics gets all metrics from in-memory storage.
+// GetMetrics gets a snapshot of all metrics from in-memory storage.
 func (ms *memStorage) GetMetrics() entity.Metrics {
-	return entity.Metrics{Counter: ms.counter, Gauge: ms.gauge}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return entity.Metrics{
+		Counter:   copyMap(ms.counter),
+		Gauge:     copyMap(ms.gauge),
+		Histogram: copyHistograms(ms.histogram),
+	}
 }
 
 // SetMetrics sets all metrics to in-memory storage.
+// The passed maps are copied, so the caller can keep using them.
 func (ms *memStorage) SetMetrics(metrics entity.Metrics) {
-	ms.counter = metrics.Counter
-	ms.gauge = metrics.Gauge
+	counter := copyMap(metrics.Counter)
+	gauge := copyMap(metrics.Gauge)
+	histogram := copyHistograms(metrics.Histogram)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.counter = counter
+	ms.gauge = gauge
+	ms.histogram = histogram
 }
 
 // GetCounter gets a metric of type counter by its name.
 func (ms *memStorage) GetCounter(name string) (int64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	counter, ok := ms.counter[name]
 	if !ok {
 		return 0, fmt.Errorf("counter metric %q doesn't exist", name)
@@ -64,9 +108,159 @@ func (ms *memStorage) GetCounter(name string) (int64, error) {
 
 // GetGauge gets a metric of type gauge by its name.
 func (ms *memStorage) GetGauge(name string) (float64, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	gauge, ok := ms.gauge[name]
 	if !ok {
 		return 0, fmt.Errorf("gauge metric %q doesn't exist", name)
 	}
 	return gauge, nil
 }
+
+// UpdateHistogram merges the bucket counts into the metric of type histogram.
+// The first update defines the bucket bounds, further updates must have the same bounds.
+func (ms *memStorage) UpdateHistogram(name string, value entity.Histogram) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, ok := ms.histogram[name]
+	if !ok {
+		ms.histogram[name] = value.Clone()
+		return nil
+	}
+
+	if err := stored.Merge(value); err != nil {
+		return err
+	}
+	ms.histogram[name] = stored
+
+	return nil
+}
+
+// GetHistogram gets a copy of the metric of type histogram by its name.
+func (ms *memStorage) GetHistogram(name string) (entity.Histogram, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	histogram, ok := ms.histogram[name]
+	if !ok {
+		return entity.Histogram{}, fmt.Errorf("histogram metric %q doesn't exist", name)
+	}
+	return histogram.Clone(), nil
+}
+
+// Transaction runs fn with exclusive access to the storage. The changes made with tx are applied
+// only if fn returns nil, so either all of them are visible to other callers or none.
+func (ms *memStorage) Transaction(fn func(tx Tx) error) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	tx := &memTx{
+		storage:   ms,
+		gauge:     make(map[string]float64),
+		counter:   make(map[string]int64),
+		histogram: make(map[string]entity.Histogram),
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for name, value := range tx.gauge {
+		ms.gauge[name] = value
+	}
+	for name, value := range tx.counter {
+		ms.counter[name] = value
+	}
+	for name, value := range tx.histogram {
+		ms.histogram[name] = value
+	}
+
+	return nil
+}
+
+// memTx keeps the changes made within a transaction on top of the locked storage.
+type memTx struct {
+	storage   *memStorage
+	gauge     map[string]float64
+	counter   map[string]int64
+	histogram map[string]entity.Histogram
+}
+
+func (tx *memTx) UpdateGauge(name string, value float64) {
+	tx.gauge[name] = value
+}
+
+func (tx *memTx) UpdateCounter(name string, value int64) {
+	counter, _ := tx.GetCounter(name)
+	tx.counter[name] = counter + value
+}
+
+func (tx *memTx) GetCounter(name string) (int64, error) {
+	if counter, ok := tx.counter[name]; ok {
+		return counter, nil
+	}
+
+	counter, ok := tx.storage.counter[name]
+	if !ok {
+		return 0, fmt.Errorf("counter metric %q doesn't exist", name)
+	}
+	return counter, nil
+}
+
+func (tx *memTx) GetGauge(name string) (float64, error) {
+	if gauge, ok := tx.gauge[name]; ok {
+		return gauge, nil
+	}
+
+	gauge, ok := tx.storage.gauge[name]
+	if !ok {
+		return 0, fmt.Errorf("gauge metric %q doesn't exist", name)
+	}
+	return gauge, nil
+}
+
+func (tx *memTx) UpdateHistogram(name string, value entity.Histogram) error {
+	stored, err := tx.GetHistogram(name)
+	if err != nil {
+		tx.histogram[name] = value.Clone()
+		return nil
+	}
+
+	if err = stored.Merge(value); err != nil {
+		return err
+	}
+	tx.histogram[name] = stored
+
+	return nil
+}
+
+func (tx *memTx) GetHistogram(name string) (entity.Histogram, error) {
+	histogram, ok := tx.histogram[name]
+	if !ok {
+		histogram, ok = tx.storage.histogram[name]
+	}
+	if !ok {
+		return entity.Histogram{}, fmt.Errorf("histogram metric %q doesn't exist", name)
+	}
+	return histogram.Clone(), nil
+}
+
+// copyHistograms returns a deep copy of the histograms map.
+func copyHistograms(src map[string]entity.Histogram) map[string]entity.Histogram {
+	dst := make(map[string]entity.Histogram, len(src))
+	for k, v := range src {
+		dst[k] = v.Clone()
+	}
+	return dst
+}
+
+// copyMap returns a shallow copy of the map, a nil map is copied as an empty one.
+func copyMap[V any](src map[string]V) map[string]V {
+	dst := make(map[string]V, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
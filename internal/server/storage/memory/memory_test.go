@@ -1,6 +1,9 @@
 package memory
 
 import (
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,10 +42,65 @@ func TestMemoryStorage(t *testing.T) {
 		assert.Equal(t, float64(0), gauge)
 	})
 
+	t.Run("update histogram", func(t *testing.T) {
+		update := entity.NewHistogram([]float64{1, 10})
+		update.Observe(0.5)
+		update.Observe(100)
+
+		assert.NoError(t, ms.UpdateHistogram("latency", update))
+		assert.NoError(t, ms.UpdateHistogram("latency", update))
+
+		value, err := ms.GetHistogram("latency")
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{2, 0, 2}, value.Counts)
+		assert.Equal(t, uint64(4), value.Count)
+		assert.Equal(t, 201.0, value.Sum)
+
+		err = ms.UpdateHistogram("latency", entity.NewHistogram([]float64{1, 5}))
+		assert.ErrorIs(t, err, entity.ErrIncorrectMetricValue)
+
+		_, err = ms.GetHistogram("UwU")
+		assert.Error(t, err)
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		err := ms.Transaction(func(tx Tx) error {
+			tx.UpdateCounter("tx counter", 1)
+			tx.UpdateCounter("tx counter", 2)
+			tx.UpdateGauge("tx gauge", 1.5)
+
+			counter, err := tx.GetCounter("tx counter")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), counter)
+
+			return nil
+		})
+		assert.NoError(t, err)
+
+		counter, err := ms.GetCounter("tx counter")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), counter)
+
+		err = ms.Transaction(func(tx Tx) error {
+			tx.UpdateCounter("tx counter", 10)
+			tx.UpdateGauge("rolled back gauge", 1)
+			return tx.UpdateHistogram("latency", entity.NewHistogram([]float64{1, 5}))
+		})
+		assert.ErrorIs(t, err, entity.ErrIncorrectMetricValue)
+
+		counter, err = ms.GetCounter("tx counter")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), counter)
+
+		_, err = ms.GetGauge("rolled back gauge")
+		assert.Error(t, err)
+	})
+
 	t.Run("check get/set metrics", func(t *testing.T) {
 		metrics := entity.Metrics{
-			Counter: make(map[string]int64),
-			Gauge:   make(map[string]float64),
+			Counter:   make(map[string]int64),
+			Gauge:     make(map[string]float64),
+			Histogram: make(map[string]entity.Histogram),
 		}
 
 		metrics.Counter["counter 1"] = 678
@@ -50,6 +108,12 @@ func TestMemoryStorage(t *testing.T) {
 		metrics.Gauge["gauge 1"] = 123.456
 		metrics.Gauge["gauge 2"] = 789.456
 		metrics.Gauge["gauge 2"] = 0
+		metrics.Histogram["histogram 1"] = entity.Histogram{
+			Bounds: []float64{1},
+			Counts: []uint64{3, 1},
+			Sum:    4.5,
+			Count:  4,
+		}
 
 		ms.SetMetrics(metrics)
 
@@ -58,6 +122,51 @@ func TestMemoryStorage(t *testing.T) {
 	})
 }
 
+func TestMemoryStorageConcurrent(t *testing.T) {
+	const (
+		writers = 8
+		updates = 1000
+	)
+
+	ms := NewMemStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				ms.UpdateCounter("PollCount", 1)
+				ms.UpdateGauge(fmt.Sprintf("gauge %d", i), float64(j))
+			}
+		}(i)
+	}
+
+	// readers iterate over snapshots while the writers are still working,
+	// just like the persistent storage does when it encodes metrics
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				metrics := ms.GetMetrics()
+				_, err := json.Marshal(metrics)
+				assert.NoError(t, err)
+				metrics.Counter["snapshot only"] = 1
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	counter, err := ms.GetCounter("PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(writers*updates), counter)
+
+	_, err = ms.GetCounter("snapshot only")
+	assert.Error(t, err)
+}
+
 func BenchmarkMemoryStorage(b *testing.B) {
 	ms := NewMemStorage()
 	b.ResetTimer()
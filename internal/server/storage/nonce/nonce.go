@@ -0,0 +1,75 @@
+package nonce
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrIncorrect = errors.New("incorrect signature timestamp or nonce")
+	ErrStale     = errors.New("signature timestamp is stale")
+	ErrUsed      = errors.New("signature nonce has been used")
+)
+
+// Storage remembers the nonces of the signed requests until their timestamps are stale,
+// after that the requests are rejected by the timestamp check.
+type Storage struct {
+	seen         map[string]time.Time
+	lastSweep    time.Time
+	maxClockSkew time.Duration
+	mu           sync.Mutex
+}
+
+// NewStorage creates a new in-memory storage for the nonces, the request timestamps
+// are accepted within maxClockSkew of the server time in both directions.
+func NewStorage(maxClockSkew time.Duration) *Storage {
+	return &Storage{
+		seen:         make(map[string]time.Time),
+		maxClockSkew: maxClockSkew,
+	}
+}
+
+// Check checks that the timestamp (Unix time in seconds) is fresh and remembers the nonce,
+// the nonce that has been used before is rejected.
+func (s *Storage) Check(timestamp, nonce string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return ErrIncorrect
+	}
+
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > s.maxClockSkew || skew < -s.maxClockSkew {
+		return ErrStale
+	}
+
+	if !s.add(nonce, now) {
+		return ErrUsed
+	}
+
+	return nil
+}
+
+// add remembers the nonce, it returns false if the nonce has been used.
+func (s *Storage) add(nonce string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ttl := 2 * s.maxClockSkew
+
+	if now.Sub(s.lastSweep) > ttl {
+		for seen, expires := range s.seen {
+			if now.After(expires) {
+				delete(s.seen, seen)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expires, ok := s.seen[nonce]; ok && !now.After(expires) {
+		return false
+	}
+	s.seen[nonce] = now.Add(ttl)
+
+	return true
+}
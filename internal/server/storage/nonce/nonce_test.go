@@ -0,0 +1,28 @@
+package nonce
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorage(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStorage(time.Minute)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	assert.NoError(t, s.Check(timestamp, "uwu", now))
+	assert.ErrorIs(t, s.Check(timestamp, "uwu", now), ErrUsed)
+	assert.NoError(t, s.Check(timestamp, "owo", now))
+
+	assert.ErrorIs(t, s.Check(timestamp, "", now), ErrIncorrect)
+	assert.ErrorIs(t, s.Check("yesterday", "nonce", now), ErrIncorrect)
+	assert.ErrorIs(t, s.Check(timestamp, "stale", now.Add(2*time.Minute)), ErrStale)
+	assert.ErrorIs(t, s.Check(timestamp, "future", now.Add(-2*time.Minute)), ErrStale)
+
+	// the nonce is forgotten when its timestamp can't be accepted anymore
+	later := now.Add(3 * time.Minute)
+	assert.NoError(t, s.Check(strconv.FormatInt(later.Unix(), 10), "uwu", later))
+}
@@ -48,13 +48,17 @@ ON CONFLICT (id) DO UPDATE SET mdelta = EXCLUDED.mdelta;
 */
 
 const (
-	saveGauge = `INSERT INTO metrics (id, mtype, mdelta, mvalue)
-VALUES ($1, $2, $3, $4)
+	saveGauge = `INSERT INTO metrics (id, mname, mlabels, mtype, mdelta, mvalue)
+VALUES ($1, $2, $3, $4, $5, $6)
 ON CONFLICT (id) DO UPDATE SET mvalue = EXCLUDED.mvalue;`
-	saveCounter = `INSERT INTO metrics (id, mtype, mdelta, mvalue)
-VALUES ($1, $2, $3, $4) ON CONFLICT (id)
+	saveCounter = `INSERT INTO metrics (id, mname, mlabels, mtype, mdelta, mvalue)
+VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id)
 DO UPDATE SET mdelta = EXCLUDED.mdelta;`
-	getMetrics = "SELECT id, mtype, mdelta, mvalue FROM metrics;"
+	saveHistogram = `INSERT INTO metrics (id, mname, mlabels, mtype, mbounds, mcounts, msum, mcount)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (id)
+DO UPDATE SET mbounds = EXCLUDED.mbounds, mcounts = EXCLUDED.mcounts,
+msum = EXCLUDED.msum, mcount = EXCLUDED.mcount;`
+	getMetrics = "SELECT id, mtype, mdelta, mvalue, mbounds, mcounts, msum, mcount FROM metrics;"
 )
 
 type dbStorage struct {
@@ -90,11 +94,23 @@ func (ds *dbStorage) Save(ctx context.Context) error {
 	batch := &pgx.Batch{}
 
 	for id, metric := range metrics.Gauge {
-		batch.Queue(saveGauge, id, "gauge", nil, metric)
+		name, labels := seriesColumns(id)
+		batch.Queue(saveGauge, id, name, labels, "gauge", nil, metric)
 	}
 
 	for id, metric := range metrics.Counter {
-		batch.Queue(saveCounter, id, "counter", metric, nil)
+		name, labels := seriesColumns(id)
+		batch.Queue(saveCounter, id, name, labels, "counter", metric, nil)
+	}
+
+	for id, metric := range metrics.Histogram {
+		counts := make([]int64, 0, len(metric.Counts))
+		for _, count := range metric.Counts {
+			counts = append(counts, int64(count))
+		}
+
+		name, labels := seriesColumns(id)
+		batch.Queue(saveHistogram, id, name, labels, "histogram", metric.Bounds, counts, metric.Sum, int64(metric.Count))
 	}
 
 	results := tx.SendBatch(ctx, batch)
@@ -123,6 +139,7 @@ func (ds *dbStorage) Restore(ctx context.Context) error {
 	var metrics entity.Metrics
 	metrics.Counter = make(map[string]int64)
 	metrics.Gauge = make(map[string]float64)
+	metrics.Histogram = make(map[string]entity.Histogram)
 
 	rows, err := ds.db.Pool.Query(ctx, getMetrics)
 	if err != nil {
@@ -131,10 +148,14 @@ func (ds *dbStorage) Restore(ctx context.Context) error {
 	defer rows.Close()
 
 	type Metric struct {
-		mdelta *int64
-		mvalue *float64
-		id     string
-		mtype  string
+		mdelta  *int64
+		mvalue  *float64
+		msum    *float64
+		mcount  *int64
+		id      string
+		mtype   string
+		mbounds []float64
+		mcounts []int64
 	}
 
 	for rows.Next() {
@@ -145,6 +166,10 @@ func (ds *dbStorage) Restore(ctx context.Context) error {
 			&metric.mtype,
 			&metric.mdelta,
 			&metric.mvalue,
+			&metric.mbounds,
+			&metric.mcounts,
+			&metric.msum,
+			&metric.mcount,
 		)
 		if err != nil {
 			return err
@@ -156,9 +181,36 @@ func (ds *dbStorage) Restore(ctx context.Context) error {
 		if metric.mtype == entity.CounterType {
 			metrics.Counter[metric.id] = *metric.mdelta
 		}
+		if metric.mtype == entity.HistogramType {
+			histogram := entity.Histogram{
+				Bounds: metric.mbounds,
+				Counts: make([]uint64, 0, len(metric.mcounts)),
+			}
+			for _, count := range metric.mcounts {
+				histogram.Counts = append(histogram.Counts, uint64(count))
+			}
+			if metric.msum != nil {
+				histogram.Sum = *metric.msum
+			}
+			if metric.mcount != nil {
+				histogram.Count = uint64(*metric.mcount)
+			}
+			metrics.Histogram[metric.id] = histogram
+		}
 	}
 
 	ds.memoryStorage.SetMetrics(metrics)
 
 	return nil
 }
+
+// seriesColumns splits the series key into the metric name and labels columns.
+// The key itself stays the primary key, so the metrics are restored by it.
+func seriesColumns(id string) (string, map[string]string) {
+	name, labels := entity.ParseSeriesKey(id)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	return name, labels
+}
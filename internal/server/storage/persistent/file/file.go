@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"sync"
 
 	"github.com/ivas1ly/uwu-metrics/internal/server/entity"
 	"github.com/ivas1ly/uwu-metrics/internal/server/storage/memory"
@@ -14,6 +15,9 @@ type fileStorage struct {
 	memoryStorage memory.Storage
 	fileName      string
 	perm          os.FileMode
+	// mu serializes access to the file, Save can be called concurrently
+	// by the write sync middleware and the periodic save job.
+	mu sync.Mutex
 }
 
 // NewFileStorage creates new persistent storage in the file.
@@ -27,7 +31,10 @@ func NewFileStorage(fileName string, perm os.FileMode, storage memory.Storage) p
 
 // Save takes the metrics from memory and saves them to the file.
 func (fs *fileStorage) Save(_ context.Context) error {
-	file, err := os.OpenFile(fs.fileName, os.O_WRONLY|os.O_CREATE, fs.perm)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	file, err := os.OpenFile(fs.fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.perm)
 	if err != nil {
 		return err
 	}
@@ -47,10 +54,14 @@ func (fs *fileStorage) Save(_ context.Context) error {
 
 // Restore fetches the last saved metrics from the file and restores them to in-memory storage.
 func (fs *fileStorage) Restore(_ context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	file, err := os.OpenFile(fs.fileName, os.O_RDONLY|os.O_CREATE, fs.perm)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	var metrics entity.Metrics
 	decoder := json.NewDecoder(file)
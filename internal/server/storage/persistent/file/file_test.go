@@ -2,7 +2,10 @@ package file
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -71,6 +74,69 @@ func TestFileStorage(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, int64(123), counter)
 	})
+
+	t.Run("histogram snapshot", func(t *testing.T) {
+		histogram := entity.NewHistogram([]float64{1, 10})
+		histogram.Observe(5)
+		assert.NoError(t, ms.UpdateHistogram("latency", histogram))
+
+		err = fileStorage.Save(context.Background())
+		assert.NoError(t, err)
+
+		ms.SetMetrics(entity.Metrics{})
+
+		err = fileStorage.Restore(context.Background())
+		assert.NoError(t, err)
+
+		restored, err := ms.GetHistogram("latency")
+		assert.NoError(t, err)
+		assert.Equal(t, histogram, restored)
+
+		counter, err := ms.GetCounter("counter 2")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(123), counter)
+	})
+}
+
+func TestFileStorageConcurrent(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-metrics-concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := tmpFile.Name()
+	tmpFile.Close()
+	defer os.Remove(fileName)
+
+	ms := memory.NewMemStorage()
+	fileStorage := NewFileStorage(fileName, 0666, ms)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				ms.UpdateCounter("PollCount", 1)
+				ms.UpdateGauge(fmt.Sprintf("gauge %d", i), float64(j))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.NoError(t, fileStorage.Save(context.Background()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, fileStorage.Save(context.Background()))
+
+	data, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+
+	var saved entity.Metrics
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	assert.Equal(t, int64(2000), saved.Counter["PollCount"])
 }
 
 func BenchmarkFileStorage(b *testing.B) {
@@ -0,0 +1,227 @@
+// Package envelope encrypts the payloads of the agent with the server public key.
+//
+// The payload is encrypted with a random AES-256-GCM data key and the data key
+// is encrypted with RSA-OAEP (SHA-256), so the payload size isn't limited by the RSA key size.
+// The envelope is
+//
+//	version (1 byte) | key ID length (1 byte) | key ID | wrapped key length (2 bytes, big endian) |
+//	wrapped key | nonce (12 bytes) | ciphertext
+//
+// The key ID identifies the server key pair, so the server can have several keys during
+// the key rotation. The version 1 envelopes have no key ID fields. The header before
+// the nonce is authenticated as the additional data of AES-GCM.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// Version1 is the envelope without the key ID.
+	Version1 byte = 1
+	// Version2 is the envelope with the key ID.
+	Version2 byte = 2
+)
+
+const (
+	dataKeySize = 32
+	keyIDSize   = 8
+	// keyIDOffset is the size of the version and the key ID length.
+	keyIDOffset = 2
+	// wrappedKeyLenSize is the size of the wrapped key length.
+	wrappedKeyLenSize = 2
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrMalformed          = errors.New("malformed envelope")
+	ErrUnknownKey         = errors.New("unknown key ID")
+)
+
+// KeyID returns the ID of the key pair, the hex encoded prefix of the public key SHA-256 hash.
+func KeyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+
+	return hex.EncodeToString(sum[:keyIDSize])
+}
+
+// Seal encrypts the payload with the public key, the envelope has the key ID.
+func Seal(key *rsa.PublicKey, payload []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, dataKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't wrap data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID := KeyID(key)
+
+	header := make([]byte, 0, keyIDOffset+len(keyID)+wrappedKeyLenSize+len(wrappedKey))
+	header = append(header, Version2, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(header)+len(nonce)+len(payload)+gcm.Overhead())
+	sealed = append(sealed, header...)
+	sealed = append(sealed, nonce...)
+
+	return gcm.Seal(sealed, nonce, payload, header), nil
+}
+
+// Keyring opens the envelopes sealed with the public keys of its private keys. The keys are
+// rotated without dropping the payloads: the new key is added to the server, the agents
+// are moved to the new public key, then the old key is removed.
+type Keyring struct {
+	keys map[string]*rsa.PrivateKey
+	ids  []string
+}
+
+// NewKeyring creates a new keyring with the keys.
+func NewKeyring(keys ...*rsa.PrivateKey) *Keyring {
+	k := &Keyring{
+		keys: make(map[string]*rsa.PrivateKey, len(keys)),
+		ids:  make([]string, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		id := KeyID(&key.PublicKey)
+		if _, ok := k.keys[id]; ok {
+			continue
+		}
+		k.keys[id] = key
+		k.ids = append(k.ids, id)
+	}
+	sort.Strings(k.ids)
+
+	return k
+}
+
+// IDs returns the sorted IDs of the keys.
+func (k *Keyring) IDs() []string {
+	return append([]string(nil), k.ids...)
+}
+
+// Open decrypts the envelope with the key of its key ID. The version 1 envelope
+// has no key ID, so each key is tried.
+func (k *Keyring) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, ErrMalformed
+	}
+
+	switch sealed[0] {
+	case Version1:
+		return k.openV1(sealed)
+	case Version2:
+		return k.openV2(sealed)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, sealed[0])
+	}
+}
+
+func (k *Keyring) openV1(sealed []byte) ([]byte, error) {
+	headerSize, wrappedKey, ok := readWrappedKey(sealed, 1)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	for _, id := range k.ids {
+		if payload, err := open(k.keys[id], sealed, headerSize, wrappedKey); err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: can't unwrap data key with any key", ErrMalformed)
+}
+
+func (k *Keyring) openV2(sealed []byte) ([]byte, error) {
+	if len(sealed) < keyIDOffset || len(sealed) < keyIDOffset+int(sealed[1]) {
+		return nil, ErrMalformed
+	}
+	keyID := string(sealed[keyIDOffset : keyIDOffset+int(sealed[1])])
+
+	headerSize, wrappedKey, ok := readWrappedKey(sealed, keyIDOffset+len(keyID))
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	return open(key, sealed, headerSize, wrappedKey)
+}
+
+// readWrappedKey reads the wrapped key length and the wrapped key at i,
+// it returns the size of the header with the wrapped key.
+func readWrappedKey(sealed []byte, i int) (int, []byte, bool) {
+	if len(sealed) < i+wrappedKeyLenSize {
+		return 0, nil, false
+	}
+
+	size := int(binary.BigEndian.Uint16(sealed[i:]))
+	i += wrappedKeyLenSize
+	if len(sealed) < i+size {
+		return 0, nil, false
+	}
+
+	return i + size, sealed[i : i+size], true
+}
+
+func open(key *rsa.PrivateKey, sealed []byte, headerSize int, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, key, wrappedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't unwrap data key", ErrMalformed)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header, rest := sealed[:headerSize], sealed[headerSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+
+	payload, err := gcm.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	return payload, nil
+}
+
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,128 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sealV1 seals the payload in the envelope without the key ID.
+func sealV1(t *testing.T, key *rsa.PublicKey, payload []byte) []byte {
+	t.Helper()
+
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	require.NoError(t, err)
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, dataKey, nil)
+	require.NoError(t, err)
+
+	gcm, err := newGCM(dataKey)
+	require.NoError(t, err)
+
+	header := []byte{Version1}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+
+	return gcm.Seal(append(bytes.Clone(header), nonce...), nonce, payload, header)
+}
+
+func TestEnvelope(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyring := NewKeyring(key)
+
+	t.Run("large payload", func(t *testing.T) {
+		payload := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 100000)
+
+		sealed, err := Seal(&key.PublicKey, payload)
+		require.NoError(t, err)
+		assert.Equal(t, Version2, sealed[0])
+
+		opened, err := keyring.Open(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, payload, opened)
+	})
+
+	t.Run("empty payload", func(t *testing.T) {
+		sealed, err := Seal(&key.PublicKey, nil)
+		require.NoError(t, err)
+
+		opened, err := keyring.Open(sealed)
+		require.NoError(t, err)
+		assert.Empty(t, opened)
+	})
+
+	t.Run("incorrect envelopes", func(t *testing.T) {
+		sealed, err := Seal(&key.PublicKey, []byte("payload"))
+		require.NoError(t, err)
+
+		tampered := bytes.Clone(sealed)
+		tampered[len(tampered)-1] ^= 1
+		_, err = keyring.Open(tampered)
+		assert.ErrorIs(t, err, ErrMalformed)
+
+		unknownVersion := bytes.Clone(sealed)
+		unknownVersion[0] = 3
+		_, err = keyring.Open(unknownVersion)
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+		_, err = keyring.Open(sealed[:len(sealed)/2])
+		assert.ErrorIs(t, err, ErrMalformed)
+
+		_, err = keyring.Open(sealed[:5])
+		assert.ErrorIs(t, err, ErrMalformed)
+
+		_, err = keyring.Open(nil)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyring := NewKeyring(oldKey, newKey, oldKey)
+	assert.Len(t, keyring.IDs(), 2)
+	assert.Contains(t, keyring.IDs(), KeyID(&oldKey.PublicKey))
+	assert.Contains(t, keyring.IDs(), KeyID(&newKey.PublicKey))
+
+	t.Run("payloads of both keys are opened during rotation", func(t *testing.T) {
+		for _, key := range []*rsa.PrivateKey{oldKey, newKey} {
+			sealed, err := Seal(&key.PublicKey, []byte("payload"))
+			require.NoError(t, err)
+
+			opened, err := keyring.Open(sealed)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("payload"), opened)
+
+			opened, err = keyring.Open(sealV1(t, &key.PublicKey, []byte("legacy payload")))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("legacy payload"), opened)
+		}
+	})
+
+	t.Run("removed key", func(t *testing.T) {
+		rotated := NewKeyring(newKey)
+
+		sealed, err := Seal(&oldKey.PublicKey, []byte("payload"))
+		require.NoError(t, err)
+		_, err = rotated.Open(sealed)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+
+		_, err = rotated.Open(sealV1(t, &oldKey.PublicKey, []byte("legacy payload")))
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
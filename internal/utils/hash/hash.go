@@ -4,6 +4,11 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // Hash creates a SHA256 hash from the passed string
@@ -17,3 +22,67 @@ func Hash(value, key []byte) (string, error) {
 
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// RequestHash creates a SHA256 hash from the canonical request and key and returns
+// the result in hex format.
+func RequestHash(method, requestURI, timestamp, nonce string, body, key []byte) (string, error) {
+	return Hash(CanonicalRequest(method, requestURI, timestamp, nonce, body), key)
+}
+
+// CanonicalRequest returns the signed part of the request: the method, the request URI,
+// the timestamp, the nonce and the body. The fields are separated by new lines, so the signed
+// request can't be replayed with another method or path, and the server rejects the reused
+// nonces and the stale timestamps.
+func CanonicalRequest(method, requestURI, timestamp, nonce string, body []byte) []byte {
+	value := []byte(strings.Join([]string{method, requestURI, timestamp, nonce, ""}, "\n"))
+
+	return append(value, body...)
+}
+
+// signedFields are the names of the message fields with the hash and the agent signature,
+// they aren't covered by the hash and the signature.
+var signedFields = []protoreflect.Name{"hash", "signature"}
+
+// MessageHash creates a SHA256 hash from the deterministically marshalled message without
+// its hash and signature fields and key and returns the result in hex format.
+func MessageHash(msg proto.Message, key []byte) (string, error) {
+	buf, err := MessageBody(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return Hash(buf, key)
+}
+
+// CallHash creates a SHA256 hash from the canonical request of the gRPC call and key and returns
+// the result in hex format. A gRPC call is a POST request to the full method name, the body is
+// the message body.
+func CallHash(fullMethod, timestamp, nonce string, msg proto.Message, key []byte) (string, error) {
+	buf, err := MessageBody(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return RequestHash(http.MethodPost, fullMethod, timestamp, nonce, buf, key)
+}
+
+// MessageBody returns the deterministically marshalled message without its hash and signature
+// fields, it's the body of the canonical request of the gRPC call.
+func MessageBody(msg proto.Message) ([]byte, error) {
+	cloned := false
+	for _, name := range signedFields {
+		m := msg.ProtoReflect()
+		fd := m.Descriptor().Fields().ByName(name)
+		if fd == nil || !m.Has(fd) {
+			continue
+		}
+
+		if !cloned {
+			msg = proto.Clone(msg)
+			cloned = true
+		}
+		msg.ProtoReflect().Clear(fd)
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
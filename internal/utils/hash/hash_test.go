@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHash(t *testing.T) {
@@ -15,6 +16,26 @@ func TestHash(t *testing.T) {
 	})
 }
 
+func TestRequestHash(t *testing.T) {
+	body := []byte("test value")
+	key := []byte("some key")
+
+	sign, err := RequestHash("POST", "/updates/", "1700000000", "nonce", body, key)
+	require.NoError(t, err)
+
+	for _, other := range [][4]string{
+		{"PUT", "/updates/", "1700000000", "nonce"},
+		{"POST", "/update/", "1700000000", "nonce"},
+		{"POST", "/updates/", "1700000001", "nonce"},
+		{"POST", "/updates/", "1700000000", "other nonce"},
+		{"POST", "/updates/\n1700000000", "", "nonce"},
+	} {
+		otherSign, err := RequestHash(other[0], other[1], other[2], other[3], body, key)
+		require.NoError(t, err)
+		assert.NotEqual(t, sign, otherSign, other)
+	}
+}
+
 func BenchmarkHash(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_, _ = Hash([]byte("test value"), []byte("some key"))
@@ -0,0 +1,18 @@
+package randkey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const keySize = 16
+
+// RandKey returns a random 128-bit key in hex, e.g. to identify a batch of metrics.
+func RandKey() (string, error) {
+	buf := make([]byte, keySize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,18 @@
+package randkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandKey(t *testing.T) {
+	first, err := RandKey()
+	require.NoError(t, err)
+	assert.Len(t, first, 2*keySize)
+
+	second, err := RandKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
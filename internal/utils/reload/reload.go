@@ -0,0 +1,145 @@
+// Package reload keeps the values loaded from the files up to date with the files,
+// e.g. the certificates can be renewed without a restart.
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckInterval is the minimum interval between the checks of the files, so the files
+// aren't checked on each Get.
+const CheckInterval = time.Second
+
+// Reloader keeps the value loaded from the files and loads it again when a file is modified.
+// If the modified files can't be loaded, e.g. the certificate is updated before the key,
+// the previous value is used until the next attempt.
+type Reloader[T any] struct {
+	value          atomic.Pointer[T]
+	load           func() (T, error)
+	onError        func(error)
+	paths          []string
+	modTimes       []time.Time
+	failedModTimes []time.Time
+	mu             sync.Mutex
+	nextCheck      atomic.Int64
+}
+
+// New loads the value from the files and creates a new reloader.
+func New[T any](load func() (T, error), paths ...string) (*Reloader[T], error) {
+	r := &Reloader[T]{
+		load:  load,
+		paths: paths,
+	}
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	r.value.Store(&value)
+	r.modTimes = modTimes
+	r.nextCheck.Store(time.Now().Add(CheckInterval).UnixNano())
+
+	return r, nil
+}
+
+// OnError sets the function that is called when the modified files can't be loaded, e.g. to log
+// the error. It's called once for each modification, not on each Get.
+func (r *Reloader[T]) OnError(fn func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onError = fn
+}
+
+// Get returns the value, it's loaded again if a file is modified since the last load.
+// The files are checked at most once per CheckInterval, the other calls don't wait for the check
+// and return the current value.
+func (r *Reloader[T]) Get() T {
+	now := time.Now()
+	if now.UnixNano() >= r.nextCheck.Load() && r.mu.TryLock() {
+		r.check(now)
+		r.mu.Unlock()
+	}
+
+	return *r.value.Load()
+}
+
+func (r *Reloader[T]) check(now time.Time) {
+	// the files could be checked by the other call after this one has read the next check time
+	if now.UnixNano() < r.nextCheck.Load() {
+		return
+	}
+	r.nextCheck.Store(now.Add(CheckInterval).UnixNano())
+
+	modTimes, err := r.stat()
+	if err != nil || equalTimes(modTimes, r.modTimes) {
+		return
+	}
+
+	value, err := r.load()
+	if err != nil {
+		if r.onError != nil && !equalTimes(modTimes, r.failedModTimes) {
+			r.onError(err)
+		}
+		r.failedModTimes = modTimes
+		return
+	}
+
+	r.value.Store(&value)
+	r.modTimes = modTimes
+	r.failedModTimes = nil
+}
+
+// stat returns the modification times of the files, the directories have the modification times
+// of the files inside too, since the files rewritten in place don't modify the directory.
+func (r *Reloader[T]) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, 0, len(r.paths))
+	for _, path := range r.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+
+		if !info.IsDir() {
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// the symlinks are followed, e.g. the keys mounted from a Kubernetes secret
+			entryInfo, errStat := os.Stat(filepath.Join(path, entry.Name()))
+			if errStat != nil {
+				return nil, errStat
+			}
+			modTimes = append(modTimes, entryInfo.ModTime())
+		}
+	}
+
+	return modTimes, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
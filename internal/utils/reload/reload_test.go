@@ -0,0 +1,72 @@
+package reload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.pem")
+
+	write := func(t *testing.T, content string, modTime time.Time) {
+		t.Helper()
+
+		require.NoError(t, os.WriteFile(keyPath, []byte(content), 0600))
+		require.NoError(t, os.Chtimes(keyPath, modTime, modTime))
+	}
+
+	// the files are checked on the next Get
+	expire := func(r *Reloader[string]) {
+		r.nextCheck.Store(0)
+	}
+
+	now := time.Now()
+	write(t, "first", now)
+	// the directory isn't modified when the file is rewritten in place
+	require.NoError(t, os.Chtimes(dir, now, now))
+
+	r, err := New(func() (string, error) {
+		buf, errRead := os.ReadFile(keyPath)
+		if string(buf) == "broken" {
+			return "", errors.New("broken key")
+		}
+		return string(buf), errRead
+	}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "first", r.Get())
+
+	var reloadErrors []error
+	r.OnError(func(err error) {
+		reloadErrors = append(reloadErrors, err)
+	})
+
+	t.Run("files aren't checked before the interval", func(t *testing.T) {
+		write(t, "second", now.Add(time.Second))
+		assert.Equal(t, "first", r.Get())
+	})
+
+	t.Run("file rewritten in place", func(t *testing.T) {
+		expire(r)
+		assert.Equal(t, "second", r.Get())
+	})
+
+	t.Run("incorrect file keeps the previous value", func(t *testing.T) {
+		write(t, "broken", now.Add(2*time.Second))
+
+		for i := 0; i < 3; i++ {
+			expire(r)
+			assert.Equal(t, "second", r.Get())
+		}
+
+		// the error is reported once for the modification, not on each check
+		require.Len(t, reloadErrors, 1)
+		assert.ErrorContains(t, reloadErrors[0], "broken key")
+	})
+}
@@ -0,0 +1,53 @@
+package rsakeys
+
+import (
+	"strings"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/envelope"
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+)
+
+// Keyring keeps the keyring of the private keys up to date with the files and directories,
+// e.g. a new key added to the directory is used without a restart. If the modified files
+// can't be loaded, the previous keys are used.
+type Keyring struct {
+	keys *reload.Reloader[*envelope.Keyring]
+}
+
+// NewKeyring loads the private keys from the comma-separated list of files and directories.
+func NewKeyring(paths string) (*Keyring, error) {
+	var watched []string
+	for _, path := range strings.Split(paths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			watched = append(watched, path)
+		}
+	}
+
+	keys, err := reload.New(func() (*envelope.Keyring, error) {
+		privateKeys, err := PrivateKeys(paths)
+		if err != nil {
+			return nil, err
+		}
+		return envelope.NewKeyring(privateKeys...), nil
+	}, watched...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keyring{keys: keys}, nil
+}
+
+// Get returns the current keyring, the nil keyring has no keys.
+func (k *Keyring) Get() *envelope.Keyring {
+	if k == nil {
+		return nil
+	}
+
+	return k.keys.Get()
+}
+
+// OnReloadError sets the function that is called when the modified files can't be loaded,
+// the previous keys are used until the files are fixed.
+func (k *Keyring) OnReloadError(fn func(error)) {
+	k.keys.OnError(fn)
+}
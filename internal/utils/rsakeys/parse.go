@@ -4,11 +4,20 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
+var (
+	errNoPublicKey  = errors.New("no RSA PUBLIC KEY PEM block")
+	errNoPrivateKey = errors.New("no RSA PRIVATE KEY PEM block")
+)
+
 func PublicKey(filePath string) (*rsa.PublicKey, error) {
 	file, err := os.ReadFile(filePath)
 	if err != nil {
@@ -18,8 +27,8 @@ func PublicKey(filePath string) (*rsa.PublicKey, error) {
 
 	pemBlock, _ := pem.Decode(file)
 	if pemBlock == nil || pemBlock.Type != "RSA PUBLIC KEY" {
-		zap.L().Error("failed to decode PEM block containing RSA PUBLIC KEY", zap.String("type", pemBlock.Type))
-		return nil, err
+		zap.L().Error("failed to decode PEM block containing RSA PUBLIC KEY", zap.String("file path", filePath))
+		return nil, fmt.Errorf("%w in %s", errNoPublicKey, filePath)
 	}
 
 	publicKey, err := x509.ParsePKCS1PublicKey(pemBlock.Bytes)
@@ -40,8 +49,8 @@ func PrivateKey(filePath string) (*rsa.PrivateKey, error) {
 
 	pemBlock, _ := pem.Decode(file)
 	if pemBlock == nil || pemBlock.Type != "RSA PRIVATE KEY" {
-		zap.L().Error("failed to decode PEM block containing RSA PRIVATE KEY", zap.String("type", pemBlock.Type))
-		return nil, err
+		zap.L().Error("failed to decode PEM block containing RSA PRIVATE KEY", zap.String("file path", filePath))
+		return nil, fmt.Errorf("%w in %s", errNoPrivateKey, filePath)
 	}
 
 	privateKey, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
@@ -52,3 +61,37 @@ func PrivateKey(filePath string) (*rsa.PrivateKey, error) {
 
 	return privateKey, nil
 }
+
+// PrivateKeys loads the private keys from the comma-separated list of files and directories,
+// all *.pem files of a directory are loaded.
+func PrivateKeys(paths string) ([]*rsa.PrivateKey, error) {
+	var keys []*rsa.PrivateKey
+
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(path, "*.pem")); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, file := range files {
+			key, err := PrivateKey(file)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w in %s", errNoPrivateKey, paths)
+	}
+
+	return keys, nil
+}
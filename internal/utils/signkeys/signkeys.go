@@ -0,0 +1,95 @@
+// Package signkeys loads the Ed25519 keys of the agents and signs the requests with them.
+//
+// Each agent has its own key, so the server knows which agent sent the request and
+// a single agent can be revoked. The keys can be created with OpenSSL:
+//
+//	openssl genpkey -algorithm ed25519 -out agent_key.pem
+//	openssl pkey -in agent_key.pem -pubout -outform DER | base64
+//
+// the second command prints the public key for the server registry.
+package signkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/hash"
+)
+
+var (
+	errNoPrivateKey       = errors.New("no PRIVATE KEY PEM block")
+	errNotEd25519         = errors.New("not an Ed25519 key")
+	errIncorrectPublicKey = errors.New("incorrect Ed25519 public key")
+)
+
+// PrivateKey reads the Ed25519 private key in the PKCS #8 PEM format.
+func PrivateKey(filePath string) (ed25519.PrivateKey, error) {
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	pemBlock, _ := pem.Decode(file)
+	if pemBlock == nil || pemBlock.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%w in %s", errNoPrivateKey, filePath)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w in %s", errNotEd25519, filePath)
+	}
+
+	return privateKey, nil
+}
+
+// ParsePublicKey parses the base64 encoded Ed25519 public key, either the raw 32 bytes
+// or the DER encoded SubjectPublicKeyInfo printed by OpenSSL.
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIncorrectPublicKey, err)
+	}
+
+	if len(der) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(der), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIncorrectPublicKey, err)
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errNotEd25519
+	}
+
+	return publicKey, nil
+}
+
+// Sign signs the canonical request and returns the base64 encoded signature.
+func Sign(key ed25519.PrivateKey, method, requestURI, timestamp, nonce string, body []byte) string {
+	signature := ed25519.Sign(key, hash.CanonicalRequest(method, requestURI, timestamp, nonce, body))
+
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+// Verify checks the base64 encoded signature of the canonical request.
+func Verify(key ed25519.PublicKey, method, requestURI, timestamp, nonce string, body []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(key, hash.CanonicalRequest(method, requestURI, timestamp, nonce, body), sig)
+}
@@ -0,0 +1,52 @@
+package signkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "agent_key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	loaded, err := PrivateKey(keyPath)
+	require.NoError(t, err)
+	assert.True(t, privateKey.Equal(loaded))
+
+	spki, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(publicKey),
+		base64.StdEncoding.EncodeToString(spki),
+	} {
+		parsed, errParse := ParsePublicKey(encoded)
+		require.NoError(t, errParse)
+		assert.True(t, publicKey.Equal(parsed))
+	}
+
+	_, err = ParsePublicKey("uwu")
+	assert.ErrorIs(t, err, errIncorrectPublicKey)
+	_, err = ParsePublicKey(base64.StdEncoding.EncodeToString([]byte("too short")))
+	assert.ErrorIs(t, err, errIncorrectPublicKey)
+
+	signature := Sign(loaded, "POST", "/updates/", "1711972800", "nonce", []byte("body"))
+	assert.True(t, Verify(publicKey, "POST", "/updates/", "1711972800", "nonce", []byte("body"), signature))
+	assert.False(t, Verify(publicKey, "POST", "/update/", "1711972800", "nonce", []byte("body"), signature))
+	assert.False(t, Verify(publicKey, "POST", "/updates/", "1711972800", "nonce", []byte("other"), signature))
+	assert.False(t, Verify(publicKey, "POST", "/updates/", "1711972800", "nonce", []byte("body"), "uwu"))
+}
@@ -0,0 +1,148 @@
+// Package tlsconfig creates the TLS configs of the servers and the agent. The certificates
+// and the client CA are loaded from the files and reloaded when the files are modified,
+// so they can be renewed without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+)
+
+var errNoCertificates = errors.New("no certificates found")
+
+// Server returns the TLS config of the server with the certificate and the key from the files.
+// If the client CA file is set, the clients must present a certificate signed by it (mutual TLS).
+func Server(certPath, keyPath, clientCAPath string) (*tls.Config, error) {
+	certs, err := reload.New(func() (*tls.Certificate, error) {
+		return loadCertificate(certPath, keyPath)
+	}, certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.Get(), nil
+		},
+	}
+
+	if clientCAPath == "" {
+		return cfg, nil
+	}
+
+	clientCAs, err := reload.New(func() (*x509.CertPool, error) {
+		return loadCertPool(clientCAPath)
+	}, clientCAPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the client certificate is verified by VerifyConnection, so the CA pool can be reloaded
+	cfg.ClientAuth = tls.RequireAnyClientCert
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		return verifyClient(state.PeerCertificates, clientCAs.Get())
+	}
+
+	return cfg, nil
+}
+
+// Client returns the TLS config of the agent. The server certificate is verified with the CA
+// from the file or with the system roots if the path is empty. If the certificate and the key
+// files are set, the certificate is presented to the server for mutual TLS.
+func Client(caPath, certPath, keyPath string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caPath != "" {
+		pool, err := loadCertPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certPath == "" && keyPath == "" {
+		return cfg, nil
+	}
+
+	certs, err := reload.New(func() (*tls.Certificate, error) {
+		return loadCertificate(certPath, keyPath)
+	}, certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return certs.Get(), nil
+	}
+
+	return cfg, nil
+}
+
+// Identity returns the name of the agent from the client certificate, the common name
+// or the first DNS name. The certificate is verified only by the config with the client CA,
+// without it the server doesn't request the certificate and the identity is empty.
+func Identity(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := state.PeerCertificates[0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	return ""
+}
+
+func verifyClient(certs []*x509.Certificate, roots *x509.CertPool) error {
+	if len(certs) == 0 {
+		return errNoCertificates
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	return err
+}
+
+func loadCertificate(certPath, keyPath string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("%w in %s", errNoCertificates, path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,207 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivas1ly/uwu-metrics/internal/utils/reload"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes the certificate with the name and the key to the name.pem and name-key.pem files.
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
+
+// serve accepts the TLS connections and sends the client identity to the channel.
+func serve(t *testing.T, cfg *tls.Config) (string, <-chan string) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	identities := make(chan string, 1)
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+
+			tlsConn := conn.(*tls.Conn)
+			if errHandshake := tlsConn.Handshake(); errHandshake == nil {
+				state := tlsConn.ConnectionState()
+				identities <- Identity(&state)
+				_, _ = io.WriteString(conn, "ok")
+			}
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().String(), identities
+}
+
+// dial returns the serial number of the server certificate.
+func dial(addr string, cfg *tls.Config) (int64, error) {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// the server verifies the client certificate after the client handshake is done
+	if _, err = io.ReadAll(conn); err != nil {
+		return 0, err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	ca := newTestCA(t, dir)
+	ca.issue(t, dir, "server", 2, x509.ExtKeyUsageServerAuth)
+	ca.issue(t, dir, "agent-1", 3, x509.ExtKeyUsageClientAuth)
+
+	t.Run("server certificate is reloaded", func(t *testing.T) {
+		serverCfg, err := Server(path("server.pem"), path("server-key.pem"), "")
+		require.NoError(t, err)
+		addr, identities := serve(t, serverCfg)
+
+		clientCfg, err := Client(path("ca.pem"), "", "")
+		require.NoError(t, err)
+
+		serial, err := dial(addr, clientCfg)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), serial)
+		assert.Equal(t, "", <-identities)
+
+		ca.issue(t, dir, "server", 4, x509.ExtKeyUsageServerAuth)
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(path("server.pem"), future, future))
+		require.NoError(t, os.Chtimes(path("server-key.pem"), future, future))
+
+		// the files are checked at most once per reload.CheckInterval
+		assert.Eventually(t, func() bool {
+			reloaded, errDial := dial(addr, clientCfg)
+			if errDial != nil {
+				return false
+			}
+			<-identities
+
+			return reloaded == 4
+		}, 3*reload.CheckInterval, 50*time.Millisecond)
+	})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		serverCfg, err := Server(path("server.pem"), path("server-key.pem"), path("ca.pem"))
+		require.NoError(t, err)
+		addr, identities := serve(t, serverCfg)
+
+		clientCfg, err := Client(path("ca.pem"), path("agent-1.pem"), path("agent-1-key.pem"))
+		require.NoError(t, err)
+
+		_, err = dial(addr, clientCfg)
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", <-identities)
+
+		withoutCert, err := Client(path("ca.pem"), "", "")
+		require.NoError(t, err)
+		_, err = dial(addr, withoutCert)
+		assert.Error(t, err)
+
+		// the server certificate can't be used by the client
+		wrongUsage, err := Client(path("ca.pem"), path("server.pem"), path("server-key.pem"))
+		require.NoError(t, err)
+		_, err = dial(addr, wrongUsage)
+		assert.Error(t, err)
+	})
+
+	t.Run("incorrect files", func(t *testing.T) {
+		_, err := Server(path("server.pem"), path("agent-1-key.pem"), "")
+		assert.Error(t, err)
+
+		_, err = Server(path("server.pem"), path("server-key.pem"), path("server-key.pem"))
+		assert.Error(t, err)
+
+		_, err = Client(path("missing.pem"), "", "")
+		assert.Error(t, err)
+	})
+}
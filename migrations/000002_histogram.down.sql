@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+DELETE FROM metrics WHERE mtype = 'histogram';
+
+ALTER TABLE metrics
+    DROP COLUMN IF EXISTS mbounds,
+    DROP COLUMN IF EXISTS mcounts,
+    DROP COLUMN IF EXISTS msum,
+    DROP COLUMN IF EXISTS mcount;
+
+COMMIT;
\ No newline at end of file
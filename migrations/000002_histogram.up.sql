@@ -0,0 +1,24 @@
+BEGIN TRANSACTION;
+
+/*
+                      Table "public.metrics"
+  Column  |        Type        | Collation | Nullable | Default
+----------+--------------------+-----------+----------+---------
+ id       | text               |           | not null |
+ mtype    | text               |           | not null |
+ mdelta   | bigint             |           |          |
+ mvalue   | double precision   |           |          |
+ mbounds  | double precision[] |           |          |
+ mcounts  | bigint[]           |           |          |
+ msum     | double precision   |           |          |
+ mcount   | bigint             |           |          |
+Indexes:
+    "metrics_pkey" PRIMARY KEY, btree (id)
+*/
+ALTER TABLE metrics
+    ADD COLUMN IF NOT EXISTS mbounds DOUBLE PRECISION[] NULL,
+    ADD COLUMN IF NOT EXISTS mcounts BIGINT[] NULL,
+    ADD COLUMN IF NOT EXISTS msum DOUBLE PRECISION NULL,
+    ADD COLUMN IF NOT EXISTS mcount BIGINT NULL;
+
+COMMIT;
\ No newline at end of file
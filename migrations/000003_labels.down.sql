@@ -0,0 +1,11 @@
+BEGIN TRANSACTION;
+
+DROP INDEX IF EXISTS metrics_mname_idx;
+
+DELETE FROM metrics WHERE mlabels <> '{}';
+
+ALTER TABLE metrics
+    DROP COLUMN IF EXISTS mname,
+    DROP COLUMN IF EXISTS mlabels;
+
+COMMIT;
\ No newline at end of file
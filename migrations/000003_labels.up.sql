@@ -0,0 +1,30 @@
+BEGIN TRANSACTION;
+
+/*
+                      Table "public.metrics"
+  Column  |        Type        | Collation | Nullable | Default
+----------+--------------------+-----------+----------+-----------
+ id       | text               |           | not null |
+ mtype    | text               |           | not null |
+ mdelta   | bigint             |           |          |
+ mvalue   | double precision   |           |          |
+ mbounds  | double precision[] |           |          |
+ mcounts  | bigint[]           |           |          |
+ msum     | double precision   |           |          |
+ mcount   | bigint             |           |          |
+ mname    | text               |           |          |
+ mlabels  | jsonb              |           | not null | '{}'::jsonb
+Indexes:
+    "metrics_pkey" PRIMARY KEY, btree (id)
+    "metrics_mname_idx" btree (mname)
+*/
+ALTER TABLE metrics
+    ADD COLUMN IF NOT EXISTS mname TEXT NULL,
+    ADD COLUMN IF NOT EXISTS mlabels JSONB NOT NULL DEFAULT '{}';
+
+-- id is the series key, metrics saved before labels were added have the name as id
+UPDATE metrics SET mname = id WHERE mname IS NULL;
+
+CREATE INDEX IF NOT EXISTS metrics_mname_idx ON metrics (mname);
+
+COMMIT;
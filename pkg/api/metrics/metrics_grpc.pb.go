@@ -20,14 +20,30 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	MetricsService_Updates_FullMethodName = "/metrics.MetricsService/Updates"
+	MetricsService_Update_FullMethodName        = "/metrics.MetricsService/Update"
+	MetricsService_Updates_FullMethodName       = "/metrics.MetricsService/Updates"
+	MetricsService_StreamUpdates_FullMethodName = "/metrics.MetricsService/StreamUpdates"
+	MetricsService_Value_FullMethodName         = "/metrics.MetricsService/Value"
+	MetricsService_History_FullMethodName       = "/metrics.MetricsService/History"
+	MetricsService_List_FullMethodName          = "/metrics.MetricsService/List"
+	MetricsService_Watch_FullMethodName         = "/metrics.MetricsService/Watch"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MetricsServiceClient interface {
+	Update(ctx context.Context, in *Metric, opts ...grpc.CallOption) (*Metric, error)
 	Updates(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Applies the batches sent over a long-lived stream, each batch as an Updates call.
+	// The batches are acknowledged in the order they are received.
+	StreamUpdates(ctx context.Context, opts ...grpc.CallOption) (MetricsService_StreamUpdatesClient, error)
+	Value(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*Metric, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Streams the metric updates as they are applied, each one with the current stored value.
+	// A client that falls behind the updates gets the ResourceExhausted status.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (MetricsService_WatchClient, error)
 }
 
 type metricsServiceClient struct {
@@ -38,6 +54,15 @@ func NewMetricsServiceClient(cc grpc.ClientConnInterface) MetricsServiceClient {
 	return &metricsServiceClient{cc}
 }
 
+func (c *metricsServiceClient) Update(ctx context.Context, in *Metric, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, MetricsService_Update_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *metricsServiceClient) Updates(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, MetricsService_Updates_FullMethodName, in, out, opts...)
@@ -47,11 +72,111 @@ func (c *metricsServiceClient) Updates(ctx context.Context, in *MetricsRequest,
 	return out, nil
 }
 
+func (c *metricsServiceClient) StreamUpdates(ctx context.Context, opts ...grpc.CallOption) (MetricsService_StreamUpdatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[0], MetricsService_StreamUpdates_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsServiceStreamUpdatesClient{stream}
+	return x, nil
+}
+
+type MetricsService_StreamUpdatesClient interface {
+	Send(*MetricsRequest) error
+	Recv() (*UpdatesAck, error)
+	grpc.ClientStream
+}
+
+type metricsServiceStreamUpdatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsServiceStreamUpdatesClient) Send(m *MetricsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricsServiceStreamUpdatesClient) Recv() (*UpdatesAck, error) {
+	m := new(UpdatesAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *metricsServiceClient) Value(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*Metric, error) {
+	out := new(Metric)
+	err := c.cc.Invoke(ctx, MetricsService_Value_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, MetricsService_History_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, MetricsService_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (MetricsService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MetricsService_WatchClient interface {
+	Recv() (*Metric, error)
+	grpc.ClientStream
+}
+
+type metricsServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsServiceWatchClient) Recv() (*Metric, error) {
+	m := new(Metric)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility
 type MetricsServiceServer interface {
+	Update(context.Context, *Metric) (*Metric, error)
 	Updates(context.Context, *MetricsRequest) (*emptypb.Empty, error)
+	// Applies the batches sent over a long-lived stream, each batch as an Updates call.
+	// The batches are acknowledged in the order they are received.
+	StreamUpdates(MetricsService_StreamUpdatesServer) error
+	Value(context.Context, *ValueRequest) (*Metric, error)
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Streams the metric updates as they are applied, each one with the current stored value.
+	// A client that falls behind the updates gets the ResourceExhausted status.
+	Watch(*WatchRequest, MetricsService_WatchServer) error
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -59,9 +184,27 @@ type MetricsServiceServer interface {
 type UnimplementedMetricsServiceServer struct {
 }
 
+func (UnimplementedMetricsServiceServer) Update(context.Context, *Metric) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
 func (UnimplementedMetricsServiceServer) Updates(context.Context, *MetricsRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Updates not implemented")
 }
+func (UnimplementedMetricsServiceServer) StreamUpdates(MetricsService_StreamUpdatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUpdates not implemented")
+}
+func (UnimplementedMetricsServiceServer) Value(context.Context, *ValueRequest) (*Metric, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Value not implemented")
+}
+func (UnimplementedMetricsServiceServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedMetricsServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedMetricsServiceServer) Watch(*WatchRequest, MetricsService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 
 // UnsafeMetricsServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -75,6 +218,24 @@ func RegisterMetricsServiceServer(s grpc.ServiceRegistrar, srv MetricsServiceSer
 	s.RegisterService(&MetricsService_ServiceDesc, srv)
 }
 
+func _MetricsService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Metric)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Update(ctx, req.(*Metric))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _MetricsService_Updates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(MetricsRequest)
 	if err := dec(in); err != nil {
@@ -93,6 +254,107 @@ func _MetricsService_Updates_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsService_StreamUpdates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).StreamUpdates(&metricsServiceStreamUpdatesServer{stream})
+}
+
+type MetricsService_StreamUpdatesServer interface {
+	Send(*UpdatesAck) error
+	Recv() (*MetricsRequest, error)
+	grpc.ServerStream
+}
+
+type metricsServiceStreamUpdatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsServiceStreamUpdatesServer) Send(m *UpdatesAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricsServiceStreamUpdatesServer) Recv() (*MetricsRequest, error) {
+	m := new(MetricsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MetricsService_Value_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Value(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Value_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Value(ctx, req.(*ValueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_History_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).Watch(m, &metricsServiceWatchServer{stream})
+}
+
+type MetricsService_WatchServer interface {
+	Send(*Metric) error
+	grpc.ServerStream
+}
+
+type metricsServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsServiceWatchServer) Send(m *Metric) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -100,11 +362,39 @@ var MetricsService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "metrics.MetricsService",
 	HandlerType: (*MetricsServiceServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Update",
+			Handler:    _MetricsService_Update_Handler,
+		},
 		{
 			MethodName: "Updates",
 			Handler:    _MetricsService_Updates_Handler,
 		},
+		{
+			MethodName: "Value",
+			Handler:    _MetricsService_Value_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _MetricsService_History_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _MetricsService_List_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamUpdates",
+			Handler:       _MetricsService_StreamUpdates_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _MetricsService_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/metrics/metrics.proto",
 }
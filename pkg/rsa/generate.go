@@ -11,8 +11,8 @@ import (
 )
 
 const (
-	// smaller size causes error "message too long for RSA key size".
-	bitSize = 16384
+	// the payloads are encrypted with AES-GCM, the RSA key wraps only the data key.
+	bitSize = 4096
 )
 
 //go:generate go run generate.go